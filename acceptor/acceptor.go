@@ -29,6 +29,13 @@ type PlayerConn interface {
 	net.Conn
 }
 
+// WrappedConn is implemented by the player conns that wrap another one, like
+// the ones of the acceptor wrappers, so its optional features can be reached
+type WrappedConn interface {
+	// Unwrap returns the wrapped connection
+	Unwrap() PlayerConn
+}
+
 // Acceptor type interface
 type Acceptor interface {
 	ListenAndServe()
@@ -0,0 +1,160 @@
+// Copyright (c) TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package acceptor
+
+import (
+	"crypto/tls"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/topfreegames/pitaya/v2/constants"
+	"github.com/topfreegames/pitaya/v2/logger"
+)
+
+// CertificateProvider provides the certificate presented on TLS handshakes.
+// It is called on every new handshake, so a renewed certificate is used by
+// new connections while the established ones are kept untouched
+type CertificateProvider interface {
+	GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error)
+}
+
+// StaticCertificateProvider provides a certificate that is only changed
+// programmatically through SetCertificate
+type StaticCertificateProvider struct {
+	mutex sync.RWMutex
+	cert  *tls.Certificate
+}
+
+// NewStaticCertificateProvider returns a provider serving cert
+func NewStaticCertificateProvider(cert tls.Certificate) *StaticCertificateProvider {
+	return &StaticCertificateProvider{cert: &cert}
+}
+
+// SetCertificate replaces the certificate presented on new handshakes
+func (p *StaticCertificateProvider) SetCertificate(cert tls.Certificate) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.cert = &cert
+}
+
+// GetCertificate returns the current certificate
+func (p *StaticCertificateProvider) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.cert, nil
+}
+
+// FileCertificateProvider provides a certificate loaded from a cert and key
+// file pair, which is reloaded whenever the files change. The directories of
+// the files are watched instead of the files themselves, so replacing them
+// atomically by renaming or swapping symlinks is also detected
+type FileCertificateProvider struct {
+	StaticCertificateProvider
+	certFile string
+	keyFile  string
+	watcher  *fsnotify.Watcher
+}
+
+// NewFileCertificateProvider loads the certificate and starts watching the
+// files for changes, Close must be called to stop watching them
+func NewFileCertificateProvider(certFile, keyFile string) (*FileCertificateProvider, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", constants.ErrInvalidCertificates, err)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range uniqueDirs(certFile, keyFile) {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+	}
+
+	p := &FileCertificateProvider{
+		StaticCertificateProvider: StaticCertificateProvider{cert: &cert},
+		certFile:                  certFile,
+		keyFile:                   keyFile,
+		watcher:                   watcher,
+	}
+	go p.watch()
+	return p, nil
+}
+
+// Reload loads the certificate from the files, keeping the current one if
+// they are invalid
+func (p *FileCertificateProvider) Reload() error {
+	cert, err := tls.LoadX509KeyPair(p.certFile, p.keyFile)
+	if err != nil {
+		return fmt.Errorf("%w: %v", constants.ErrInvalidCertificates, err)
+	}
+	p.SetCertificate(cert)
+	return nil
+}
+
+// Close stops watching the files
+func (p *FileCertificateProvider) Close() error {
+	return p.watcher.Close()
+}
+
+func (p *FileCertificateProvider) watch() {
+	for {
+		select {
+		case event, ok := <-p.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			// the cert and key may be written one at a time, so a failed
+			// reload is expected until both files are in place
+			if err := p.Reload(); err != nil {
+				logger.Log.Debugf("Failed to reload certificate after %s: %s", event.String(), err.Error())
+				continue
+			}
+			logger.Log.Infof("Reloaded certificate from %s", p.certFile)
+		case err, ok := <-p.watcher.Errors:
+			if !ok {
+				return
+			}
+			logger.Log.Errorf("Failed to watch certificate files: %s", err.Error())
+		}
+	}
+}
+
+func uniqueDirs(files ...string) []string {
+	dirs := []string{}
+	seen := map[string]bool{}
+	for _, f := range files {
+		dir := filepath.Dir(f)
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
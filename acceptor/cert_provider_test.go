@@ -0,0 +1,201 @@
+// Copyright (c) TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package acceptor
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/topfreegames/pitaya/v2/config"
+	"github.com/topfreegames/pitaya/v2/constants"
+	"github.com/topfreegames/pitaya/v2/helpers"
+)
+
+// writeTestCertificate writes a self signed certificate identified by serial
+// to dir and returns the cert and key paths
+func writeTestCertificate(t *testing.T, dir string, serial int64) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile
+}
+
+func loadTestCertificate(t *testing.T, dir string, serial int64) tls.Certificate {
+	t.Helper()
+	cert, err := tls.LoadX509KeyPair(writeTestCertificate(t, dir, serial))
+	assert.NoError(t, err)
+	return cert
+}
+
+func certificateSerial(t *testing.T, cert *tls.Certificate) int64 {
+	t.Helper()
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	assert.NoError(t, err)
+	return leaf.SerialNumber.Int64()
+}
+
+func providerSerial(t *testing.T, p CertificateProvider) int64 {
+	t.Helper()
+	cert, err := p.GetCertificate(nil)
+	assert.NoError(t, err)
+	return certificateSerial(t, cert)
+}
+
+func TestStaticCertificateProvider(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	p := NewStaticCertificateProvider(loadTestCertificate(t, dir, 1))
+	assert.Equal(t, int64(1), providerSerial(t, p))
+
+	p.SetCertificate(loadTestCertificate(t, dir, 2))
+	assert.Equal(t, int64(2), providerSerial(t, p))
+}
+
+func TestNewFileCertificateProvider(t *testing.T) {
+	t.Parallel()
+	_, err := NewFileCertificateProvider("wqd", "wqdqwd")
+	assert.ErrorIs(t, err, constants.ErrInvalidCertificates)
+
+	p, err := NewFileCertificateProvider(writeTestCertificate(t, t.TempDir(), 1))
+	assert.NoError(t, err)
+	defer p.Close()
+	assert.Equal(t, int64(1), providerSerial(t, p))
+}
+
+func TestFileCertificateProviderReloadsOnChange(t *testing.T) {
+	dir := t.TempDir()
+	p, err := NewFileCertificateProvider(writeTestCertificate(t, dir, 1))
+	assert.NoError(t, err)
+	defer p.Close()
+
+	writeTestCertificate(t, dir, 2)
+	helpers.ShouldEventuallyReturn(t, func() int64 {
+		return providerSerial(t, p)
+	}, int64(2), 10*time.Millisecond, time.Second)
+}
+
+func TestFileCertificateProviderKeepsCertificateOnInvalidFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCertificate(t, dir, 1)
+	p, err := NewFileCertificateProvider(certFile, keyFile)
+	assert.NoError(t, err)
+	defer p.Close()
+
+	assert.NoError(t, os.WriteFile(keyFile, []byte("invalid"), 0600))
+	assert.ErrorIs(t, p.Reload(), constants.ErrInvalidCertificates)
+	assert.Equal(t, int64(1), providerSerial(t, p))
+}
+
+func TestTCPAcceptorCertificateProvider(t *testing.T) {
+	dir := t.TempDir()
+	p := NewStaticCertificateProvider(loadTestCertificate(t, dir, 1))
+	a := NewTLSAcceptorWithCertificateProvider("127.0.0.1:0", p)
+	go a.ListenAndServe()
+	defer a.Stop()
+	helpers.ShouldEventuallyReturn(t, func() bool {
+		return a.GetAddr() != ""
+	}, true, 10*time.Millisecond, 100*time.Millisecond)
+
+	// the server side handshake only happens when the player conn is used,
+	// so it must be done while the client is dialing
+	dial := func() (*tls.Conn, PlayerConn) {
+		connChan := make(chan *tls.Conn)
+		go func() {
+			conn, err := tls.Dial("tcp", a.GetAddr(), &tls.Config{InsecureSkipVerify: true})
+			assert.NoError(t, err)
+			connChan <- conn
+		}()
+		playerConn := helpers.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(*tcpPlayerConn)
+		assert.NoError(t, playerConn.Conn.(*tls.Conn).Handshake())
+		return helpers.ShouldEventuallyReceive(t, connChan, 100*time.Millisecond).(*tls.Conn), playerConn
+	}
+
+	oldConn, oldPlayerConn := dial()
+	defer oldConn.Close()
+	assert.Equal(t, big.NewInt(1), oldConn.ConnectionState().PeerCertificates[0].SerialNumber)
+
+	p.SetCertificate(loadTestCertificate(t, dir, 2))
+	newConn, _ := dial()
+	defer newConn.Close()
+	assert.Equal(t, big.NewInt(2), newConn.ConnectionState().PeerCertificates[0].SerialNumber)
+
+	// connections established before the renewal keep working
+	data := []byte{0x02, 0x00, 0x00, 0x01, 0x00}
+	_, err := oldConn.Write(data)
+	assert.NoError(t, err)
+	msg, err := oldPlayerConn.GetNextMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, data, msg)
+}
+
+func TestWSAcceptorCertificateProvider(t *testing.T) {
+	dir := t.TempDir()
+	p := NewStaticCertificateProvider(loadTestCertificate(t, dir, 1))
+	w := NewWSAcceptorWithCertificateProvider("127.0.0.1:0", *config.NewDefaultWSAcceptorConfig(), p)
+	go w.ListenAndServe()
+	defer w.Stop()
+	helpers.ShouldEventuallyReturn(t, func() bool {
+		return w.IsRunning()
+	}, true, 10*time.Millisecond, 100*time.Millisecond)
+
+	dialer := &websocket.Dialer{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	for _, serial := range []int64{1, 2} {
+		p.SetCertificate(loadTestCertificate(t, dir, serial))
+		conn, _, err := dialer.Dial(fmt.Sprintf("wss://%s", w.GetAddr()), nil)
+		assert.NoError(t, err)
+		defer conn.Close()
+		helpers.ShouldEventuallyReceive(t, w.GetConnChan(), 100*time.Millisecond)
+
+		state := conn.UnderlyingConn().(*tls.Conn).ConnectionState()
+		assert.Equal(t, big.NewInt(serial), state.PeerCertificates[0].SerialNumber)
+	}
+}
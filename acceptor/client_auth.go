@@ -0,0 +1,76 @@
+// Copyright (c) TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package acceptor
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/topfreegames/pitaya/v2/constants"
+)
+
+// ClientCertificateConn is implemented by the player conns that can
+// authenticate clients with TLS certificates
+type ClientCertificateConn interface {
+	// ClientCertificate returns the client certificate verified against the
+	// acceptor client CAs, or nil if the client was not authenticated
+	ClientCertificate() (*x509.Certificate, error)
+}
+
+// GetClientCertificate returns the verified client certificate of conn, or
+// nil if conn does not support client authentication
+func GetClientCertificate(conn PlayerConn) (*x509.Certificate, error) {
+	if c, ok := conn.(ClientCertificateConn); ok {
+		return c.ClientCertificate()
+	}
+	return nil, nil
+}
+
+// NewClientCAPool loads the PEM encoded CA certificates used by the
+// acceptors to verify the client certificates
+func NewClientCAPool(caFiles ...string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	for _, caFile := range caFiles {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", constants.ErrInvalidCertificates, err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%w: no certificates found in %s", constants.ErrInvalidCertificates, caFile)
+		}
+	}
+	return pool, nil
+}
+
+// verifiedClientCertificate runs the handshake of conn if it was not run
+// yet, since tls conns only run it on the first read or write
+func verifiedClientCertificate(conn *tls.Conn) (*x509.Certificate, error) {
+	if err := conn.Handshake(); err != nil {
+		return nil, err
+	}
+	state := conn.ConnectionState()
+	if len(state.VerifiedChains) == 0 {
+		return nil, nil
+	}
+	return state.VerifiedChains[0][0], nil
+}
@@ -0,0 +1,184 @@
+// Copyright (c) TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package acceptor
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/topfreegames/pitaya/v2/constants"
+	"github.com/topfreegames/pitaya/v2/helpers"
+)
+
+// newTestClientCA creates a CA and a client certificate signed by it, and
+// returns the CA file path and the client certificate
+func newTestClientCA(t *testing.T) (string, tls.Certificate) {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, &caKey.PublicKey, caKey)
+	assert.NoError(t, err)
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	assert.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0600))
+
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	client := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "bot", Organization: []string{"partner"}},
+		DNSNames:     []string{"bot.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	clientDER, err := x509.CreateCertificate(rand.Reader, client, ca, &clientKey.PublicKey, caKey)
+	assert.NoError(t, err)
+	return caFile, tls.Certificate{Certificate: [][]byte{clientDER}, PrivateKey: clientKey}
+}
+
+func TestNewClientCAPool(t *testing.T) {
+	t.Parallel()
+	caFile, _ := newTestClientCA(t)
+	pool, err := NewClientCAPool(caFile)
+	assert.NoError(t, err)
+	assert.NotNil(t, pool)
+
+	_, err = NewClientCAPool("wqodij")
+	assert.ErrorIs(t, err, constants.ErrInvalidCertificates)
+
+	_, err = NewClientCAPool("./fixtures/server.key")
+	assert.ErrorIs(t, err, constants.ErrInvalidCertificates)
+}
+
+func TestGetClientCertificateWithoutTLS(t *testing.T) {
+	t.Parallel()
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	cert, err := GetClientCertificate(&tcpPlayerConn{Conn: c1, remoteAddr: c1.RemoteAddr()})
+	assert.NoError(t, err)
+	assert.Nil(t, cert)
+}
+
+func TestTCPAcceptorClientAuth(t *testing.T) {
+	caFile, clientCert := newTestClientCA(t)
+	pool, err := NewClientCAPool(caFile)
+	assert.NoError(t, err)
+
+	tables := []struct {
+		name        string
+		clientCerts []tls.Certificate
+		commonName  string
+	}{
+		{"with_client_certificate", []tls.Certificate{clientCert}, "bot"},
+		{"without_client_certificate", nil, ""},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			a := NewTCPAcceptor("127.0.0.1:0", "./fixtures/server.crt", "./fixtures/server.key")
+			a.EnableClientAuth(tls.RequireAndVerifyClientCert, pool)
+			go a.ListenAndServe()
+			defer a.Stop()
+			helpers.ShouldEventuallyReturn(t, func() bool {
+				return a.GetAddr() != ""
+			}, true, 10*time.Millisecond, 100*time.Millisecond)
+
+			go func() {
+				conn, err := tls.Dial("tcp", a.GetAddr(), &tls.Config{
+					InsecureSkipVerify: true,
+					Certificates:       table.clientCerts,
+				})
+				if err == nil {
+					defer conn.Close()
+					// tls 1.3 clients only see the rejection when reading
+					conn.Read(make([]byte, 1))
+				}
+			}()
+
+			playerConn := helpers.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(PlayerConn)
+			cert, err := GetClientCertificate(playerConn)
+			if table.commonName == "" {
+				assert.Error(t, err)
+				assert.Nil(t, cert)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, table.commonName, cert.Subject.CommonName)
+				assert.Equal(t, []string{"bot.example.com"}, cert.DNSNames)
+			}
+		})
+	}
+}
+
+func TestWSAcceptorClientAuth(t *testing.T) {
+	caFile, clientCert := newTestClientCA(t)
+	pool, err := NewClientCAPool(caFile)
+	assert.NoError(t, err)
+
+	w := NewWSAcceptor("127.0.0.1:0", "./fixtures/server.crt", "./fixtures/server.key")
+	w.EnableClientAuth(tls.RequireAndVerifyClientCert, pool)
+	go w.ListenAndServe()
+	defer w.Stop()
+	helpers.ShouldEventuallyReturn(t, func() bool {
+		return w.IsRunning()
+	}, true, 10*time.Millisecond, 100*time.Millisecond)
+
+	addr := fmt.Sprintf("wss://%s", w.GetAddr())
+	dialer := &websocket.Dialer{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	_, _, err = dialer.Dial(addr, nil)
+	assert.Error(t, err)
+
+	dialer.TLSClientConfig.Certificates = []tls.Certificate{clientCert}
+	conn, _, err := dialer.Dial(addr, nil)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	playerConn := helpers.ShouldEventuallyReceive(t, w.GetConnChan(), 100*time.Millisecond).(PlayerConn)
+	cert, err := GetClientCertificate(playerConn)
+	assert.NoError(t, err)
+	assert.Equal(t, "bot", cert.Subject.CommonName)
+	assert.Equal(t, []string{"partner"}, cert.Subject.Organization)
+}
@@ -0,0 +1,657 @@
+// Copyright (c) TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package acceptor
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/topfreegames/pitaya/v2/constants"
+	"github.com/topfreegames/pitaya/v2/logger"
+)
+
+// HTTPAcceptor is a fallback for networks where websockets are blocked.
+// A client starts a connection with POST /connect, which answers with a
+// connection token, and then sends that token in the "token" query
+// parameter of every other request:
+//
+//	POST /send    body with one or more pomelo packets
+//	GET  /poll    long-polls packets sent by the server, 204 if none arrived
+//	GET  /events  streams packets sent by the server as base64 Server-Sent Events
+//	POST /close   closes the connection
+//
+// A connection that makes no request for two heartbeat intervals is closed,
+// as is a connection whose client lets too much data queue up without
+// polling for it. Each connection is read by a single /poll or /events
+// request at a time, concurrent ones are rejected with 409 Conflict.
+type HTTPAcceptor struct {
+	addr              string
+	connChan          chan PlayerConn
+	listener          net.Listener
+	server            *http.Server
+	certFile          string
+	keyFile           string
+	running           bool
+	heartbeatInterval time.Duration
+	conns             map[string]*httpPlayerConn
+	connsMutex        sync.Mutex
+	chStop            chan struct{}
+	maxPacketSize     int
+	maxBodySize       int64
+	maxConns          int
+	maxQueueSize      int
+}
+
+const (
+	httpMaxBodySize       = 16 * 1024 * 1024
+	httpMaxConns          = 10000
+	httpMaxQueueSize      = 16 * 1024 * 1024
+	httpReadHeaderTimeout = 10 * time.Second
+	httpReadTimeout       = 30 * time.Second
+	httpIdleTimeout       = 2 * time.Minute
+)
+
+// NewHTTPAcceptor returns a new instance of HTTPAcceptor, heartbeatInterval
+// should be the same configured for the app
+func NewHTTPAcceptor(addr string, heartbeatInterval time.Duration, certs ...string) *HTTPAcceptor {
+	keyFile := ""
+	certFile := ""
+	if len(certs) != 2 && len(certs) != 0 {
+		panic(constants.ErrInvalidCertificates)
+	} else if len(certs) == 2 {
+		certFile = certs[0]
+		keyFile = certs[1]
+	}
+
+	return &HTTPAcceptor{
+		addr:              addr,
+		connChan:          make(chan PlayerConn),
+		certFile:          certFile,
+		keyFile:           keyFile,
+		running:           false,
+		heartbeatInterval: heartbeatInterval,
+		conns:             make(map[string]*httpPlayerConn),
+		chStop:            make(chan struct{}),
+		maxBodySize:       httpMaxBodySize,
+		maxConns:          httpMaxConns,
+		maxQueueSize:      httpMaxQueueSize,
+	}
+}
+
+// IsRunning returns if the acceptor is running
+func (h *HTTPAcceptor) IsRunning() bool {
+	return h.running
+}
+
+// GetConfiguredAddress returns the addr the acceptor was configured with
+func (h *HTTPAcceptor) GetConfiguredAddress() string {
+	return h.addr
+}
+
+// GetAddr returns the addr the acceptor will listen on
+func (h *HTTPAcceptor) GetAddr() string {
+	if h.listener != nil {
+		return h.listener.Addr().String()
+	}
+	return ""
+}
+
+// GetConnChan gets a connection channel
+func (h *HTTPAcceptor) GetConnChan() chan PlayerConn {
+	return h.connChan
+}
+
+// EnableProxyProtocol is not implemented for the HTTP acceptor
+func (h *HTTPAcceptor) EnableProxyProtocol() {
+}
+
+// SetMaxPacketSize makes the acceptor close the connections that send
+// packets larger than size bytes, which are rejected from their header
+// before being read. Zero keeps the 16MB limit of the pomelo protocol, a
+// larger size allows clients to send larger length prefixed packets
+func (h *HTTPAcceptor) SetMaxPacketSize(size int) {
+	h.maxPacketSize = size
+}
+
+// SetMaxBodySize sets the largest body accepted by /send, larger requests
+// are rejected with 413 Request Entity Too Large. The default is 16MB
+func (h *HTTPAcceptor) SetMaxBodySize(size int64) {
+	h.maxBodySize = size
+}
+
+// SetMaxConns sets how many connections can be open at once, /connect is
+// rejected with 503 Service Unavailable when the limit is reached. The
+// default is 10000 and zero removes the limit
+func (h *HTTPAcceptor) SetMaxConns(max int) {
+	h.maxConns = max
+}
+
+// SetMaxQueueSize sets how many bytes written to a connection can wait for
+// the client to poll them, the connection is closed when they exceed it. The
+// default is 16MB and zero removes the limit
+func (h *HTTPAcceptor) SetMaxQueueSize(size int) {
+	h.maxQueueSize = size
+}
+
+func (h *HTTPAcceptor) hasTLSCertificates() bool {
+	return h.certFile != "" && h.keyFile != ""
+}
+
+// ListenAndServe listens and serve in the specified addr
+func (h *HTTPAcceptor) ListenAndServe() {
+	var listener net.Listener
+	var err error
+	if h.hasTLSCertificates() {
+		var crt tls.Certificate
+		crt, err = tls.LoadX509KeyPair(h.certFile, h.keyFile)
+		if err != nil {
+			logger.Log.Fatalf("Failed to load x509: %s", err.Error())
+		}
+		listener, err = tls.Listen("tcp", h.addr, &tls.Config{Certificates: []tls.Certificate{crt}})
+	} else {
+		listener, err = net.Listen("tcp", h.addr)
+	}
+	if err != nil {
+		logger.Log.Fatalf("Failed to listen: %s", err.Error())
+	}
+	h.listener = listener
+	h.server = &http.Server{
+		Handler:           h.newServeMux(),
+		ReadHeaderTimeout: httpReadHeaderTimeout,
+		ReadTimeout:       httpReadTimeout,
+		IdleTimeout:       httpIdleTimeout,
+	}
+	h.running = true
+	h.serve()
+}
+
+func (h *HTTPAcceptor) newServeMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/connect", h.handleConnect)
+	mux.HandleFunc("/send", h.withConn(h.handleSend))
+	mux.HandleFunc("/poll", h.withConn(h.handlePoll))
+	mux.HandleFunc("/events", h.withConn(h.handleEvents))
+	mux.HandleFunc("/close", h.withConn(h.handleClose))
+	return mux
+}
+
+func (h *HTTPAcceptor) serve() {
+	defer h.Stop()
+
+	go h.expireIdleConns()
+
+	h.server.Serve(h.listener)
+}
+
+// Stop stops the acceptor and closes every connection it holds, since
+// clients can no longer reach them
+func (h *HTTPAcceptor) Stop() {
+	if !h.running {
+		return
+	}
+	h.running = false
+	close(h.chStop)
+	err := h.server.Close()
+	if err != nil {
+		logger.Log.Errorf("Failed to stop: %s", err.Error())
+	}
+
+	h.connsMutex.Lock()
+	conns := make([]*httpPlayerConn, 0, len(h.conns))
+	for _, c := range h.conns {
+		conns = append(conns, c)
+	}
+	h.connsMutex.Unlock()
+	for _, c := range conns {
+		c.Close()
+	}
+}
+
+func (h *HTTPAcceptor) expireIdleConns() {
+	ticker := time.NewTicker(h.heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			deadline := time.Now().Add(-2 * h.heartbeatInterval).UnixNano()
+			h.connsMutex.Lock()
+			expired := make([]*httpPlayerConn, 0)
+			for _, c := range h.conns {
+				if atomic.LoadInt64(&c.lastSeen) < deadline {
+					expired = append(expired, c)
+				}
+			}
+			h.connsMutex.Unlock()
+
+			for _, c := range expired {
+				logger.Log.Debugf("HTTP connection expired, Remote=%s", c.RemoteAddr())
+				c.Close()
+			}
+		case <-h.chStop:
+			return
+		}
+	}
+}
+
+func (h *HTTPAcceptor) removeConn(token string) {
+	h.connsMutex.Lock()
+	defer h.connsMutex.Unlock()
+	delete(h.conns, token)
+}
+
+func (h *HTTPAcceptor) handleConnect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	token, err := newConnectionToken()
+	if err != nil {
+		logger.Log.Errorf("Failed to create HTTP connection token: %s", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	c := newHTTPPlayerConn(token, parseAddr(r.RemoteAddr), h.listener.Addr(), h.maxQueueSize, h.removeConn)
+	h.connsMutex.Lock()
+	if h.maxConns > 0 && len(h.conns) >= h.maxConns {
+		h.connsMutex.Unlock()
+		http.Error(w, "too many connections", http.StatusServiceUnavailable)
+		return
+	}
+	h.conns[token] = c
+	h.connsMutex.Unlock()
+
+	h.connChan <- c
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"token": token})
+}
+
+func (h *HTTPAcceptor) withConn(handler func(http.ResponseWriter, *http.Request, *httpPlayerConn)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.connsMutex.Lock()
+		c, ok := h.conns[r.URL.Query().Get("token")]
+		h.connsMutex.Unlock()
+		if !ok {
+			http.Error(w, "unknown connection token", http.StatusNotFound)
+			return
+		}
+
+		c.touch()
+		handler(w, r, c)
+	}
+}
+
+func (h *HTTPAcceptor) handleSend(w http.ResponseWriter, r *http.Request, c *httpPlayerConn) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.maxBodySize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	reader := bytes.NewReader(body)
+	for {
+		msg, err := readNextMessage(reader, c.limit(h.maxPacketSize))
+		if err == constants.ErrConnectionClosed {
+			break
+		}
+
+		if !c.deliver(msg, err) {
+			http.Error(w, http.StatusText(http.StatusGone), http.StatusGone)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *HTTPAcceptor) handlePoll(w http.ResponseWriter, r *http.Request, c *httpPlayerConn) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if !c.startReading() {
+		http.Error(w, "connection is already being read", http.StatusConflict)
+		return
+	}
+	defer c.stopReading()
+	keepReading(w)
+
+	timer := time.NewTimer(h.heartbeatInterval)
+	defer timer.Stop()
+
+	for {
+		if data := c.take(); len(data) > 0 {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			_, err := w.Write(bytes.Join(data, nil))
+			if err == nil {
+				err = http.NewResponseController(w).Flush()
+			}
+			if err != nil {
+				logger.Log.Debugf("Failed to write HTTP poll response: %s", err.Error())
+				c.requeue(data)
+			}
+			return
+		}
+
+		select {
+		case <-c.notify:
+		case <-timer.C:
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case <-c.die:
+			http.Error(w, http.StatusText(http.StatusGone), http.StatusGone)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (h *HTTPAcceptor) handleEvents(w http.ResponseWriter, r *http.Request, c *httpPlayerConn) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	if !c.startReading() {
+		http.Error(w, "connection is already being read", http.StatusConflict)
+		return
+	}
+	defer c.stopReading()
+	keepReading(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		if data := c.take(); len(data) > 0 {
+			var err error
+			for _, d := range data {
+				if _, err = fmt.Fprintf(w, "data: %s\n\n", base64.StdEncoding.EncodeToString(d)); err != nil {
+					break
+				}
+			}
+			if err == nil {
+				err = http.NewResponseController(w).Flush()
+			}
+			if err != nil {
+				logger.Log.Debugf("Failed to write HTTP events: %s", err.Error())
+				c.requeue(data)
+				return
+			}
+		}
+		flusher.Flush()
+		// an open stream keeps the connection alive, the server heartbeats
+		// guarantee this loop runs at least once per interval
+		c.touch()
+
+		select {
+		case <-c.notify:
+		case <-c.die:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (h *HTTPAcceptor) handleClose(w http.ResponseWriter, r *http.Request, c *httpPlayerConn) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	c.Close()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// keepReading clears the read deadline of the request, which has no body, so
+// the server does not cancel it while it waits for data for the client
+func keepReading(w http.ResponseWriter) {
+	if err := http.NewResponseController(w).SetReadDeadline(time.Time{}); err != nil {
+		logger.Log.Debugf("Failed to clear HTTP read deadline: %s", err.Error())
+	}
+}
+
+func newConnectionToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func parseAddr(addr string) net.Addr {
+	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil {
+		return &net.TCPAddr{}
+	}
+	return tcpAddr
+}
+
+type httpMessage struct {
+	data []byte
+	err  error
+}
+
+// httpPlayerConn is a logical connection made of many http requests
+type httpPlayerConn struct {
+	token      string
+	remoteAddr net.Addr
+	localAddr  net.Addr
+	lastSeen   int64
+	incoming   chan httpMessage
+	reader     bytes.Buffer
+	outgoing   [][]byte
+	queued     int
+	maxQueued  int
+	outMutex   sync.Mutex
+	reading    int32
+	notify     chan struct{}
+	die        chan struct{}
+	closeOnce  sync.Once
+	onClose    func(token string)
+	packetSizeLimit
+}
+
+func newHTTPPlayerConn(token string, remoteAddr, localAddr net.Addr, maxQueued int, onClose func(token string)) *httpPlayerConn {
+	return &httpPlayerConn{
+		token:      token,
+		remoteAddr: remoteAddr,
+		localAddr:  localAddr,
+		maxQueued:  maxQueued,
+		lastSeen:   time.Now().UnixNano(),
+		incoming:   make(chan httpMessage),
+		notify:     make(chan struct{}, 1),
+		die:        make(chan struct{}),
+		onClose:    onClose,
+	}
+}
+
+func (c *httpPlayerConn) touch() {
+	atomic.StoreInt64(&c.lastSeen, time.Now().UnixNano())
+}
+
+// deliver hands a message received from the client to GetNextMessage and
+// returns false if the connection is closed
+func (c *httpPlayerConn) deliver(data []byte, err error) bool {
+	select {
+	case c.incoming <- httpMessage{data: data, err: err}:
+		return true
+	case <-c.die:
+		return false
+	}
+}
+
+// take returns and clears the data written to the client so far
+func (c *httpPlayerConn) take() [][]byte {
+	c.outMutex.Lock()
+	defer c.outMutex.Unlock()
+	data := c.outgoing
+	c.outgoing = nil
+	c.queued = 0
+	return data
+}
+
+// requeue puts back data taken by a request that failed to send it, ahead
+// of the data written since
+func (c *httpPlayerConn) requeue(data [][]byte) {
+	c.outMutex.Lock()
+	c.outgoing = append(data, c.outgoing...)
+	for _, d := range data {
+		c.queued += len(d)
+	}
+	c.outMutex.Unlock()
+
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+}
+
+// startReading returns false if another request is already reading the
+// data written to the client
+func (c *httpPlayerConn) startReading() bool {
+	return atomic.CompareAndSwapInt32(&c.reading, 0, 1)
+}
+
+func (c *httpPlayerConn) stopReading() {
+	atomic.StoreInt32(&c.reading, 0)
+}
+
+// GetNextMessage reads the next message sent by the client
+func (c *httpPlayerConn) GetNextMessage() (b []byte, err error) {
+	select {
+	case m := <-c.incoming:
+		return m.data, m.err
+	case <-c.die:
+		return nil, constants.ErrConnectionClosed
+	}
+}
+
+// Read reads data sent by the client, one message at a time
+func (c *httpPlayerConn) Read(b []byte) (int, error) {
+	if c.reader.Len() == 0 {
+		msg, err := c.GetNextMessage()
+		if err != nil {
+			return 0, err
+		}
+		c.reader.Write(msg)
+	}
+	return c.reader.Read(b)
+}
+
+// Write queues data until the client polls for it, closing the connection
+// if the client let too much data queue up
+func (c *httpPlayerConn) Write(b []byte) (int, error) {
+	select {
+	case <-c.die:
+		return 0, net.ErrClosed
+	default:
+	}
+
+	data := make([]byte, len(b))
+	copy(data, b)
+
+	c.outMutex.Lock()
+	if c.maxQueued > 0 && c.queued+len(data) > c.maxQueued {
+		c.outMutex.Unlock()
+		c.Close()
+		return 0, constants.ErrOutgoingQueueFull
+	}
+	c.outgoing = append(c.outgoing, data)
+	c.queued += len(data)
+	c.outMutex.Unlock()
+
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+	return len(b), nil
+}
+
+// Close closes the connection, pending and future requests with its token fail
+func (c *httpPlayerConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.die)
+		c.onClose(c.token)
+	})
+	return nil
+}
+
+// LocalAddr returns the local network address.
+func (c *httpPlayerConn) LocalAddr() net.Addr {
+	return c.localAddr
+}
+
+// RemoteAddr returns the address of the request that started the connection
+func (c *httpPlayerConn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+// SetDeadline is not supported, idle connections are expired by the acceptor
+func (c *httpPlayerConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+// SetReadDeadline is not supported, idle connections are expired by the acceptor
+func (c *httpPlayerConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+// SetWriteDeadline is not supported, idle connections are expired by the acceptor
+func (c *httpPlayerConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
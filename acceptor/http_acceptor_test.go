@@ -0,0 +1,325 @@
+// Copyright (c) TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package acceptor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topfreegames/pitaya/v2/conn/packet"
+	"github.com/topfreegames/pitaya/v2/constants"
+	"github.com/topfreegames/pitaya/v2/helpers"
+)
+
+func mustStartHTTPAcceptor(t *testing.T, heartbeat time.Duration) *HTTPAcceptor {
+	t.Helper()
+	h := NewHTTPAcceptor("127.0.0.1:0", heartbeat)
+	go h.ListenAndServe()
+	helpers.ShouldEventuallyReturn(t, func() bool {
+		return h.GetAddr() != ""
+	}, true, 10*time.Millisecond, 100*time.Millisecond)
+	return h
+}
+
+func mustConnectHTTP(t *testing.T, h *HTTPAcceptor) (string, PlayerConn) {
+	t.Helper()
+	tokenChan := make(chan string)
+	go func() {
+		res, err := http.Post(fmt.Sprintf("http://%s/connect", h.GetAddr()), "", nil)
+		assert.NoError(t, err)
+		defer res.Body.Close()
+		body := map[string]string{}
+		assert.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+		tokenChan <- body["token"]
+	}()
+	conn := helpers.ShouldEventuallyReceive(t, h.GetConnChan(), 100*time.Millisecond).(PlayerConn)
+	token := helpers.ShouldEventuallyReceive(t, tokenChan, 100*time.Millisecond).(string)
+	return token, conn
+}
+
+func httpURL(h *HTTPAcceptor, path, token string) string {
+	return fmt.Sprintf("http://%s/%s?token=%s", h.GetAddr(), path, token)
+}
+
+func TestNewHTTPAcceptor(t *testing.T) {
+	t.Parallel()
+	h := NewHTTPAcceptor("127.0.0.1:0", time.Second, "./fixtures/server.crt", "./fixtures/server.key")
+	assert.Equal(t, "./fixtures/server.crt", h.certFile)
+	assert.Equal(t, "./fixtures/server.key", h.keyFile)
+	assert.NotNil(t, h.GetConnChan())
+	assert.Equal(t, "", h.GetAddr())
+
+	assert.PanicsWithValue(t, constants.ErrInvalidCertificates, func() {
+		NewHTTPAcceptor("127.0.0.1:0", time.Second, "wqodij")
+	})
+}
+
+func TestHTTPAcceptorConnect(t *testing.T) {
+	h := mustStartHTTPAcceptor(t, time.Second)
+	defer h.Stop()
+
+	token, conn := mustConnectHTTP(t, h)
+	assert.Len(t, token, 32)
+	assert.NotEmpty(t, conn.RemoteAddr().String())
+}
+
+func TestHTTPAcceptorUnknownToken(t *testing.T) {
+	h := mustStartHTTPAcceptor(t, time.Second)
+	defer h.Stop()
+
+	res, err := http.Post(httpURL(h, "send", "unknown"), "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func TestHTTPAcceptorSend(t *testing.T) {
+	tables := []struct {
+		name     string
+		data     []byte
+		messages [][]byte
+		err      error
+		status   int
+	}{
+		{"one_message", []byte{0x02, 0x00, 0x00, 0x01, 0x00}, [][]byte{{0x02, 0x00, 0x00, 0x01, 0x00}}, nil, http.StatusNoContent},
+		{"two_messages", []byte{0x01, 0x00, 0x00, 0x01, 0x02, 0x02, 0x00, 0x00, 0x02, 0x01, 0x01}, [][]byte{{0x01, 0x00, 0x00, 0x01, 0x02}, {0x02, 0x00, 0x00, 0x02, 0x01, 0x01}}, nil, http.StatusNoContent},
+		{"invalid_header", []byte{0x00, 0x00, 0x00, 0x00}, nil, packet.ErrWrongPomeloPacketType, http.StatusBadRequest},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			h := mustStartHTTPAcceptor(t, time.Second)
+			defer h.Stop()
+			token, conn := mustConnectHTTP(t, h)
+
+			statusChan := make(chan int)
+			go func() {
+				res, err := http.Post(httpURL(h, "send", token), "application/octet-stream", bytes.NewReader(table.data))
+				assert.NoError(t, err)
+				statusChan <- res.StatusCode
+			}()
+
+			for _, expected := range table.messages {
+				msg, err := conn.GetNextMessage()
+				assert.NoError(t, err)
+				assert.Equal(t, expected, msg)
+			}
+			if table.err != nil {
+				_, err := conn.GetNextMessage()
+				assert.EqualError(t, err, table.err.Error())
+			}
+			assert.Equal(t, table.status, helpers.ShouldEventuallyReceive(t, statusChan, 100*time.Millisecond))
+		})
+	}
+}
+
+func TestHTTPAcceptorPoll(t *testing.T) {
+	h := mustStartHTTPAcceptor(t, 200*time.Millisecond)
+	defer h.Stop()
+	token, conn := mustConnectHTTP(t, h)
+
+	// no data written, poll should time out
+	res, err := http.Get(httpURL(h, "poll", token))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+
+	msg1 := []byte{0x02, 0x00, 0x00, 0x01, 0x00}
+	msg2 := []byte{0x04, 0x00, 0x00, 0x01, 0x05}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		conn.Write(msg1)
+		conn.Write(msg2)
+	}()
+
+	received := []byte{}
+	for len(received) < len(msg1)+len(msg2) {
+		res, err = http.Get(httpURL(h, "poll", token))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		body, err := io.ReadAll(res.Body)
+		assert.NoError(t, err)
+		received = append(received, body...)
+	}
+	assert.Equal(t, append(msg1, msg2...), received)
+}
+
+func TestHTTPAcceptorEvents(t *testing.T) {
+	h := mustStartHTTPAcceptor(t, time.Second)
+	defer h.Stop()
+	token, conn := mustConnectHTTP(t, h)
+
+	res, err := http.Get(httpURL(h, "events", token))
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+	msg := []byte{0x04, 0x00, 0x00, 0x01, 0x05}
+	_, err = conn.Write(msg)
+	assert.NoError(t, err)
+
+	reader := bufio.NewReader(res.Body)
+	line, err := reader.ReadString('\n')
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(line, "data: "))
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(strings.TrimPrefix(line, "data: ")))
+	assert.NoError(t, err)
+	assert.Equal(t, msg, data)
+}
+
+func TestHTTPAcceptorClose(t *testing.T) {
+	h := mustStartHTTPAcceptor(t, time.Second)
+	defer h.Stop()
+	token, conn := mustConnectHTTP(t, h)
+
+	res, err := http.Post(httpURL(h, "close", token), "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+
+	_, err = conn.GetNextMessage()
+	assert.EqualError(t, err, constants.ErrConnectionClosed.Error())
+
+	res, err = http.Get(httpURL(h, "poll", token))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func TestHTTPAcceptorExpiresIdleConns(t *testing.T) {
+	h := mustStartHTTPAcceptor(t, 50*time.Millisecond)
+	defer h.Stop()
+	_, conn := mustConnectHTTP(t, h)
+
+	errChan := make(chan error)
+	go func() {
+		_, err := conn.GetNextMessage()
+		errChan <- err
+	}()
+	err := helpers.ShouldEventuallyReceive(t, errChan, 500*time.Millisecond)
+	assert.Equal(t, constants.ErrConnectionClosed, err)
+}
+
+func TestHTTPAcceptorSendTooLarge(t *testing.T) {
+	h := mustStartHTTPAcceptor(t, time.Second)
+	defer h.Stop()
+	h.SetMaxBodySize(4)
+	token, _ := mustConnectHTTP(t, h)
+
+	res, err := http.Post(httpURL(h, "send", token), "application/octet-stream", bytes.NewReader([]byte{0x02, 0x00, 0x00, 0x01, 0x00}))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+}
+
+func TestHTTPAcceptorMaxConns(t *testing.T) {
+	h := mustStartHTTPAcceptor(t, time.Second)
+	defer h.Stop()
+	h.SetMaxConns(1)
+	mustConnectHTTP(t, h)
+
+	res, err := http.Post(fmt.Sprintf("http://%s/connect", h.GetAddr()), "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+}
+
+func TestHTTPAcceptorConcurrentPoll(t *testing.T) {
+	h := mustStartHTTPAcceptor(t, 200*time.Millisecond)
+	defer h.Stop()
+	token, conn := mustConnectHTTP(t, h)
+
+	statusChan := make(chan int)
+	go func() {
+		res, err := http.Get(httpURL(h, "poll", token))
+		assert.NoError(t, err)
+		statusChan <- res.StatusCode
+	}()
+	helpers.ShouldEventuallyReturn(t, func() bool {
+		return atomic.LoadInt32(&conn.(*httpPlayerConn).reading) == 1
+	}, true, 5*time.Millisecond, 100*time.Millisecond)
+
+	res, err := http.Get(httpURL(h, "poll", token))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, res.StatusCode)
+	res, err = http.Get(httpURL(h, "events", token))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, res.StatusCode)
+
+	assert.Equal(t, http.StatusNoContent, helpers.ShouldEventuallyReceive(t, statusChan, time.Second))
+}
+
+func TestHTTPPlayerConnRequeue(t *testing.T) {
+	t.Parallel()
+	c := newHTTPPlayerConn("token", nil, nil, 0, func(string) {})
+	msg1 := []byte{0x04, 0x00, 0x00, 0x01, 0x01}
+	msg2 := []byte{0x04, 0x00, 0x00, 0x01, 0x02}
+
+	c.Write(msg1)
+	data := c.take()
+	c.Write(msg2)
+	c.requeue(data)
+	assert.Equal(t, [][]byte{msg1, msg2}, c.take())
+}
+
+func TestHTTPPlayerConnMaxQueueSize(t *testing.T) {
+	t.Parallel()
+	closed := false
+	c := newHTTPPlayerConn("token", nil, nil, 8, func(string) { closed = true })
+	msg := []byte{0x04, 0x00, 0x00, 0x01, 0x01}
+
+	_, err := c.Write(msg)
+	assert.NoError(t, err)
+	_, err = c.Write(msg)
+	assert.Equal(t, constants.ErrOutgoingQueueFull, err)
+	assert.True(t, closed)
+	_, err = c.Write(msg)
+	assert.Equal(t, net.ErrClosed, err)
+}
+
+func TestHTTPPlayerConnTakeFreesQueue(t *testing.T) {
+	t.Parallel()
+	c := newHTTPPlayerConn("token", nil, nil, 8, func(string) {})
+	msg := []byte{0x04, 0x00, 0x00, 0x01, 0x01}
+
+	for i := 0; i < 3; i++ {
+		_, err := c.Write(msg)
+		assert.NoError(t, err)
+		assert.Equal(t, [][]byte{msg}, c.take())
+	}
+}
+
+func TestHTTPAcceptorPollMethods(t *testing.T) {
+	h := mustStartHTTPAcceptor(t, time.Second)
+	defer h.Stop()
+	token, _ := mustConnectHTTP(t, h)
+
+	for _, path := range []string{"poll", "events"} {
+		res, err := http.Post(httpURL(h, path, token), "", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusMethodNotAllowed, res.StatusCode)
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright (c) TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package acceptor
+
+import (
+	"net"
+
+	"github.com/topfreegames/pitaya/v2/config"
+	"github.com/topfreegames/pitaya/v2/logger"
+	"github.com/xtaci/kcp-go/v5"
+)
+
+// KCPAcceptor accepts connections using KCP, a reliable protocol over UDP
+// that avoids TCP head-of-line blocking on lossy networks
+type KCPAcceptor struct {
+	addr     string
+	connChan chan PlayerConn
+	listener *kcp.Listener
+	running  bool
+	config   config.KCPAcceptorConfig
+
+	maxPacketSize int
+}
+
+// NewKCPAcceptor creates a new instance of kcp acceptor
+func NewKCPAcceptor(addr string, c config.KCPAcceptorConfig) *KCPAcceptor {
+	return &KCPAcceptor{
+		addr:     addr,
+		connChan: make(chan PlayerConn),
+		running:  false,
+		config:   c,
+	}
+}
+
+// DialKCP connects to a KCP acceptor listening on addr. The same config
+// must be used on both ends, otherwise FEC shards will not match.
+func DialKCP(addr string, c config.KCPAcceptorConfig) (net.Conn, error) {
+	sess, err := kcp.DialWithOptions(addr, nil, c.DataShards, c.ParityShards)
+	if err != nil {
+		return nil, err
+	}
+	configureKCPSession(sess, c)
+	return sess, nil
+}
+
+func configureKCPSession(sess *kcp.UDPSession, c config.KCPAcceptorConfig) {
+	noDelay := 0
+	if c.NoDelay {
+		noDelay = 1
+	}
+	noCongestion := 0
+	if c.NoCongestion {
+		noCongestion = 1
+	}
+
+	// pitaya packets are framed by their own header, so the session
+	// must behave as a byte stream just like a tcp connection
+	sess.SetStreamMode(true)
+	sess.SetNoDelay(noDelay, int(c.Interval.Milliseconds()), c.Resend, noCongestion)
+	sess.SetWindowSize(c.SendWindow, c.ReceiveWindow)
+	sess.SetMtu(c.MTU)
+	sess.SetACKNoDelay(c.NoDelay)
+}
+
+// GetAddr returns the addr the acceptor will listen on
+func (a *KCPAcceptor) GetAddr() string {
+	if a.listener != nil {
+		return a.listener.Addr().String()
+	}
+	return ""
+}
+
+// GetConnChan gets a connection channel
+func (a *KCPAcceptor) GetConnChan() chan PlayerConn {
+	return a.connChan
+}
+
+// Stop stops the acceptor
+func (a *KCPAcceptor) Stop() {
+	a.running = false
+	a.listener.Close()
+}
+
+// ListenAndServe using kcp acceptor
+func (a *KCPAcceptor) ListenAndServe() {
+	listener, err := kcp.ListenWithOptions(a.addr, nil, a.config.DataShards, a.config.ParityShards)
+	if err != nil {
+		logger.Log.Fatalf("Failed to listen: %s", err.Error())
+	}
+	a.listener = listener
+	a.running = true
+	a.serve()
+}
+
+// EnableProxyProtocol is a no-op, PROXY protocol is not available over UDP
+func (a *KCPAcceptor) EnableProxyProtocol() {
+}
+
+// SetMaxPacketSize makes the acceptor close the connections that send
+// packets larger than size bytes, which are rejected from their header
+// before being read. Zero keeps the 16MB limit of the pomelo protocol, a
+// larger size allows clients to send larger length prefixed packets
+func (a *KCPAcceptor) SetMaxPacketSize(size int) {
+	a.maxPacketSize = size
+}
+
+func (a *KCPAcceptor) serve() {
+	defer a.Stop()
+	for a.running {
+		sess, err := a.listener.AcceptKCP()
+		if err != nil {
+			logger.Log.Errorf("Failed to accept KCP connection: %s", err.Error())
+			continue
+		}
+		configureKCPSession(sess, a.config)
+
+		a.connChan <- &tcpPlayerConn{
+			Conn:          sess,
+			remoteAddr:    sess.RemoteAddr(),
+			maxPacketSize: a.maxPacketSize,
+		}
+	}
+}
+
+// IsRunning returns if the acceptor is running
+func (a *KCPAcceptor) IsRunning() bool {
+	return a.running
+}
+
+// GetConfiguredAddress returns the addr the acceptor was configured with
+func (a *KCPAcceptor) GetConfiguredAddress() string {
+	return a.addr
+}
@@ -0,0 +1,149 @@
+// Copyright (c) TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package acceptor
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topfreegames/pitaya/v2/config"
+	"github.com/topfreegames/pitaya/v2/conn/packet"
+	"github.com/topfreegames/pitaya/v2/helpers"
+)
+
+func mustStartKCPAcceptor(t *testing.T, c config.KCPAcceptorConfig) *KCPAcceptor {
+	t.Helper()
+	a := NewKCPAcceptor("127.0.0.1:0", c)
+	go a.ListenAndServe()
+	helpers.ShouldEventuallyReturn(t, func() bool {
+		return a.GetAddr() != ""
+	}, true, 10*time.Millisecond, 100*time.Millisecond)
+	return a
+}
+
+func TestNewKCPAcceptor(t *testing.T) {
+	t.Parallel()
+	c := *config.NewDefaultKCPAcceptorConfig()
+	a := NewKCPAcceptor("127.0.0.1:0", c)
+	assert.NotNil(t, a.GetConnChan())
+	assert.Equal(t, "", a.GetAddr())
+	assert.Equal(t, "127.0.0.1:0", a.GetConfiguredAddress())
+	assert.False(t, a.IsRunning())
+}
+
+func TestKCPAcceptorListenAndServe(t *testing.T) {
+	tables := []struct {
+		name         string
+		dataShards   int
+		parityShards int
+	}{
+		{"without_fec", 0, 0},
+		{"with_fec", 10, 3},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			c := *config.NewDefaultKCPAcceptorConfig()
+			c.DataShards = table.dataShards
+			c.ParityShards = table.parityShards
+			a := mustStartKCPAcceptor(t, c)
+			defer a.Stop()
+			assert.True(t, a.IsRunning())
+
+			conn, err := DialKCP(a.GetAddr(), c)
+			assert.NoError(t, err)
+			defer conn.Close()
+
+			// kcp sessions are only accepted after the first segment arrives
+			data := []byte{0x02, 0x00, 0x00, 0x01, 0x00}
+			_, err = conn.Write(data)
+			assert.NoError(t, err)
+
+			playerConn := helpers.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(PlayerConn)
+			assert.IsType(t, &net.UDPAddr{}, playerConn.RemoteAddr())
+
+			msg, err := playerConn.GetNextMessage()
+			assert.NoError(t, err)
+			assert.Equal(t, data, msg)
+		})
+	}
+}
+
+func TestKCPAcceptorGetNextMessage(t *testing.T) {
+	tables := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"invalid_header", []byte{0x00, 0x00, 0x00, 0x00}, packet.ErrWrongPomeloPacketType},
+		{"valid_message", []byte{0x02, 0x00, 0x00, 0x01, 0x00}, nil},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			c := *config.NewDefaultKCPAcceptorConfig()
+			a := mustStartKCPAcceptor(t, c)
+			defer a.Stop()
+
+			conn, err := DialKCP(a.GetAddr(), c)
+			assert.NoError(t, err)
+			defer conn.Close()
+
+			_, err = conn.Write(table.data)
+			assert.NoError(t, err)
+
+			playerConn := helpers.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(PlayerConn)
+			msg, err := playerConn.GetNextMessage()
+			if table.err != nil {
+				assert.EqualError(t, err, table.err.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, table.data, msg)
+			}
+		})
+	}
+}
+
+func TestKCPAcceptorGetNextMessageTwoMessagesInBuffer(t *testing.T) {
+	c := *config.NewDefaultKCPAcceptorConfig()
+	a := mustStartKCPAcceptor(t, c)
+	defer a.Stop()
+
+	conn, err := DialKCP(a.GetAddr(), c)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	msg1 := []byte{0x01, 0x00, 0x00, 0x01, 0x02}
+	msg2 := []byte{0x02, 0x00, 0x00, 0x02, 0x01, 0x01}
+	_, err = conn.Write(append(msg1, msg2...))
+	assert.NoError(t, err)
+
+	playerConn := helpers.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(PlayerConn)
+	msg, err := playerConn.GetNextMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, msg1, msg)
+
+	msg, err = playerConn.GetNextMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, msg2, msg)
+}
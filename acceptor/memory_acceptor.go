@@ -0,0 +1,151 @@
+// Copyright (c) TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package acceptor
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/topfreegames/pitaya/v2/constants"
+)
+
+// MemoryAcceptor accepts in-process connections created with Dial, which
+// is useful for running full client flows in tests without binding ports.
+// The connections are synchronous pipes, so a write only returns when the
+// other side reads it
+type MemoryAcceptor struct {
+	name      string
+	connChan  chan PlayerConn
+	running   bool
+	mutex     sync.RWMutex
+	chStop    chan struct{}
+	stopOnce  sync.Once
+	connCount int64
+}
+
+// NewMemoryAcceptor creates a new instance of memory acceptor, name is used
+// as its address
+func NewMemoryAcceptor(name string) *MemoryAcceptor {
+	return &MemoryAcceptor{
+		name:     name,
+		connChan: make(chan PlayerConn),
+		running:  false,
+		chStop:   make(chan struct{}),
+	}
+}
+
+// memoryAddr is the address of the memory connections, the client side
+// is identified by the order in which it was dialed
+type memoryAddr string
+
+func (a memoryAddr) Network() string {
+	return "memory"
+}
+
+func (a memoryAddr) String() string {
+	return string(a)
+}
+
+// Dial creates a connection to the acceptor, it blocks until the
+// connection is taken from the conn chan or the acceptor is stopped
+func (a *MemoryAcceptor) Dial() (net.Conn, error) {
+	id := atomic.AddInt64(&a.connCount, 1)
+	clientAddr := memoryAddr(fmt.Sprintf("%s:%d", a.name, id))
+	serverAddr := memoryAddr(a.name)
+
+	clientConn, serverConn := net.Pipe()
+	playerConn := &tcpPlayerConn{
+		Conn:       &memoryConn{Conn: serverConn, localAddr: serverAddr, remoteAddr: clientAddr},
+		remoteAddr: clientAddr,
+	}
+	select {
+	case a.connChan <- playerConn:
+		return &memoryConn{Conn: clientConn, localAddr: clientAddr, remoteAddr: serverAddr}, nil
+	case <-a.chStop:
+		clientConn.Close()
+		serverConn.Close()
+		return nil, constants.ErrAcceptorStopped
+	}
+}
+
+// GetAddr returns the name of the acceptor when it is running
+func (a *MemoryAcceptor) GetAddr() string {
+	if a.IsRunning() {
+		return a.name
+	}
+	return ""
+}
+
+// GetConnChan gets a connection channel
+func (a *MemoryAcceptor) GetConnChan() chan PlayerConn {
+	return a.connChan
+}
+
+// ListenAndServe marks the acceptor as running and blocks until it is stopped
+func (a *MemoryAcceptor) ListenAndServe() {
+	a.mutex.Lock()
+	a.running = true
+	a.mutex.Unlock()
+	<-a.chStop
+}
+
+// Stop stops the acceptor, the established connections are kept open
+func (a *MemoryAcceptor) Stop() {
+	a.stopOnce.Do(func() {
+		a.mutex.Lock()
+		a.running = false
+		a.mutex.Unlock()
+		close(a.chStop)
+	})
+}
+
+// EnableProxyProtocol is a no-op, memory connections have no proxy in between
+func (a *MemoryAcceptor) EnableProxyProtocol() {
+}
+
+// IsRunning returns if the acceptor is running
+func (a *MemoryAcceptor) IsRunning() bool {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	return a.running
+}
+
+// GetConfiguredAddress returns the name of the acceptor
+func (a *MemoryAcceptor) GetConfiguredAddress() string {
+	return a.name
+}
+
+// memoryConn replaces the addresses of the pipe connections
+type memoryConn struct {
+	net.Conn
+	localAddr  net.Addr
+	remoteAddr net.Addr
+}
+
+func (c *memoryConn) LocalAddr() net.Addr {
+	return c.localAddr
+}
+
+func (c *memoryConn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
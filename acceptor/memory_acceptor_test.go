@@ -0,0 +1,119 @@
+// Copyright (c) TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package acceptor
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topfreegames/pitaya/v2/constants"
+	"github.com/topfreegames/pitaya/v2/helpers"
+)
+
+func mustDialMemory(t *testing.T, a *MemoryAcceptor) (net.Conn, PlayerConn) {
+	t.Helper()
+	connChan := make(chan net.Conn)
+	go func() {
+		conn, err := a.Dial()
+		assert.NoError(t, err)
+		connChan <- conn
+	}()
+	playerConn := helpers.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(PlayerConn)
+	conn := helpers.ShouldEventuallyReceive(t, connChan, 100*time.Millisecond).(net.Conn)
+	return conn, playerConn
+}
+
+func TestNewMemoryAcceptor(t *testing.T) {
+	t.Parallel()
+	a := NewMemoryAcceptor("test")
+	assert.NotNil(t, a.GetConnChan())
+	assert.Equal(t, "", a.GetAddr())
+	assert.Equal(t, "test", a.GetConfiguredAddress())
+	assert.False(t, a.IsRunning())
+}
+
+func TestMemoryAcceptorListenAndServe(t *testing.T) {
+	t.Parallel()
+	a := NewMemoryAcceptor("test")
+	go a.ListenAndServe()
+	helpers.ShouldEventuallyReturn(t, func() bool {
+		return a.IsRunning()
+	}, true, 10*time.Millisecond, 100*time.Millisecond)
+	assert.Equal(t, "test", a.GetAddr())
+
+	a.Stop()
+	assert.False(t, a.IsRunning())
+	assert.NotPanics(t, a.Stop)
+
+	_, err := a.Dial()
+	assert.Equal(t, constants.ErrAcceptorStopped, err)
+}
+
+func TestMemoryAcceptorDial(t *testing.T) {
+	t.Parallel()
+	a := NewMemoryAcceptor("test")
+	defer a.Stop()
+
+	conn1, playerConn1 := mustDialMemory(t, a)
+	defer conn1.Close()
+	conn2, playerConn2 := mustDialMemory(t, a)
+	defer conn2.Close()
+
+	assert.Equal(t, "memory", playerConn1.RemoteAddr().Network())
+	assert.Equal(t, "test:1", playerConn1.RemoteAddr().String())
+	assert.Equal(t, "test:2", playerConn2.RemoteAddr().String())
+	assert.Equal(t, "test", conn1.RemoteAddr().String())
+	assert.Equal(t, "test:1", conn1.LocalAddr().String())
+}
+
+func TestMemoryAcceptorGetNextMessage(t *testing.T) {
+	t.Parallel()
+	a := NewMemoryAcceptor("test")
+	defer a.Stop()
+	conn, playerConn := mustDialMemory(t, a)
+
+	msg1 := []byte{0x01, 0x00, 0x00, 0x01, 0x02}
+	msg2 := []byte{0x04, 0x00, 0x00, 0x02, 0x05, 0x04}
+	go func() {
+		conn.Write(append(msg1, msg2...))
+	}()
+
+	msg, err := playerConn.GetNextMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, msg1, msg)
+	msg, err = playerConn.GetNextMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, msg2, msg)
+
+	go func() {
+		playerConn.Write(msg1)
+	}()
+	b := make([]byte, len(msg1))
+	_, err = conn.Read(b)
+	assert.NoError(t, err)
+	assert.Equal(t, msg1, b)
+
+	conn.Close()
+	_, err = playerConn.GetNextMessage()
+	assert.Equal(t, constants.ErrConnectionClosed, err)
+}
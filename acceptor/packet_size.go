@@ -0,0 +1,76 @@
+// Copyright (c) TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package acceptor
+
+import (
+	"sync/atomic"
+
+	"github.com/topfreegames/pitaya/v2/conn/codec"
+)
+
+// PacketSizeLimitConn is implemented by the player conns that can lower the
+// size limit of their packets, which are rejected from their header before
+// being read
+type PacketSizeLimitConn interface {
+	// SetMaxPacketSize sets the largest packet read from the connection, it
+	// never raises the limit of the acceptor and zero restores it
+	SetMaxPacketSize(size int)
+}
+
+// LimitPacketSize sets the largest packet read from conn, or from the conn
+// it wraps, and returns false if none of them supports it
+func LimitPacketSize(conn PlayerConn, size int) bool {
+	for {
+		if c, ok := conn.(PacketSizeLimitConn); ok {
+			c.SetMaxPacketSize(size)
+			return true
+		}
+		w, ok := conn.(WrappedConn)
+		if !ok {
+			return false
+		}
+		conn = w.Unwrap()
+	}
+}
+
+// packetSizeLimit is the limit set with SetMaxPacketSize, it is atomic since
+// some player conns read packets in a goroutine of their own
+type packetSizeLimit struct {
+	size int64
+}
+
+// SetMaxPacketSize sets the largest packet read from the connection, it
+// never raises the limit of the acceptor and zero restores it
+func (l *packetSizeLimit) SetMaxPacketSize(size int) {
+	atomic.StoreInt64(&l.size, int64(size))
+}
+
+// limit returns the tighter of the set limit and maxPacketSize, the limit
+// of the acceptor
+func (l *packetSizeLimit) limit(maxPacketSize int) int {
+	if maxPacketSize <= 0 {
+		maxPacketSize = codec.MaxPacketSize
+	}
+	if size := int(atomic.LoadInt64(&l.size)); size > 0 && size < maxPacketSize {
+		return size
+	}
+	return maxPacketSize
+}
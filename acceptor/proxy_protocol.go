@@ -0,0 +1,208 @@
+// Copyright (c) TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package acceptor
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/mailgun/proxyproto"
+)
+
+// PROXY protocol v2 TLV types, as defined by the specification at
+// https://www.haproxy.org/download/2.8/doc/proxy-protocol.txt and by AWS
+const (
+	ProxyTLVTypeALPN      byte = 0x01
+	ProxyTLVTypeAuthority byte = 0x02
+	ProxyTLVTypeUniqueID  byte = 0x05
+	ProxyTLVTypeSSL       byte = 0x20
+	ProxyTLVTypeAWS       byte = 0xEA
+)
+
+const (
+	proxyTLVSubtypeSSLVersion         byte = 0x21
+	proxyTLVSubtypeSSLCN              byte = 0x22
+	proxyTLVSubtypeSSLCipher          byte = 0x23
+	proxyTLVSubtypeAWSVPCEndpointID   byte = 0x01
+	proxyTLVHeaderLength                   = 3
+	proxyTLVSSLHeaderLength                = 5
+	proxyTLVAWSVPCEndpointIDMinLength      = 1
+)
+
+// ProxyTLVs are the TLVs sent in a PROXY protocol v2 header, by type
+type ProxyTLVs map[byte][]byte
+
+// Metadata returns the TLVs as strings keyed by name, the ones not known by
+// pitaya are keyed by their hex type and have their values hex encoded
+func (t ProxyTLVs) Metadata() map[string]string {
+	metadata := map[string]string{}
+	for typ, value := range t {
+		switch typ {
+		case ProxyTLVTypeALPN:
+			metadata["alpn"] = string(value)
+		case ProxyTLVTypeAuthority:
+			// the authority is the host name sent by the client, usually the TLS SNI
+			metadata["authority"] = string(value)
+		case ProxyTLVTypeUniqueID:
+			metadata["unique_id"] = hex.EncodeToString(value)
+		case ProxyTLVTypeSSL:
+			addSSLMetadata(metadata, value)
+		case ProxyTLVTypeAWS:
+			if len(value) > proxyTLVAWSVPCEndpointIDMinLength && value[0] == proxyTLVSubtypeAWSVPCEndpointID {
+				metadata["aws_vpce_id"] = string(value[1:])
+			}
+		default:
+			metadata[fmt.Sprintf("0x%02x", typ)] = hex.EncodeToString(value)
+		}
+	}
+	return metadata
+}
+
+// addSSLMetadata adds the sub TLVs of the SSL TLV, which come after one
+// byte of client flags and four bytes of verification result
+func addSSLMetadata(metadata map[string]string, value []byte) {
+	if len(value) < proxyTLVSSLHeaderLength {
+		return
+	}
+	subTLVs, err := parseProxyTLVs(value[proxyTLVSSLHeaderLength:])
+	if err != nil {
+		return
+	}
+	if v, ok := subTLVs[proxyTLVSubtypeSSLVersion]; ok {
+		metadata["ssl_version"] = string(v)
+	}
+	if v, ok := subTLVs[proxyTLVSubtypeSSLCN]; ok {
+		metadata["ssl_cn"] = string(v)
+	}
+	if v, ok := subTLVs[proxyTLVSubtypeSSLCipher]; ok {
+		metadata["ssl_cipher"] = string(v)
+	}
+}
+
+// ProxyProtocolConn is implemented by the player conns that can have been
+// accepted with PROXY protocol
+type ProxyProtocolConn interface {
+	// ProxyTLVs returns the TLVs sent in the PROXY protocol header, it is
+	// empty if PROXY protocol is disabled or the header had no TLVs
+	ProxyTLVs() ProxyTLVs
+}
+
+// GetProxyTLVs returns the PROXY protocol TLVs of conn, or nil if conn does
+// not support PROXY protocol
+func GetProxyTLVs(conn PlayerConn) ProxyTLVs {
+	if c, ok := conn.(ProxyProtocolConn); ok {
+		return c.ProxyTLVs()
+	}
+	return nil
+}
+
+// parseProxyTLVs parses the raw TLVs of a PROXY protocol header. The
+// proxyproto ParseTLVs is not used since it miscomputes the offset of the
+// TLVs after the first one
+func parseProxyTLVs(raw []byte) (ProxyTLVs, error) {
+	tlvs := ProxyTLVs{}
+	for offset := 0; offset < len(raw); {
+		if offset+proxyTLVHeaderLength > len(raw) {
+			return nil, fmt.Errorf("truncated TLV header at offset %d", offset)
+		}
+		typ := raw[offset]
+		begin := offset + proxyTLVHeaderLength
+		end := begin + int(binary.BigEndian.Uint16(raw[offset+1:begin]))
+		if end > len(raw) {
+			return nil, fmt.Errorf("TLV 0x%02x is larger than the header", typ)
+		}
+		tlvs[typ] = raw[begin:end]
+		offset = end
+	}
+	return tlvs, nil
+}
+
+// readProxyHeader returns the address of the client and the TLVs sent by
+// the proxy, which are read from the PROXY protocol header when it is enabled
+func readProxyHeader(conn net.Conn, proxyProtocol bool) (net.Addr, ProxyTLVs, error) {
+	if !proxyProtocol {
+		return conn.RemoteAddr(), nil, nil
+	}
+	h, err := proxyproto.ReadHeader(conn)
+	if err != nil {
+		return nil, nil, err
+	}
+	tlvs, err := parseProxyTLVs(h.RawTLVs)
+	if err != nil {
+		return nil, nil, err
+	}
+	return h.Source, tlvs, nil
+}
+
+// proxyProtocolListener reads the PROXY protocol header of the accepted
+// connections, which is done on their first use instead of on Accept so
+// that a slow client does not block the other ones from being accepted
+type proxyProtocolListener struct {
+	net.Listener
+}
+
+func (l *proxyProtocolListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &proxyProtocolConn{Conn: conn}, nil
+}
+
+type proxyProtocolConn struct {
+	net.Conn
+	once       sync.Once
+	remoteAddr net.Addr
+	tlvs       ProxyTLVs
+	err        error
+}
+
+func (c *proxyProtocolConn) readHeader() error {
+	c.once.Do(func() {
+		c.remoteAddr, c.tlvs, c.err = readProxyHeader(c.Conn, true)
+		if c.err == nil && c.remoteAddr == nil {
+			c.err = fmt.Errorf("PROXY header without source address")
+		}
+	})
+	return c.err
+}
+
+func (c *proxyProtocolConn) Read(b []byte) (int, error) {
+	if err := c.readHeader(); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	if err := c.readHeader(); err != nil {
+		return c.Conn.RemoteAddr()
+	}
+	return c.remoteAddr
+}
+
+func (c *proxyProtocolConn) ProxyTLVs() ProxyTLVs {
+	c.readHeader()
+	return c.tlvs
+}
@@ -0,0 +1,183 @@
+// Copyright (c) TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package acceptor
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/topfreegames/pitaya/v2/helpers"
+)
+
+func proxyTLV(typ byte, value []byte) []byte {
+	tlv := []byte{typ, 0, 0}
+	binary.BigEndian.PutUint16(tlv[1:], uint16(len(value)))
+	return append(tlv, value...)
+}
+
+// proxyV2Header builds a PROXY protocol v2 header for a TCP4 connection
+// from 10.1.2.3:4321 to 10.3.2.1:1234 followed by the given TLVs
+func proxyV2Header(tlvs ...[]byte) []byte {
+	addrs := []byte{10, 1, 2, 3, 10, 3, 2, 1, 0x10, 0xe1, 0x04, 0xd2}
+	for _, tlv := range tlvs {
+		addrs = append(addrs, tlv...)
+	}
+	header := append([]byte("\r\n\r\n\x00\r\nQUIT\n"), 0x21, 0x11, 0, 0)
+	binary.BigEndian.PutUint16(header[14:], uint16(len(addrs)))
+	return append(header, addrs...)
+}
+
+func testProxyTLVs() [][]byte {
+	ssl := append([]byte{0x01, 0, 0, 0, 0}, proxyTLV(proxyTLVSubtypeSSLVersion, []byte("TLSv1.3"))...)
+	ssl = append(ssl, proxyTLV(proxyTLVSubtypeSSLCN, []byte("bot"))...)
+	return [][]byte{
+		proxyTLV(ProxyTLVTypeALPN, []byte("h2")),
+		proxyTLV(ProxyTLVTypeAuthority, []byte("game.example.com")),
+		proxyTLV(ProxyTLVTypeUniqueID, []byte{0xca, 0xfe}),
+		proxyTLV(ProxyTLVTypeSSL, ssl),
+		proxyTLV(ProxyTLVTypeAWS, append([]byte{proxyTLVSubtypeAWSVPCEndpointID}, []byte("vpce-08d2bf15fac5001c9")...)),
+		proxyTLV(0xe0, []byte{0x01, 0x02}),
+	}
+}
+
+var testProxyMetadata = map[string]string{
+	"alpn":        "h2",
+	"authority":   "game.example.com",
+	"unique_id":   "cafe",
+	"ssl_version": "TLSv1.3",
+	"ssl_cn":      "bot",
+	"aws_vpce_id": "vpce-08d2bf15fac5001c9",
+	"0xe0":        "0102",
+}
+
+func TestParseProxyTLVs(t *testing.T) {
+	t.Parallel()
+	tables := []struct {
+		name string
+		raw  []byte
+		tlvs ProxyTLVs
+		err  bool
+	}{
+		{"empty", nil, ProxyTLVs{}, false},
+		{"one", proxyTLV(ProxyTLVTypeALPN, []byte("h2")), ProxyTLVs{ProxyTLVTypeALPN: []byte("h2")}, false},
+		{"many", append(proxyTLV(ProxyTLVTypeALPN, []byte("h2")), proxyTLV(ProxyTLVTypeAuthority, []byte("a.com"))...), ProxyTLVs{ProxyTLVTypeALPN: []byte("h2"), ProxyTLVTypeAuthority: []byte("a.com")}, false},
+		{"truncated_header", []byte{ProxyTLVTypeALPN, 0}, nil, true},
+		{"truncated_value", []byte{ProxyTLVTypeALPN, 0, 3, 'h'}, nil, true},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			tlvs, err := parseProxyTLVs(table.raw)
+			if table.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, table.tlvs, tlvs)
+			}
+		})
+	}
+}
+
+func TestProxyTLVsMetadata(t *testing.T) {
+	t.Parallel()
+	var raw []byte
+	for _, tlv := range testProxyTLVs() {
+		raw = append(raw, tlv...)
+	}
+	tlvs, err := parseProxyTLVs(raw)
+	assert.NoError(t, err)
+	assert.Equal(t, testProxyMetadata, tlvs.Metadata())
+}
+
+func TestTCPAcceptorProxyProtocolTLVs(t *testing.T) {
+	a := NewTCPAcceptor("127.0.0.1:0")
+	a.EnableProxyProtocol()
+	go a.ListenAndServe()
+	defer a.Stop()
+	helpers.ShouldEventuallyReturn(t, func() bool {
+		return a.GetAddr() != ""
+	}, true, 10*time.Millisecond, 100*time.Millisecond)
+
+	conn, err := net.Dial("tcp", a.GetAddr())
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	data := []byte{0x02, 0x00, 0x00, 0x01, 0x00}
+	_, err = conn.Write(append(proxyV2Header(testProxyTLVs()...), data...))
+	assert.NoError(t, err)
+
+	playerConn := helpers.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(PlayerConn)
+	assert.Equal(t, "10.1.2.3:4321", playerConn.RemoteAddr().String())
+	assert.Equal(t, testProxyMetadata, GetProxyTLVs(playerConn).Metadata())
+
+	msg, err := playerConn.GetNextMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, data, msg)
+}
+
+func TestTCPAcceptorWithoutProxyProtocol(t *testing.T) {
+	a := NewTCPAcceptor("127.0.0.1:0")
+	go a.ListenAndServe()
+	defer a.Stop()
+	helpers.ShouldEventuallyReturn(t, func() bool {
+		return a.GetAddr() != ""
+	}, true, 10*time.Millisecond, 100*time.Millisecond)
+
+	conn, err := net.Dial("tcp", a.GetAddr())
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	playerConn := helpers.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(PlayerConn)
+	assert.Empty(t, GetProxyTLVs(playerConn))
+}
+
+func TestWSAcceptorProxyProtocolTLVs(t *testing.T) {
+	w := NewWSAcceptor("127.0.0.1:0")
+	w.EnableProxyProtocol()
+	go w.ListenAndServe()
+	defer w.Stop()
+	helpers.ShouldEventuallyReturn(t, func() bool {
+		return w.IsRunning()
+	}, true, 10*time.Millisecond, 100*time.Millisecond)
+
+	dialer := websocket.Dialer{
+		NetDial: func(network, addr string) (net.Conn, error) {
+			conn, err := net.Dial(network, addr)
+			if err != nil {
+				return nil, err
+			}
+			_, err = conn.Write(proxyV2Header(testProxyTLVs()...))
+			return conn, err
+		},
+	}
+	conn, _, err := dialer.Dial(fmt.Sprintf("ws://%s", w.GetAddr()), nil)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	playerConn := helpers.ShouldEventuallyReceive(t, w.GetConnChan(), 100*time.Millisecond).(PlayerConn)
+	assert.Equal(t, "10.1.2.3:4321", playerConn.RemoteAddr().String())
+	assert.Equal(t, testProxyMetadata, GetProxyTLVs(playerConn).Metadata())
+}
@@ -0,0 +1,294 @@
+// Copyright (c) TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package acceptor
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/topfreegames/pitaya/v2/constants"
+	"github.com/topfreegames/pitaya/v2/logger"
+)
+
+// QUICNextProto is the ALPN protocol negotiated between pitaya QUIC peers
+const QUICNextProto = "pitaya"
+
+// quicKeepAlivePeriod must be smaller than the QUIC idle timeout, otherwise
+// connections with a heartbeat interval close to it would be dropped
+const quicKeepAlivePeriod = 10 * time.Second
+
+// quicStreamTimeout is how long a connection can stay open before the client
+// opens its main stream, the keep alives would hold it forever otherwise
+const quicStreamTimeout = 10 * time.Second
+
+// QUICAcceptor accepts QUIC connections. Since QUIC routes packets by
+// connection ID instead of by address, sessions are kept when a client
+// changes networks without having to reconnect.
+//
+// Each QUIC connection is a single PlayerConn. The first bidirectional
+// stream opened by the client is used for the handshake and for every
+// message the server sends, while any unidirectional stream opened by the
+// client afterwards delivers its messages independently, so a lost packet
+// in one stream does not delay the messages of the others.
+type QUICAcceptor struct {
+	addr          string
+	connChan      chan PlayerConn
+	listener      *quic.Listener
+	running       bool
+	certs         []tls.Certificate
+	maxPacketSize int
+	streamTimeout time.Duration
+}
+
+type quicMessage struct {
+	data []byte
+	err  error
+}
+
+// quicConn adapts a QUIC connection and one of its streams to net.Conn
+type quicConn struct {
+	quic.Stream
+	conn quic.Connection
+}
+
+// LocalAddr returns the local network address.
+func (c *quicConn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// RemoteAddr returns the remote network address.
+func (c *quicConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// Close closes the whole QUIC connection, not only its stream
+func (c *quicConn) Close() error {
+	return c.conn.CloseWithError(0, "")
+}
+
+type quicPlayerConn struct {
+	*quicConn
+	messages      chan quicMessage
+	maxPacketSize int
+	packetSizeLimit
+}
+
+func newQUICPlayerConn(conn *quicConn, maxPacketSize int) *quicPlayerConn {
+	c := &quicPlayerConn{
+		quicConn:      conn,
+		messages:      make(chan quicMessage),
+		maxPacketSize: maxPacketSize,
+	}
+
+	go c.readStream(conn.Stream, true)
+	go c.acceptStreams()
+
+	return c
+}
+
+// GetNextMessage returns the next message received in any of the streams
+func (c *quicPlayerConn) GetNextMessage() (b []byte, err error) {
+	select {
+	case m := <-c.messages:
+		return m.data, m.err
+	case <-c.conn.Context().Done():
+		return nil, constants.ErrConnectionClosed
+	}
+}
+
+func (c *quicPlayerConn) acceptStreams() {
+	for {
+		stream, err := c.conn.AcceptUniStream(c.conn.Context())
+		if err != nil {
+			return
+		}
+		go c.readStream(stream, false)
+	}
+}
+
+// readStream forwards the messages of a stream until it ends. The end of
+// an additional stream is expected, while the end of the main one means
+// the client is gone.
+func (c *quicPlayerConn) readStream(stream quic.ReceiveStream, main bool) {
+	for {
+		msg, err := readNextMessage(stream, c.limit(c.maxPacketSize))
+		if err == constants.ErrConnectionClosed && !main {
+			return
+		}
+
+		select {
+		case c.messages <- quicMessage{data: msg, err: err}:
+		case <-c.conn.Context().Done():
+			return
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// NewQUICAcceptor creates a new instance of quic acceptor, QUIC always
+// uses TLS so a certificate and a key file are required
+func NewQUICAcceptor(addr, certFile, keyFile string) *QUICAcceptor {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		panic(fmt.Errorf("%w: %v", constants.ErrInvalidCertificates, err))
+	}
+
+	return NewQUICAcceptorWithCertificates(addr, cert)
+}
+
+// NewQUICAcceptorWithCertificates creates a new instance of quic acceptor
+// using already loaded certificates
+func NewQUICAcceptorWithCertificates(addr string, certs ...tls.Certificate) *QUICAcceptor {
+	if len(certs) == 0 {
+		panic(constants.ErrInvalidCertificates)
+	}
+
+	return &QUICAcceptor{
+		addr:          addr,
+		connChan:      make(chan PlayerConn),
+		running:       false,
+		certs:         certs,
+		streamTimeout: quicStreamTimeout,
+	}
+}
+
+// DialQUIC connects to a QUIC acceptor and opens the main stream
+func DialQUIC(addr string, tlsConfig *tls.Config) (net.Conn, error) {
+	tlsCfg := &tls.Config{}
+	if tlsConfig != nil {
+		tlsCfg = tlsConfig.Clone()
+	}
+	if len(tlsCfg.NextProtos) == 0 {
+		tlsCfg.NextProtos = []string{QUICNextProto}
+	}
+
+	ctx := context.Background()
+	conn, err := quic.DialAddr(ctx, addr, tlsCfg, &quic.Config{KeepAlivePeriod: quicKeepAlivePeriod})
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		conn.CloseWithError(0, "")
+		return nil, err
+	}
+
+	return &quicConn{Stream: stream, conn: conn}, nil
+}
+
+// GetAddr returns the addr the acceptor will listen on
+func (a *QUICAcceptor) GetAddr() string {
+	if a.listener != nil {
+		return a.listener.Addr().String()
+	}
+	return ""
+}
+
+// GetConnChan gets a connection channel
+func (a *QUICAcceptor) GetConnChan() chan PlayerConn {
+	return a.connChan
+}
+
+// Stop stops the acceptor
+func (a *QUICAcceptor) Stop() {
+	a.running = false
+	a.listener.Close()
+}
+
+// ListenAndServe using quic acceptor
+func (a *QUICAcceptor) ListenAndServe() {
+	tlsCfg := &tls.Config{
+		Certificates: a.certs,
+		NextProtos:   []string{QUICNextProto},
+		MinVersion:   tls.VersionTLS13,
+	}
+
+	listener, err := quic.ListenAddr(a.addr, tlsCfg, &quic.Config{KeepAlivePeriod: quicKeepAlivePeriod})
+	if err != nil {
+		logger.Log.Fatalf("Failed to listen: %s", err.Error())
+	}
+	a.listener = listener
+	a.running = true
+	a.serve()
+}
+
+// EnableProxyProtocol is a no-op, load balancers can't insert the PROXY
+// protocol header in the streams, which are encrypted end to end
+func (a *QUICAcceptor) EnableProxyProtocol() {
+}
+
+// SetMaxPacketSize makes the acceptor close the connections that send
+// packets larger than size bytes, which are rejected from their header
+// before being read. Zero keeps the 16MB limit of the pomelo protocol, a
+// larger size allows clients to send larger length prefixed packets
+func (a *QUICAcceptor) SetMaxPacketSize(size int) {
+	a.maxPacketSize = size
+}
+
+// SetStreamTimeout sets how long a connection can stay open before the client
+// opens its main stream, after which it is closed
+func (a *QUICAcceptor) SetStreamTimeout(timeout time.Duration) {
+	a.streamTimeout = timeout
+}
+
+func (a *QUICAcceptor) serve() {
+	defer a.Stop()
+	for a.running {
+		conn, err := a.listener.Accept(context.Background())
+		if err != nil {
+			logger.Log.Errorf("Failed to accept QUIC connection: %s", err.Error())
+			continue
+		}
+
+		go a.handleConn(conn)
+	}
+}
+
+func (a *QUICAcceptor) handleConn(conn quic.Connection) {
+	ctx, cancel := context.WithTimeout(conn.Context(), a.streamTimeout)
+	stream, err := conn.AcceptStream(ctx)
+	cancel()
+	if err != nil {
+		logger.Log.Errorf("Failed to accept QUIC stream: %s", err.Error())
+		conn.CloseWithError(0, "")
+		return
+	}
+
+	a.connChan <- newQUICPlayerConn(&quicConn{Stream: stream, conn: conn}, a.maxPacketSize)
+}
+
+// IsRunning returns if the acceptor is running
+func (a *QUICAcceptor) IsRunning() bool {
+	return a.running
+}
+
+// GetConfiguredAddress returns the addr the acceptor was configured with
+func (a *QUICAcceptor) GetConfiguredAddress() string {
+	return a.addr
+}
@@ -0,0 +1,198 @@
+// Copyright (c) TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package acceptor
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/topfreegames/pitaya/v2/conn/packet"
+	"github.com/topfreegames/pitaya/v2/constants"
+	"github.com/topfreegames/pitaya/v2/helpers"
+)
+
+func mustStartQUICAcceptor(t *testing.T, proxyProtocol bool) *QUICAcceptor {
+	t.Helper()
+	a := NewQUICAcceptor("127.0.0.1:0", "./fixtures/server.crt", "./fixtures/server.key")
+	if proxyProtocol {
+		a.EnableProxyProtocol()
+	}
+	go a.ListenAndServe()
+	helpers.ShouldEventuallyReturn(t, func() bool {
+		return a.GetAddr() != ""
+	}, true, 10*time.Millisecond, 100*time.Millisecond)
+	return a
+}
+
+func mustDialQUIC(t *testing.T, a *QUICAcceptor) *quicConn {
+	t.Helper()
+	conn, err := DialQUIC(a.GetAddr(), &tls.Config{InsecureSkipVerify: true})
+	assert.NoError(t, err)
+	return conn.(*quicConn)
+}
+
+func TestNewQUICAcceptor(t *testing.T) {
+	t.Parallel()
+	assert.NotPanics(t, func() {
+		a := NewQUICAcceptor("127.0.0.1:0", "./fixtures/server.crt", "./fixtures/server.key")
+		assert.Len(t, a.certs, 1)
+		assert.NotNil(t, a.GetConnChan())
+		assert.Equal(t, "", a.GetAddr())
+		assert.Equal(t, "127.0.0.1:0", a.GetConfiguredAddress())
+	})
+	assert.Panics(t, func() {
+		NewQUICAcceptor("127.0.0.1:0", "wqd", "wqdqwd")
+	})
+	assert.PanicsWithValue(t, constants.ErrInvalidCertificates, func() {
+		NewQUICAcceptorWithCertificates("127.0.0.1:0")
+	})
+}
+
+func TestQUICAcceptorGetNextMessage(t *testing.T) {
+	tables := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"invalid_header", []byte{0x00, 0x00, 0x00, 0x00}, packet.ErrWrongPomeloPacketType},
+		{"valid_message", []byte{0x02, 0x00, 0x00, 0x01, 0x00}, nil},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			a := mustStartQUICAcceptor(t, false)
+			defer a.Stop()
+			conn := mustDialQUIC(t, a)
+			defer conn.Close()
+
+			_, err := conn.Write(table.data)
+			assert.NoError(t, err)
+
+			playerConn := helpers.ShouldEventuallyReceive(t, a.GetConnChan(), 500*time.Millisecond).(PlayerConn)
+			assert.Equal(t, conn.LocalAddr().(*net.UDPAddr).Port, playerConn.RemoteAddr().(*net.UDPAddr).Port)
+
+			msg, err := playerConn.GetNextMessage()
+			if table.err != nil {
+				assert.EqualError(t, err, table.err.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, table.data, msg)
+			}
+		})
+	}
+}
+
+func TestQUICAcceptorWrite(t *testing.T) {
+	a := mustStartQUICAcceptor(t, false)
+	defer a.Stop()
+	conn := mustDialQUIC(t, a)
+	defer conn.Close()
+
+	_, err := conn.Write([]byte{0x01, 0x00, 0x00, 0x01, 0x02})
+	assert.NoError(t, err)
+	playerConn := helpers.ShouldEventuallyReceive(t, a.GetConnChan(), 500*time.Millisecond).(PlayerConn)
+
+	data := []byte{0x02, 0x00, 0x00, 0x01, 0x00}
+	_, err = playerConn.Write(data)
+	assert.NoError(t, err)
+
+	b := make([]byte, len(data))
+	_, err = conn.Read(b)
+	assert.NoError(t, err)
+	assert.Equal(t, data, b)
+}
+
+func TestQUICAcceptorGetNextMessageFromStreams(t *testing.T) {
+	a := mustStartQUICAcceptor(t, false)
+	defer a.Stop()
+	conn := mustDialQUIC(t, a)
+	defer conn.Close()
+
+	msg1 := []byte{0x01, 0x00, 0x00, 0x01, 0x02}
+	_, err := conn.Write(msg1)
+	assert.NoError(t, err)
+	playerConn := helpers.ShouldEventuallyReceive(t, a.GetConnChan(), 500*time.Millisecond).(PlayerConn)
+	msg, err := playerConn.GetNextMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, msg1, msg)
+
+	msg2 := []byte{0x04, 0x00, 0x00, 0x02, 0x01, 0x01}
+	msg3 := []byte{0x04, 0x00, 0x00, 0x02, 0x05, 0x04}
+	stream, err := conn.conn.OpenUniStream()
+	assert.NoError(t, err)
+	_, err = stream.Write(append(msg2, msg3...))
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Close())
+
+	// the end of an additional stream must not be seen as a closed connection
+	msg, err = playerConn.GetNextMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, msg2, msg)
+	msg, err = playerConn.GetNextMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, msg3, msg)
+
+	conn.Close()
+	_, err = playerConn.GetNextMessage()
+	assert.Error(t, err)
+}
+
+func TestQUICAcceptorIgnoresProxyProtocol(t *testing.T) {
+	a := mustStartQUICAcceptor(t, true)
+	defer a.Stop()
+	conn := mustDialQUIC(t, a)
+	defer conn.Close()
+
+	// a header sent by the client is not trusted as its address
+	data := append([]byte("PROXY TCP4 10.1.2.3 10.3.2.1 4321 1234\r\n"), 0x02, 0x00, 0x00, 0x01, 0x00)
+	_, err := conn.Write(data)
+	assert.NoError(t, err)
+
+	playerConn := helpers.ShouldEventuallyReceive(t, a.GetConnChan(), 500*time.Millisecond).(PlayerConn)
+	assert.Equal(t, "127.0.0.1", playerConn.RemoteAddr().(*net.UDPAddr).IP.String())
+}
+
+func TestQUICAcceptorStreamTimeout(t *testing.T) {
+	a := NewQUICAcceptor("127.0.0.1:0", "./fixtures/server.crt", "./fixtures/server.key")
+	a.SetStreamTimeout(50 * time.Millisecond)
+	go a.ListenAndServe()
+	helpers.ShouldEventuallyReturn(t, func() bool {
+		return a.GetAddr() != ""
+	}, true, 10*time.Millisecond, 100*time.Millisecond)
+	defer a.Stop()
+
+	tlsCfg := &tls.Config{InsecureSkipVerify: true, NextProtos: []string{QUICNextProto}}
+	conn, err := quic.DialAddr(context.Background(), a.GetAddr(), tlsCfg, &quic.Config{KeepAlivePeriod: quicKeepAlivePeriod})
+	assert.NoError(t, err)
+	defer conn.CloseWithError(0, "")
+
+	// the client never opens its main stream
+	select {
+	case <-conn.Context().Done():
+	case <-time.After(time.Second):
+		t.Fatal("connection was not closed")
+	}
+}
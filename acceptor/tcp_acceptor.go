@@ -22,12 +22,12 @@ package acceptor
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"io"
 	"io/ioutil"
 	"net"
 	"fmt"
 
-	"github.com/mailgun/proxyproto"
 	"github.com/topfreegames/pitaya/v2/conn/codec"
 	"github.com/topfreegames/pitaya/v2/constants"
 	"github.com/topfreegames/pitaya/v2/logger"
@@ -40,21 +40,49 @@ type TCPAcceptor struct {
 	listener      net.Listener
 	running       bool
 	certs         []tls.Certificate
+	certProvider  CertificateProvider
+	clientAuth    tls.ClientAuthType
+	clientCAs     *x509.CertPool
 	proxyProtocol bool
+	maxPacketSize int
 }
 
 type tcpPlayerConn struct {
 	net.Conn
-	remoteAddr net.Addr
+	remoteAddr    net.Addr
+	proxyTLVs     ProxyTLVs
+	maxPacketSize int
+	packetSizeLimit
 }
 
 func (t *tcpPlayerConn) RemoteAddr() net.Addr {
 	return t.remoteAddr
 }
 
+// ProxyTLVs returns the TLVs sent in the PROXY protocol header
+func (t *tcpPlayerConn) ProxyTLVs() ProxyTLVs {
+	return t.proxyTLVs
+}
+
+// ClientCertificate returns the verified client certificate when the
+// connection is using TLS
+func (t *tcpPlayerConn) ClientCertificate() (*x509.Certificate, error) {
+	if tlsConn, ok := t.Conn.(*tls.Conn); ok {
+		return verifiedClientCertificate(tlsConn)
+	}
+	return nil, nil
+}
+
 // GetNextMessage reads the next message available in the stream
 func (t *tcpPlayerConn) GetNextMessage() (b []byte, err error) {
-	header, err := ioutil.ReadAll(io.LimitReader(t.Conn, codec.HeadLength))
+	return readNextMessage(t.Conn, t.limit(t.maxPacketSize))
+}
+
+// readNextMessage reads a whole pomelo or length prefixed packet, header
+// included, from a stream. Packets larger than maxPacketSize, or than the
+// 16MB of the pomelo protocol when it is zero, are rejected without being read
+func readNextMessage(r io.Reader, maxPacketSize int) ([]byte, error) {
+	header, err := ioutil.ReadAll(io.LimitReader(r, codec.HeadLength))
 	if err != nil {
 		return nil, err
 	}
@@ -62,11 +90,24 @@ func (t *tcpPlayerConn) GetNextMessage() (b []byte, err error) {
 	if len(header) == 0 {
 		return nil, constants.ErrConnectionClosed
 	}
-	msgSize, _, err := codec.ParseHeader(header)
+	if len(header) == codec.HeadLength && codec.PacketHeadLength(header[0]) > codec.HeadLength {
+		rest, err := ioutil.ReadAll(io.LimitReader(r, int64(codec.PacketHeadLength(header[0])-codec.HeadLength)))
+		if err != nil {
+			return nil, err
+		}
+		header = append(header, rest...)
+	}
+	msgSize, _, err := codec.ParsePacketHeader(header)
 	if err != nil {
 		return nil, err
 	}
-	msgData, err := ioutil.ReadAll(io.LimitReader(t.Conn, int64(msgSize)))
+	if maxPacketSize <= 0 {
+		maxPacketSize = codec.MaxPacketSize
+	}
+	if msgSize > maxPacketSize {
+		return nil, codec.ErrPacketSizeExcced
+	}
+	msgData, err := ioutil.ReadAll(io.LimitReader(r, int64(msgSize)))
 	if err != nil {
 		return nil, err
 	}
@@ -102,6 +143,15 @@ func NewTLSAcceptor(addr string, certs ...tls.Certificate) *TCPAcceptor {
 	}
 }
 
+// NewTLSAcceptorWithCertificateProvider creates a new instance of tcp acceptor
+// that asks provider for the certificate on every TLS handshake, so
+// certificates can be renewed without restarting the acceptor
+func NewTLSAcceptorWithCertificateProvider(addr string, provider CertificateProvider) *TCPAcceptor {
+	a := NewTLSAcceptor(addr)
+	a.certProvider = provider
+	return a
+}
+
 // GetAddr returns the addr the acceptor will listen on
 func (a *TCPAcceptor) GetAddr() string {
 	if a.listener != nil {
@@ -122,7 +172,7 @@ func (a *TCPAcceptor) Stop() {
 }
 
 func (a *TCPAcceptor) hasTLSCertificates() bool {
-	return len(a.certs) > 0
+	return len(a.certs) > 0 || a.certProvider != nil
 }
 
 // ListenAndServe using tcp acceptor
@@ -155,7 +205,14 @@ func (a *TCPAcceptor) ListenAndServeTLS(cert, key string) {
 
 // ListenAndServeTLS listens using tls
 func (a *TCPAcceptor) listenAndServeTLS() {
-	tlsCfg := &tls.Config{Certificates: a.certs}
+	tlsCfg := &tls.Config{
+		Certificates: a.certs,
+		ClientAuth:   a.clientAuth,
+		ClientCAs:    a.clientCAs,
+	}
+	if a.certProvider != nil {
+		tlsCfg.GetCertificate = a.certProvider.GetCertificate
+	}
 
 	listener, err := tls.Listen("tcp", a.addr, tlsCfg)
 	if err != nil {
@@ -170,6 +227,21 @@ func (a *TCPAcceptor) EnableProxyProtocol() {
 	a.proxyProtocol = true
 }
 
+// SetMaxPacketSize makes the acceptor close the connections that send
+// packets larger than size bytes, which are rejected from their header
+// before being read. Zero keeps the 16MB limit of the pomelo protocol, a
+// larger size allows clients to send larger length prefixed packets
+func (a *TCPAcceptor) SetMaxPacketSize(size int) {
+	a.maxPacketSize = size
+}
+
+// EnableClientAuth makes the acceptor request TLS certificates from the
+// clients, which are verified against clientCAs according to clientAuth
+func (a *TCPAcceptor) EnableClientAuth(clientAuth tls.ClientAuthType, clientCAs *x509.CertPool) {
+	a.clientAuth = clientAuth
+	a.clientCAs = clientCAs
+}
+
 func (a *TCPAcceptor) serve() {
 	defer a.Stop()
 	for a.running {
@@ -178,27 +250,20 @@ func (a *TCPAcceptor) serve() {
 			logger.Log.Errorf("Failed to accept TCP connection: %s", err.Error())
 			continue
 		}
-		var remoteAddr net.Addr
-		if a.proxyProtocol == true {
-			h, err := proxyproto.ReadHeader(conn)
-			if err != nil {
-				logger.Log.Errorf("Failed to read Proxy Protocol TCP header: %s", err.Error())
-				conn.Close()
-				continue
-			} else if h.Source == nil {
-				conn.Close()
-				continue
-			} else {
-				remoteAddr = h.Source
-			}
-		} else {
-
-			remoteAddr = conn.RemoteAddr()
-
+		remoteAddr, proxyTLVs, err := readProxyHeader(conn, a.proxyProtocol)
+		if err != nil {
+			logger.Log.Errorf("Failed to read Proxy Protocol TCP header: %s", err.Error())
+			conn.Close()
+			continue
+		} else if remoteAddr == nil {
+			conn.Close()
+			continue
 		}
 		a.connChan <- &tcpPlayerConn{
-			Conn:       conn,
-			remoteAddr: remoteAddr,
+			Conn:          conn,
+			remoteAddr:    remoteAddr,
+			proxyTLVs:     proxyTLVs,
+			maxPacketSize: a.maxPacketSize,
 		}
 	}
 }
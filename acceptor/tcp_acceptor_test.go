@@ -27,6 +27,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/topfreegames/pitaya/v2/conn/codec"
 	"github.com/topfreegames/pitaya/v2/conn/packet"
 	"github.com/topfreegames/pitaya/v2/constants"
 	"github.com/topfreegames/pitaya/v2/helpers"
@@ -156,6 +157,8 @@ func TestGetNextMessage(t *testing.T) {
 	}{
 		{"invalid_header", []byte{0x00, 0x00, 0x00, 0x00}, packet.ErrWrongPomeloPacketType},
 		{"valid_message", []byte{0x02, 0x00, 0x00, 0x01, 0x00}, nil},
+		{"length_prefixed_message", []byte{0x84, 0x00, 0x00, 0x00, 0x01, 0x00}, nil},
+		{"length_prefixed_message_too_large", []byte{0x84, 0x01, 0x00, 0x00, 0x01}, codec.ErrPacketSizeExcced},
 	}
 
 	for _, table := range tables {
@@ -299,3 +302,87 @@ func TestGetNextMessageInParts(t *testing.T) {
 	assert.Equal(t, msg, append(part1, part2...))
 
 }
+
+func TestGetNextMessageMaxPacketSize(t *testing.T) {
+	a := NewTCPAcceptor("0.0.0.0:0")
+	a.SetMaxPacketSize(2)
+	go a.ListenAndServe()
+	defer a.Stop()
+	c := a.GetConnChan()
+	// should be able to connect within 100 milliseconds
+	var conn net.Conn
+	var err error
+	helpers.ShouldEventuallyReturn(t, func() error {
+		conn, err = net.Dial("tcp", a.GetAddr())
+		return err
+	}, nil, 10*time.Millisecond, 100*time.Millisecond)
+
+	defer conn.Close()
+	playerConn := helpers.ShouldEventuallyReceive(t, c, 100*time.Millisecond).(PlayerConn)
+	msg := []byte{0x04, 0x00, 0x00, 0x02, 0x01, 0x02}
+	_, err = conn.Write(msg)
+	assert.NoError(t, err)
+	received, err := playerConn.GetNextMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, msg, received)
+
+	// only the header is sent, the packet must be rejected without its body
+	_, err = conn.Write([]byte{0x04, 0x01, 0x00, 0x00})
+	assert.NoError(t, err)
+	_, err = playerConn.GetNextMessage()
+	assert.Equal(t, codec.ErrPacketSizeExcced, err)
+}
+
+func TestGetNextMessageLimitPacketSize(t *testing.T) {
+	a := NewTCPAcceptor("0.0.0.0:0")
+	a.SetMaxPacketSize(4)
+	go a.ListenAndServe()
+	defer a.Stop()
+	c := a.GetConnChan()
+	var conn net.Conn
+	var err error
+	helpers.ShouldEventuallyReturn(t, func() error {
+		conn, err = net.Dial("tcp", a.GetAddr())
+		return err
+	}, nil, 10*time.Millisecond, 100*time.Millisecond)
+
+	defer conn.Close()
+	playerConn := helpers.ShouldEventuallyReceive(t, c, 100*time.Millisecond).(PlayerConn)
+	// the conn limit never raises the one of the acceptor
+	assert.True(t, LimitPacketSize(playerConn, 8))
+	assert.Equal(t, 4, playerConn.(*tcpPlayerConn).limit(4))
+
+	assert.True(t, LimitPacketSize(playerConn, 1))
+	_, err = conn.Write([]byte{0x04, 0x00, 0x00, 0x02})
+	assert.NoError(t, err)
+	_, err = playerConn.GetNextMessage()
+	assert.Equal(t, codec.ErrPacketSizeExcced, err)
+
+	LimitPacketSize(playerConn, 0)
+	assert.Equal(t, 4, playerConn.(*tcpPlayerConn).limit(4))
+}
+
+func TestGetNextMessageLargerThanPomeloMaxPacketSize(t *testing.T) {
+	a := NewTCPAcceptor("0.0.0.0:0")
+	a.SetMaxPacketSize(codec.MaxPacketSize + 1)
+	go a.ListenAndServe()
+	defer a.Stop()
+	c := a.GetConnChan()
+	// should be able to connect within 100 milliseconds
+	var conn net.Conn
+	var err error
+	helpers.ShouldEventuallyReturn(t, func() error {
+		conn, err = net.Dial("tcp", a.GetAddr())
+		return err
+	}, nil, 10*time.Millisecond, 100*time.Millisecond)
+
+	defer conn.Close()
+	playerConn := helpers.ShouldEventuallyReceive(t, c, 100*time.Millisecond).(PlayerConn)
+	msg, err := codec.NewLengthPrefixedPacketEncoder().Encode(packet.Data, make([]byte, codec.MaxPacketSize+1))
+	assert.NoError(t, err)
+	go conn.Write(msg)
+
+	received, err := playerConn.GetNextMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, msg, received)
+}
@@ -0,0 +1,166 @@
+// Copyright (c) TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package acceptor
+
+import (
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+
+	"github.com/topfreegames/pitaya/v2/logger"
+)
+
+// UnixAcceptor accepts connections on a unix stream socket, which is
+// useful when a proxy running on the same host terminates the client
+// connections. The proxy should enable PROXY protocol so that the real
+// client address is preserved.
+type UnixAcceptor struct {
+	path          string
+	fileMode      os.FileMode
+	connChan      chan PlayerConn
+	listener      net.Listener
+	running       bool
+	proxyProtocol bool
+	maxPacketSize int
+}
+
+// NewUnixAcceptor creates a new instance of unix acceptor, the socket
+// file is created at path with the given permissions
+func NewUnixAcceptor(path string, fileMode os.FileMode) *UnixAcceptor {
+	return &UnixAcceptor{
+		path:          path,
+		fileMode:      fileMode,
+		connChan:      make(chan PlayerConn),
+		running:       false,
+		proxyProtocol: false,
+	}
+}
+
+// GetAddr returns the path of the socket the acceptor is listening on
+func (a *UnixAcceptor) GetAddr() string {
+	if a.listener != nil {
+		return a.listener.Addr().String()
+	}
+	return ""
+}
+
+// GetConnChan gets a connection channel
+func (a *UnixAcceptor) GetConnChan() chan PlayerConn {
+	return a.connChan
+}
+
+// Stop stops the acceptor, closing the listener removes its socket file
+func (a *UnixAcceptor) Stop() {
+	a.running = false
+	a.listener.Close()
+}
+
+// ListenAndServe using unix acceptor
+func (a *UnixAcceptor) ListenAndServe() {
+	// a socket file left behind by a process that did not stop gracefully
+	// would make listen fail with "address already in use"
+	if err := removeStaleSocketFile(a.path); err != nil {
+		logger.Log.Fatalf("Failed to listen: %s", err.Error())
+	}
+
+	listener, err := listenUnix(a.path, a.fileMode)
+	if err != nil {
+		logger.Log.Fatalf("Failed to listen: %s", err.Error())
+	}
+	a.listener = listener
+	a.running = true
+	a.serve()
+}
+
+// EnableProxyProtocol makes the acceptor read the client address from the
+// PROXY protocol header sent by the proxy
+func (a *UnixAcceptor) EnableProxyProtocol() {
+	a.proxyProtocol = true
+}
+
+// SetMaxPacketSize makes the acceptor close the connections that send
+// packets larger than size bytes, which are rejected from their header
+// before being read. Zero keeps the 16MB limit of the pomelo protocol, a
+// larger size allows clients to send larger length prefixed packets
+func (a *UnixAcceptor) SetMaxPacketSize(size int) {
+	a.maxPacketSize = size
+}
+
+func (a *UnixAcceptor) serve() {
+	for a.running {
+		conn, err := a.listener.Accept()
+		if err != nil {
+			logger.Log.Errorf("Failed to accept unix connection: %s", err.Error())
+			continue
+		}
+
+		remoteAddr, proxyTLVs, err := readProxyHeader(conn, a.proxyProtocol)
+		if err != nil {
+			logger.Log.Errorf("Failed to read Proxy Protocol unix header: %s", err.Error())
+			conn.Close()
+			continue
+		} else if remoteAddr == nil {
+			conn.Close()
+			continue
+		}
+		a.connChan <- &tcpPlayerConn{
+			Conn:          conn,
+			remoteAddr:    remoteAddr,
+			proxyTLVs:     proxyTLVs,
+			maxPacketSize: a.maxPacketSize,
+		}
+	}
+}
+
+// IsRunning returns if the acceptor is running
+func (a *UnixAcceptor) IsRunning() bool {
+	return a.running
+}
+
+// GetConfiguredAddress returns the socket path the acceptor was configured with
+func (a *UnixAcceptor) GetConfiguredAddress() string {
+	return a.path
+}
+
+// removeStaleSocketFile removes the socket file at path if no one is
+// accepting connections on it anymore
+func removeStaleSocketFile(path string) error {
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return &os.PathError{Op: "listen", Path: path, Err: errors.New("file exists and is not a socket")}
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err == nil {
+		conn.Close()
+		return &os.PathError{Op: "listen", Path: path, Err: errors.New("socket is in use")}
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
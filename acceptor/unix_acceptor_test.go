@@ -0,0 +1,166 @@
+// Copyright (c) TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package acceptor
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topfreegames/pitaya/v2/conn/packet"
+	"github.com/topfreegames/pitaya/v2/helpers"
+)
+
+func mustStartUnixAcceptor(t *testing.T, path string, proxyProtocol bool) *UnixAcceptor {
+	t.Helper()
+	a := NewUnixAcceptor(path, 0660)
+	if proxyProtocol {
+		a.EnableProxyProtocol()
+	}
+	go a.ListenAndServe()
+	helpers.ShouldEventuallyReturn(t, func() bool {
+		return a.GetAddr() != ""
+	}, true, 10*time.Millisecond, 100*time.Millisecond)
+	return a
+}
+
+func TestNewUnixAcceptor(t *testing.T) {
+	t.Parallel()
+	a := NewUnixAcceptor("/tmp/pitaya.sock", 0600)
+	assert.NotNil(t, a.GetConnChan())
+	assert.Equal(t, "", a.GetAddr())
+	assert.Equal(t, "/tmp/pitaya.sock", a.GetConfiguredAddress())
+	assert.Equal(t, os.FileMode(0600), a.fileMode)
+	assert.False(t, a.IsRunning())
+}
+
+func TestUnixAcceptorListenAndServe(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pitaya.sock")
+	a := mustStartUnixAcceptor(t, path, false)
+	defer a.Stop()
+	assert.Equal(t, path, a.GetAddr())
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0660), info.Mode().Perm())
+
+	conn, err := net.Dial("unix", path)
+	assert.NoError(t, err)
+	defer conn.Close()
+	playerConn := helpers.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(PlayerConn)
+	assert.NotNil(t, playerConn)
+}
+
+func TestUnixAcceptorRemovesStaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pitaya.sock")
+	l, err := net.Listen("unix", path)
+	assert.NoError(t, err)
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+	_, err = os.Stat(path)
+	assert.NoError(t, err)
+
+	a := mustStartUnixAcceptor(t, path, false)
+	defer a.Stop()
+	_, err = net.Dial("unix", path)
+	assert.NoError(t, err)
+}
+
+func TestUnixAcceptorDoesNotRemoveSocketInUse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pitaya.sock")
+	l, err := net.Listen("unix", path)
+	assert.NoError(t, err)
+	defer l.Close()
+
+	assert.Error(t, removeStaleSocketFile(path))
+	_, err = os.Stat(path)
+	assert.NoError(t, err)
+}
+
+func TestUnixAcceptorStop(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pitaya.sock")
+	a := mustStartUnixAcceptor(t, path, false)
+	a.Stop()
+
+	_, err := os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+	_, err = net.Dial("unix", path)
+	assert.Error(t, err)
+}
+
+func TestUnixAcceptorGetNextMessage(t *testing.T) {
+	tables := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"invalid_header", []byte{0x00, 0x00, 0x00, 0x00}, packet.ErrWrongPomeloPacketType},
+		{"valid_message", []byte{0x02, 0x00, 0x00, 0x01, 0x00}, nil},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "pitaya.sock")
+			a := mustStartUnixAcceptor(t, path, false)
+			defer a.Stop()
+
+			conn, err := net.Dial("unix", path)
+			assert.NoError(t, err)
+			defer conn.Close()
+
+			playerConn := helpers.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(PlayerConn)
+			_, err = conn.Write(table.data)
+			assert.NoError(t, err)
+
+			msg, err := playerConn.GetNextMessage()
+			if table.err != nil {
+				assert.EqualError(t, err, table.err.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, table.data, msg)
+			}
+		})
+	}
+}
+
+func TestUnixAcceptorProxyProtocol(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pitaya.sock")
+	a := mustStartUnixAcceptor(t, path, true)
+	defer a.Stop()
+
+	conn, err := net.Dial("unix", path)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	data := []byte{0x02, 0x00, 0x00, 0x01, 0x00}
+	_, err = conn.Write(append([]byte("PROXY TCP4 10.1.2.3 10.3.2.1 4321 1234\r\n"), data...))
+	assert.NoError(t, err)
+
+	playerConn := helpers.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(PlayerConn)
+	assert.Equal(t, "10.1.2.3:4321", playerConn.RemoteAddr().String())
+
+	msg, err := playerConn.GetNextMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, data, msg)
+}
@@ -0,0 +1,44 @@
+//go:build !windows
+
+// Copyright (c) TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package acceptor
+
+import (
+	"net"
+	"os"
+	"sync"
+	"syscall"
+)
+
+var umaskMutex sync.Mutex
+
+// listenUnix listens on a unix socket created at path with the permissions
+// of fileMode, which the umask applies when the socket file is created so
+// that it is never reachable with broader permissions. The umask is process
+// wide, so files created by other goroutines meanwhile are also restricted
+func listenUnix(path string, fileMode os.FileMode) (net.Listener, error) {
+	umaskMutex.Lock()
+	defer umaskMutex.Unlock()
+	umask := syscall.Umask(int(^fileMode.Perm() & os.ModePerm))
+	defer syscall.Umask(umask)
+	return net.Listen("unix", path)
+}
@@ -22,12 +22,16 @@ package acceptor
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"io"
 	"net"
 	"net/http"
+	"net/url"
+	"path"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/topfreegames/pitaya/v2/config"
 	"github.com/topfreegames/pitaya/v2/conn/codec"
 	"github.com/topfreegames/pitaya/v2/conn/packet"
 	"github.com/topfreegames/pitaya/v2/constants"
@@ -42,10 +46,24 @@ type WSAcceptor struct {
 	certFile string
 	keyFile  string
 	running  bool
+	config   config.WSAcceptorConfig
+
+	proxyProtocol bool
+	maxPacketSize int
+
+	certProvider CertificateProvider
+	clientAuth   tls.ClientAuthType
+	clientCAs    *x509.CertPool
 }
 
 // NewWSAcceptor returns a new instance of WSAcceptor
 func NewWSAcceptor(addr string, certs ...string) *WSAcceptor {
+	return NewWSAcceptorWithConfig(addr, *config.NewDefaultWSAcceptorConfig(), certs...)
+}
+
+// NewWSAcceptorWithConfig returns a new instance of WSAcceptor with
+// compression, subprotocols, origin checks, paths and frame size set by c
+func NewWSAcceptorWithConfig(addr string, c config.WSAcceptorConfig, certs ...string) *WSAcceptor {
 	keyFile := ""
 	certFile := ""
 	if len(certs) != 2 && len(certs) != 0 {
@@ -61,6 +79,7 @@ func NewWSAcceptor(addr string, certs ...string) *WSAcceptor {
 		certFile: certFile,
 		keyFile:  keyFile,
 		running:  false,
+		config:   c,
 	}
 	return w
 }
@@ -73,6 +92,15 @@ func (w *WSAcceptor) GetConfiguredAddress() string {
         return w.addr
 }
 
+// NewWSAcceptorWithCertificateProvider returns a new instance of WSAcceptor
+// serving TLS with the certificate returned by provider on every handshake,
+// so certificates can be renewed without restarting the acceptor
+func NewWSAcceptorWithCertificateProvider(addr string, c config.WSAcceptorConfig, provider CertificateProvider) *WSAcceptor {
+	w := NewWSAcceptorWithConfig(addr, c)
+	w.certProvider = provider
+	return w
+}
+
 // GetAddr returns the addr the acceptor will listen on
 func (w *WSAcceptor) GetAddr() string {
 	if w.listener != nil {
@@ -86,13 +114,33 @@ func (w *WSAcceptor) GetConnChan() chan PlayerConn {
 	return w.connChan
 }
 
-// PROXY protocol support not implemented for WS acceptor
+// EnableProxyProtocol makes the acceptor read the PROXY protocol header
+// sent by the load balancer before the websocket handshake
 func (w *WSAcceptor) EnableProxyProtocol() {
+	w.proxyProtocol = true
+}
+
+// SetMaxPacketSize makes the acceptor close the connections that send
+// packets larger than size bytes, which are rejected by the websocket read
+// limit before being read. Zero keeps the 16MB limit of the pomelo protocol,
+// a larger size allows clients to send larger length prefixed packets
+func (w *WSAcceptor) SetMaxPacketSize(size int) {
+	w.maxPacketSize = size
+}
+
+// EnableClientAuth makes the acceptor request TLS certificates from the
+// clients, which are verified against clientCAs according to clientAuth
+func (w *WSAcceptor) EnableClientAuth(clientAuth tls.ClientAuthType, clientCAs *x509.CertPool) {
+	w.clientAuth = clientAuth
+	w.clientCAs = clientCAs
 }
 
 type connHandler struct {
-	upgrader *websocket.Upgrader
-	connChan chan PlayerConn
+	upgrader         *websocket.Upgrader
+	connChan         chan PlayerConn
+	compressionLevel int
+	maxFrameSize     int64
+	maxPacketSize    int
 }
 
 func (h *connHandler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
@@ -102,70 +150,175 @@ func (h *connHandler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if h.upgrader.EnableCompression {
+		if err := conn.SetCompressionLevel(h.compressionLevel); err != nil {
+			logger.Log.Errorf("Failed to set compression level: %s", err.Error())
+			conn.Close()
+			return
+		}
+	}
+	limit := h.readLimit()
+	if limit > 0 {
+		conn.SetReadLimit(limit)
+	}
+
 	c, err := NewWSConn(conn)
 	if err != nil {
 		logger.Log.Errorf("Failed to create new ws connection: %s", err.Error())
 		return
 	}
+	c.maxPacketSize = h.maxPacketSize
+	c.readLimit = limit
 	h.connChan <- c
 }
 
+// readLimit returns the tighter of the max frame size and the max packet
+// size, as each websocket message carries a single packet
+func (h *connHandler) readLimit() int64 {
+	limit := h.maxFrameSize
+	if h.maxPacketSize > 0 {
+		packetLimit := int64(h.maxPacketSize + codec.LengthPrefixedHeadLength)
+		if limit <= 0 || packetLimit < limit {
+			limit = packetLimit
+		}
+	}
+	return limit
+}
+
 func (w *WSAcceptor) hasTLSCertificates() bool {
 	return w.certFile != "" && w.keyFile != ""
 }
 
 // ListenAndServe listens and serve in the specified addr
 func (w *WSAcceptor) ListenAndServe() {
+	if w.certProvider != nil {
+		w.listenAndServeTLS(&tls.Config{GetCertificate: w.certProvider.GetCertificate})
+		return
+	}
 	if w.hasTLSCertificates() {
 		w.ListenAndServeTLS(w.certFile, w.keyFile)
 		return
 	}
 
-	var upgrader = websocket.Upgrader{
-		ReadBufferSize:  constants.IOBufferBytesSize,
-		WriteBufferSize: constants.IOBufferBytesSize,
-		CheckOrigin: func(r *http.Request) bool {
+	upgrader := w.newUpgrader()
+	if upgrader.CheckOrigin == nil {
+		upgrader.CheckOrigin = func(r *http.Request) bool {
 			return true
-		},
+		}
 	}
 
-	listener, err := net.Listen("tcp", w.addr)
+	listener, err := w.listen()
 	if err != nil {
 		logger.Log.Fatalf("Failed to listen: %s", err.Error())
 	}
 	w.listener = listener
 	w.running = true
-	w.serve(&upgrader)
+	w.serve(upgrader)
 }
 
-// ListenAndServeTLS listens and serve in the specified addr using tls
-func (w *WSAcceptor) ListenAndServeTLS(cert, key string) {
-	var upgrader = websocket.Upgrader{
-		ReadBufferSize:  constants.IOBufferBytesSize,
-		WriteBufferSize: constants.IOBufferBytesSize,
+// listen listens on the acceptor addr, reading the PROXY protocol header
+// of the accepted connections when it is enabled
+func (w *WSAcceptor) listen() (net.Listener, error) {
+	listener, err := net.Listen("tcp", w.addr)
+	if err != nil {
+		return nil, err
+	}
+	if w.proxyProtocol {
+		return &proxyProtocolListener{listener}, nil
 	}
+	return listener, nil
+}
 
+// ListenAndServeTLS listens and serve in the specified addr using tls
+func (w *WSAcceptor) ListenAndServeTLS(cert, key string) {
 	crt, err := tls.LoadX509KeyPair(cert, key)
 	if err != nil {
 		logger.Log.Fatalf("Failed to load x509: %s", err.Error())
 	}
 
-	tlsCfg := &tls.Config{Certificates: []tls.Certificate{crt}}
-	listener, err := tls.Listen("tcp", w.addr, tlsCfg)
+	w.listenAndServeTLS(&tls.Config{Certificates: []tls.Certificate{crt}})
+}
+
+func (w *WSAcceptor) listenAndServeTLS(tlsCfg *tls.Config) {
+	upgrader := w.newUpgrader()
+	tlsCfg.ClientAuth = w.clientAuth
+	tlsCfg.ClientCAs = w.clientCAs
+
+	listener, err := w.listen()
 	if err != nil {
 		logger.Log.Fatalf("Failed to listen: %s", err.Error())
 	}
-	w.listener = listener
-	w.serve(&upgrader)
+	w.listener = tls.NewListener(listener, tlsCfg)
+	w.running = true
+	w.serve(upgrader)
+}
+
+// newUpgrader builds the upgrader from the acceptor config, CheckOrigin
+// is left nil when no allowed origins are configured
+func (w *WSAcceptor) newUpgrader() *websocket.Upgrader {
+	upgrader := &websocket.Upgrader{
+		ReadBufferSize:    constants.IOBufferBytesSize,
+		WriteBufferSize:   constants.IOBufferBytesSize,
+		EnableCompression: w.config.Compression,
+		Subprotocols:      w.config.Subprotocols,
+	}
+	if len(w.config.AllowedOrigins) > 0 {
+		upgrader.CheckOrigin = newOriginChecker(w.config.AllowedOrigins)
+	}
+	return upgrader
 }
 
 func (w *WSAcceptor) serve(upgrader *websocket.Upgrader) {
 	defer w.Stop()
 
-	http.Serve(w.listener, &connHandler{
-		upgrader: upgrader,
-		connChan: w.connChan,
-	})
+	handler := &connHandler{
+		upgrader:         upgrader,
+		connChan:         w.connChan,
+		compressionLevel: w.config.CompressionLevel,
+		maxFrameSize:     w.config.MaxFrameSize,
+		maxPacketSize:    w.maxPacketSize,
+	}
+	if len(w.config.Paths) == 0 {
+		http.Serve(w.listener, handler)
+		return
+	}
+
+	mux := http.NewServeMux()
+	for _, p := range w.config.Paths {
+		mux.Handle(p, handler)
+	}
+	http.Serve(w.listener, mux)
+}
+
+// newOriginChecker returns a CheckOrigin func accepting the requests whose
+// Origin header matches one of the patterns, either as a whole or by its
+// host. Requests without an Origin header do not come from browsers and
+// are always accepted
+func newOriginChecker(patterns []string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		u, err := url.Parse(origin)
+		if err != nil {
+			return false
+		}
+		for _, pattern := range patterns {
+			if matchOrigin(pattern, origin) || matchOrigin(pattern, u.Host) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func matchOrigin(pattern, origin string) bool {
+	if pattern == "*" {
+		return true
+	}
+	matched, err := path.Match(pattern, origin)
+	return err == nil && matched
 }
 
 // Stop stops the acceptor
@@ -180,9 +333,12 @@ func (w *WSAcceptor) Stop() {
 // WSConn is an adapter to t.Conn, which implements all t.Conn
 // interface base on *websocket.Conn
 type WSConn struct {
-	conn   *websocket.Conn
-	typ    int // message type
-	reader io.Reader
+	conn          *websocket.Conn
+	typ           int // message type
+	reader        io.Reader
+	maxPacketSize int
+	readLimit     int64
+	packetSizeLimit
 }
 
 // NewWSConn return an initialized *WSConn
@@ -192,6 +348,43 @@ func NewWSConn(conn *websocket.Conn) (*WSConn, error) {
 	return c, nil
 }
 
+// ClientCertificate returns the verified client certificate when the
+// connection is using TLS
+func (c *WSConn) ClientCertificate() (*x509.Certificate, error) {
+	if tlsConn, ok := c.conn.UnderlyingConn().(*tls.Conn); ok {
+		return verifiedClientCertificate(tlsConn)
+	}
+	return nil, nil
+}
+
+// ProxyTLVs returns the TLVs sent in the PROXY protocol header, if the
+// acceptor has PROXY protocol enabled
+func (c *WSConn) ProxyTLVs() ProxyTLVs {
+	conn := c.conn.UnderlyingConn()
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	if proxyConn, ok := conn.(ProxyProtocolConn); ok {
+		return proxyConn.ProxyTLVs()
+	}
+	return nil
+}
+
+// SetMaxPacketSize sets the largest packet read from the connection, it
+// never raises the limit of the acceptor and zero restores it. The
+// websocket read limit is lowered too, so larger messages are not read
+func (c *WSConn) SetMaxPacketSize(size int) {
+	c.packetSizeLimit.SetMaxPacketSize(size)
+	limit := c.readLimit
+	if size > 0 {
+		packetLimit := int64(size + codec.LengthPrefixedHeadLength)
+		if limit <= 0 || packetLimit < limit {
+			limit = packetLimit
+		}
+	}
+	c.conn.SetReadLimit(limit)
+}
+
 // GetNextMessage reads the next message available in the stream
 func (c *WSConn) GetNextMessage() (b []byte, err error) {
 	_, msgBytes, err := c.conn.ReadMessage()
@@ -201,12 +394,19 @@ func (c *WSConn) GetNextMessage() (b []byte, err error) {
 	if len(msgBytes) < codec.HeadLength {
 		return nil, packet.ErrInvalidPomeloHeader
 	}
-	header := msgBytes[:codec.HeadLength]
-	msgSize, _, err := codec.ParseHeader(header)
+	headLength := codec.PacketHeadLength(msgBytes[0])
+	if len(msgBytes) < headLength {
+		return nil, packet.ErrInvalidPomeloHeader
+	}
+	header := msgBytes[:headLength]
+	msgSize, _, err := codec.ParsePacketHeader(header)
 	if err != nil {
 		return nil, err
 	}
-	dataLen := len(msgBytes[codec.HeadLength:])
+	if msgSize > c.limit(c.maxPacketSize) {
+		return nil, codec.ErrPacketSizeExcced
+	}
+	dataLen := len(msgBytes[headLength:])
 	if dataLen < msgSize {
 		return nil, constants.ErrReceivedMsgSmallerThanExpected
 	} else if dataLen > msgSize {
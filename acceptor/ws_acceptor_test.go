@@ -1,13 +1,17 @@
 package acceptor
 
 import (
+	"bytes"
 	"crypto/tls"
 	"fmt"
+	"net/http"
 	"testing"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
+	"github.com/topfreegames/pitaya/v2/config"
+	"github.com/topfreegames/pitaya/v2/conn/codec"
 	"github.com/topfreegames/pitaya/v2/conn/packet"
 	"github.com/topfreegames/pitaya/v2/constants"
 	"github.com/topfreegames/pitaya/v2/helpers"
@@ -222,6 +226,9 @@ func TestWSGetNextMessage(t *testing.T) {
 		{"valid_message", []byte{0x02, 0x00, 0x00, 0x01, 0x00}, nil},
 		{"invalid_message", []byte{0x02, 0x00, 0x00, 0x02, 0x00}, constants.ErrReceivedMsgSmallerThanExpected},
 		{"invalid_header", []byte{0x02, 0x00}, packet.ErrInvalidPomeloHeader},
+		{"length_prefixed_message", []byte{0x84, 0x00, 0x00, 0x00, 0x01, 0x00}, nil},
+		{"invalid_length_prefixed_header", []byte{0x84, 0x00, 0x00, 0x00}, packet.ErrInvalidPomeloHeader},
+		{"length_prefixed_message_too_large", []byte{0x84, 0x01, 0x00, 0x00, 0x01, 0x00}, codec.ErrPacketSizeExcced},
 	}
 
 	for _, table := range tables {
@@ -285,3 +292,217 @@ func TestWSGetNextMessageSequentially(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, msg2, msg)
 }
+
+func mustStartWSAcceptorWithConfig(t *testing.T, c config.WSAcceptorConfig) *WSAcceptor {
+	t.Helper()
+	w := NewWSAcceptorWithConfig("127.0.0.1:0", c)
+	go w.ListenAndServe()
+	helpers.ShouldEventuallyReturn(t, func() bool {
+		return w.GetAddr() != ""
+	}, true, 10*time.Millisecond, 100*time.Millisecond)
+	return w
+}
+
+func TestNewWSAcceptorWithConfig(t *testing.T) {
+	t.Parallel()
+	c := *config.NewDefaultWSAcceptorConfig()
+	c.Subprotocols = []string{"pitaya.v2"}
+	w := NewWSAcceptorWithConfig("127.0.0.1:0", c, "./fixtures/server.crt", "./fixtures/server.key")
+	assert.Equal(t, c, w.config)
+	assert.Equal(t, "./fixtures/server.crt", w.certFile)
+
+	w = NewWSAcceptor("127.0.0.1:0")
+	assert.Equal(t, *config.NewDefaultWSAcceptorConfig(), w.config)
+}
+
+func TestWSAcceptorCompression(t *testing.T) {
+	c := *config.NewDefaultWSAcceptorConfig()
+	c.Compression = true
+	c.CompressionLevel = 9
+	w := mustStartWSAcceptorWithConfig(t, c)
+	defer w.Stop()
+
+	dialer := &websocket.Dialer{EnableCompression: true}
+	conn, res, err := dialer.Dial(fmt.Sprintf("ws://%s", w.GetAddr()), nil)
+	assert.NoError(t, err)
+	defer conn.Close()
+	assert.Contains(t, res.Header.Get("Sec-Websocket-Extensions"), "permessage-deflate")
+
+	playerConn := helpers.ShouldEventuallyReceive(t, w.GetConnChan(), 100*time.Millisecond).(*WSConn)
+	data := bytes.Repeat([]byte{0x04, 0x00, 0x00, 0x00}, 256)
+	_, err = playerConn.Write(data)
+	assert.NoError(t, err)
+	_, msg, err := conn.ReadMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, data, msg)
+}
+
+func TestWSAcceptorSubprotocols(t *testing.T) {
+	c := *config.NewDefaultWSAcceptorConfig()
+	c.Subprotocols = []string{"pitaya.v2", "pitaya.v1"}
+	w := mustStartWSAcceptorWithConfig(t, c)
+	defer w.Stop()
+
+	tables := []struct {
+		name      string
+		requested []string
+		expected  string
+	}{
+		{"server_preference", []string{"pitaya.v1", "pitaya.v2"}, "pitaya.v2"},
+		{"single_match", []string{"pitaya.v1"}, "pitaya.v1"},
+		{"no_match", []string{"pitaya.v3"}, ""},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			dialer := &websocket.Dialer{Subprotocols: table.requested}
+			conn, _, err := dialer.Dial(fmt.Sprintf("ws://%s", w.GetAddr()), nil)
+			assert.NoError(t, err)
+			defer conn.Close()
+			assert.Equal(t, table.expected, conn.Subprotocol())
+
+			playerConn := helpers.ShouldEventuallyReceive(t, w.GetConnChan(), 100*time.Millisecond).(*WSConn)
+			assert.Equal(t, table.expected, playerConn.conn.Subprotocol())
+		})
+	}
+}
+
+func TestWSAcceptorAllowedOrigins(t *testing.T) {
+	c := *config.NewDefaultWSAcceptorConfig()
+	c.AllowedOrigins = []string{"*.example.com", "https://game.test"}
+	w := mustStartWSAcceptorWithConfig(t, c)
+	defer w.Stop()
+
+	tables := []struct {
+		name    string
+		origin  string
+		allowed bool
+	}{
+		{"no_origin", "", true},
+		{"wildcard_subdomain", "https://play.example.com", true},
+		{"wildcard_does_not_match_domain", "https://example.com", false},
+		{"exact_origin", "https://game.test", true},
+		{"exact_origin_other_scheme", "http://game.test", false},
+		{"unknown_origin", "https://evil.com", false},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			header := http.Header{}
+			if table.origin != "" {
+				header.Set("Origin", table.origin)
+			}
+			conn, _, err := websocket.DefaultDialer.Dial(fmt.Sprintf("ws://%s", w.GetAddr()), header)
+			if table.allowed {
+				assert.NoError(t, err)
+				defer conn.Close()
+				helpers.ShouldEventuallyReceive(t, w.GetConnChan(), 100*time.Millisecond)
+			} else {
+				assert.Equal(t, websocket.ErrBadHandshake, err)
+			}
+		})
+	}
+}
+
+func TestWSAcceptorPaths(t *testing.T) {
+	c := *config.NewDefaultWSAcceptorConfig()
+	c.Paths = []string{"/ws", "/v2/ws"}
+	w := mustStartWSAcceptorWithConfig(t, c)
+	defer w.Stop()
+
+	tables := []struct {
+		path    string
+		allowed bool
+	}{
+		{"/ws", true},
+		{"/v2/ws", true},
+		{"/", false},
+		{"/other", false},
+	}
+
+	for _, table := range tables {
+		t.Run(table.path, func(t *testing.T) {
+			conn, _, err := websocket.DefaultDialer.Dial(fmt.Sprintf("ws://%s%s", w.GetAddr(), table.path), nil)
+			if table.allowed {
+				assert.NoError(t, err)
+				defer conn.Close()
+				helpers.ShouldEventuallyReceive(t, w.GetConnChan(), 100*time.Millisecond)
+			} else {
+				assert.Equal(t, websocket.ErrBadHandshake, err)
+			}
+		})
+	}
+}
+
+func TestWSAcceptorMaxFrameSize(t *testing.T) {
+	c := *config.NewDefaultWSAcceptorConfig()
+	c.MaxFrameSize = 8
+	w := mustStartWSAcceptorWithConfig(t, c)
+	defer w.Stop()
+
+	conn, _, err := websocket.DefaultDialer.Dial(fmt.Sprintf("ws://%s", w.GetAddr()), nil)
+	assert.NoError(t, err)
+	defer conn.Close()
+	playerConn := helpers.ShouldEventuallyReceive(t, w.GetConnChan(), 100*time.Millisecond).(*WSConn)
+
+	msg := []byte{0x04, 0x00, 0x00, 0x01, 0x05}
+	assert.NoError(t, conn.WriteMessage(websocket.BinaryMessage, msg))
+	received, err := playerConn.GetNextMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, msg, received)
+
+	assert.NoError(t, conn.WriteMessage(websocket.BinaryMessage, []byte{0x04, 0x00, 0x00, 0x05, 0x01, 0x02, 0x03, 0x04, 0x05}))
+	_, err = playerConn.GetNextMessage()
+	assert.Equal(t, websocket.ErrReadLimit, err)
+}
+
+func TestWSAcceptorMaxPacketSize(t *testing.T) {
+	w := NewWSAcceptor("0.0.0.0:0")
+	w.SetMaxPacketSize(2)
+	go w.ListenAndServe()
+	defer w.Stop()
+	helpers.ShouldEventuallyReturn(t, func() bool {
+		return w.IsRunning()
+	}, true, 10*time.Millisecond, 100*time.Millisecond)
+
+	conn, _, err := websocket.DefaultDialer.Dial(fmt.Sprintf("ws://%s", w.GetAddr()), nil)
+	assert.NoError(t, err)
+	defer conn.Close()
+	playerConn := helpers.ShouldEventuallyReceive(t, w.GetConnChan(), 100*time.Millisecond).(*WSConn)
+
+	msg := []byte{0x04, 0x00, 0x00, 0x02, 0x01, 0x02}
+	assert.NoError(t, conn.WriteMessage(websocket.BinaryMessage, msg))
+	received, err := playerConn.GetNextMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, msg, received)
+
+	assert.NoError(t, conn.WriteMessage(websocket.BinaryMessage, []byte{0x04, 0x00, 0x00, 0x03, 0x01, 0x02, 0x03}))
+	_, err = playerConn.GetNextMessage()
+	assert.Equal(t, codec.ErrPacketSizeExcced, err)
+
+	assert.NoError(t, conn.WriteMessage(websocket.BinaryMessage, []byte{0x84, 0x00, 0x00, 0x00, 0x04, 0x01, 0x02, 0x03, 0x04}))
+	_, err = playerConn.GetNextMessage()
+	assert.Equal(t, websocket.ErrReadLimit, err)
+}
+
+func TestWSConnHandlerReadLimit(t *testing.T) {
+	tables := []struct {
+		name          string
+		maxFrameSize  int64
+		maxPacketSize int
+		limit         int64
+	}{
+		{"no_limits", 0, 0, 0},
+		{"frame_size", 100, 0, 100},
+		{"packet_size", 0, 100, 105},
+		{"smaller_frame_size", 50, 100, 50},
+		{"smaller_packet_size", 200, 100, 105},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			h := &connHandler{maxFrameSize: table.maxFrameSize, maxPacketSize: table.maxPacketSize}
+			assert.Equal(t, table.limit, h.readLimit())
+		})
+	}
+}
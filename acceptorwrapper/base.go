@@ -22,11 +22,14 @@ package acceptorwrapper
 
 import (
 	"github.com/topfreegames/pitaya/v2/acceptor"
+	"github.com/topfreegames/pitaya/v2/logger"
+	"github.com/topfreegames/pitaya/v2/metrics"
 )
 
 // BaseWrapper implements Wrapper by saving the acceptor as an attribute.
 // Conns from acceptor.GetConnChan are processed by wrapConn and
-// forwarded to its own connChan.
+// forwarded to its own connChan, unless wrapConn returns nil which drops
+// the conn.
 // Any new wrapper can inherit from BaseWrapper and just implement wrapConn.
 type BaseWrapper struct {
 	acceptor.Acceptor
@@ -56,6 +59,19 @@ func (b *BaseWrapper) GetConnChan() chan acceptor.PlayerConn {
 
 func (b *BaseWrapper) pipe() {
 	for conn := range b.Acceptor.GetConnChan() {
-		b.connChan <- b.wrapConn(conn)
+		if wrapped := b.wrapConn(conn); wrapped != nil {
+			b.connChan <- wrapped
+		}
 	}
 }
+
+// rejectConn closes conn and reports it as rejected by reason, always
+// returning nil so wrapConn can return it to drop the conn
+func rejectConn(reporters []metrics.Reporter, conn acceptor.PlayerConn, reason string, err error) acceptor.PlayerConn {
+	logger.Log.Warnf("Rejecting connection from %s, Reason=%s, Error=%s", conn.RemoteAddr(), reason, err)
+	metrics.ReportRejectedConnection(reporters, reason)
+	if err := conn.Close(); err != nil {
+		logger.Log.Debugf("Failed to close rejected connection: %s", err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+// Copyright (c) TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package acceptorwrapper
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/topfreegames/pitaya/v2/acceptor"
+	"github.com/topfreegames/pitaya/v2/config"
+	"github.com/topfreegames/pitaya/v2/constants"
+	"github.com/topfreegames/pitaya/v2/metrics"
+	"golang.org/x/time/rate"
+)
+
+// Reasons reported in the rejected connections metric
+const (
+	rejectReasonIP   = "ip"
+	rejectReasonCIDR = "cidr"
+	rejectReasonRate = "rate"
+)
+
+// ConnectionLimitingWrapper caps the number of concurrent connections
+// from the same IP and from the same CIDR, and the number of new
+// connections per second. Connections exceeding the limits are closed as
+// soon as they are accepted, before any data is read from them.
+// The IP is taken from the conn remote address, so it is the one sent in
+// the PROXY protocol header when the acceptor has it enabled. Connections
+// without an IP address, like unix sockets, are only limited by the rate
+type ConnectionLimitingWrapper struct {
+	BaseWrapper
+	reporters []metrics.Reporter
+	config    config.ConnectionLimitingConfig
+	limiter   *rate.Limiter
+	mutex     sync.Mutex
+	ipConns   map[string]int
+	cidrConns map[string]int
+}
+
+// NewConnectionLimitingWrapper returns an instance of *ConnectionLimitingWrapper
+func NewConnectionLimitingWrapper(reporters []metrics.Reporter, c config.ConnectionLimitingConfig) *ConnectionLimitingWrapper {
+	w := &ConnectionLimitingWrapper{
+		reporters: reporters,
+		config:    c,
+		ipConns:   map[string]int{},
+		cidrConns: map[string]int{},
+	}
+	if c.MaxNewPerSecond > 0 {
+		w.limiter = rate.NewLimiter(rate.Limit(c.MaxNewPerSecond), c.MaxNewPerSecond)
+	}
+
+	w.BaseWrapper = NewBaseWrapper(w.limitConn)
+
+	return w
+}
+
+// Wrap saves acceptor as an attribute
+func (w *ConnectionLimitingWrapper) Wrap(a acceptor.Acceptor) acceptor.Acceptor {
+	w.Acceptor = a
+	return w
+}
+
+func (w *ConnectionLimitingWrapper) limitConn(conn acceptor.PlayerConn) acceptor.PlayerConn {
+	if w.config.ForceDisable {
+		return conn
+	}
+
+	var ipKey, cidrKey string
+	if ip := remoteIP(conn.RemoteAddr()); ip != nil {
+		ipKey = ip.String()
+		cidrKey = w.cidr(ip)
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.config.MaxPerIP > 0 && ipKey != "" && w.ipConns[ipKey] >= w.config.MaxPerIP {
+		return w.reject(conn, rejectReasonIP)
+	}
+	if w.config.MaxPerCIDR > 0 && cidrKey != "" && w.cidrConns[cidrKey] >= w.config.MaxPerCIDR {
+		return w.reject(conn, rejectReasonCIDR)
+	}
+	if w.limiter != nil && !w.limiter.Allow() {
+		return w.reject(conn, rejectReasonRate)
+	}
+
+	if ipKey == "" {
+		return conn
+	}
+	w.ipConns[ipKey]++
+	w.cidrConns[cidrKey]++
+
+	return &limitedConn{
+		PlayerConn: conn,
+		release: func() {
+			w.release(ipKey, cidrKey)
+		},
+	}
+}
+
+func (w *ConnectionLimitingWrapper) reject(conn acceptor.PlayerConn, reason string) acceptor.PlayerConn {
+	return rejectConn(w.reporters, conn, reason, constants.ErrConnectionLimitExceeded)
+}
+
+func (w *ConnectionLimitingWrapper) release(ipKey, cidrKey string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.ipConns[ipKey]--; w.ipConns[ipKey] <= 0 {
+		delete(w.ipConns, ipKey)
+	}
+	if w.cidrConns[cidrKey]--; w.cidrConns[cidrKey] <= 0 {
+		delete(w.cidrConns, cidrKey)
+	}
+}
+
+// cidr returns the network of ip with the configured prefix length
+func (w *ConnectionLimitingWrapper) cidr(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return fmt.Sprintf("%s/%d", ip4.Mask(net.CIDRMask(w.config.IPv4CIDRPrefix, 8*net.IPv4len)), w.config.IPv4CIDRPrefix)
+	}
+	return fmt.Sprintf("%s/%d", ip.Mask(net.CIDRMask(w.config.IPv6CIDRPrefix, 8*net.IPv6len)), w.config.IPv6CIDRPrefix)
+}
+
+// remoteIP returns the IP of addr or nil if it is not an IP address
+func remoteIP(addr net.Addr) net.IP {
+	if addr == nil {
+		return nil
+	}
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+	return net.ParseIP(host)
+}
+
+// limitedConn releases its slot in the connection limits when closed
+type limitedConn struct {
+	acceptor.PlayerConn
+	closeOnce sync.Once
+	release   func()
+}
+
+// Close closes the wrapped connection and releases its slot
+func (c *limitedConn) Close() error {
+	c.closeOnce.Do(c.release)
+	return c.PlayerConn.Close()
+}
+
+// ClientCertificate returns the verified client certificate of the wrapped
+// connection
+func (c *limitedConn) ClientCertificate() (*x509.Certificate, error) {
+	return acceptor.GetClientCertificate(c.PlayerConn)
+}
+
+// ProxyTLVs returns the PROXY protocol TLVs of the wrapped connection
+func (c *limitedConn) ProxyTLVs() acceptor.ProxyTLVs {
+	return acceptor.GetProxyTLVs(c.PlayerConn)
+}
+
+// Unwrap returns the wrapped connection
+func (c *limitedConn) Unwrap() acceptor.PlayerConn {
+	return c.PlayerConn
+}
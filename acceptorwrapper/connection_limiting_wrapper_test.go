@@ -0,0 +1,186 @@
+// Copyright (c) TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package acceptorwrapper
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/topfreegames/pitaya/v2/acceptor"
+	"github.com/topfreegames/pitaya/v2/config"
+	"github.com/topfreegames/pitaya/v2/helpers"
+	"github.com/topfreegames/pitaya/v2/metrics"
+	metricsmocks "github.com/topfreegames/pitaya/v2/metrics/mocks"
+	"github.com/topfreegames/pitaya/v2/mocks"
+)
+
+func newMockConnFrom(ctrl *gomock.Controller, addr string) *mocks.MockPlayerConn {
+	mockConn := mocks.NewMockPlayerConn(ctrl)
+	tcpAddr, _ := net.ResolveTCPAddr("tcp", addr)
+	mockConn.EXPECT().RemoteAddr().Return(tcpAddr).AnyTimes()
+	return mockConn
+}
+
+func TestNewConnectionLimitingWrapper(t *testing.T) {
+	t.Parallel()
+
+	w := NewConnectionLimitingWrapper(nil, *config.NewDefaultConnectionLimitingConfig())
+	assert.Nil(t, w.limiter)
+	assert.NotNil(t, w.wrapConn)
+
+	c := config.NewDefaultConnectionLimitingConfig()
+	c.MaxNewPerSecond = 10
+	w = NewConnectionLimitingWrapper(nil, *c)
+	assert.NotNil(t, w.limiter)
+}
+
+func TestConnectionLimitingWrapperLimitConn(t *testing.T) {
+	t.Parallel()
+
+	tables := []struct {
+		name     string
+		config   func(c *config.ConnectionLimitingConfig)
+		addrs    []string
+		rejected map[int]string
+	}{
+		{"no_limits", func(c *config.ConnectionLimitingConfig) {}, []string{"10.0.0.1:1", "10.0.0.1:2", "10.0.0.1:3"}, nil},
+		{"max_per_ip", func(c *config.ConnectionLimitingConfig) { c.MaxPerIP = 2 }, []string{"10.0.0.1:1", "10.0.0.1:2", "10.0.0.1:3", "10.0.0.2:1"}, map[int]string{2: "ip"}},
+		{"max_per_ipv4_cidr", func(c *config.ConnectionLimitingConfig) { c.MaxPerCIDR = 2 }, []string{"10.0.0.1:1", "10.0.0.2:1", "10.0.0.3:1", "10.0.1.1:1"}, map[int]string{2: "cidr"}},
+		{"max_per_ipv6_cidr", func(c *config.ConnectionLimitingConfig) { c.MaxPerCIDR = 1 }, []string{"[2001:db8::1]:1", "[2001:db8::2]:1", "[2001:db8:0:1::1]:1"}, map[int]string{1: "cidr"}},
+		{"max_new_per_second", func(c *config.ConnectionLimitingConfig) { c.MaxNewPerSecond = 2 }, []string{"10.0.0.1:1", "10.0.0.2:1", "10.0.0.3:1"}, map[int]string{2: "rate"}},
+		{"force_disable", func(c *config.ConnectionLimitingConfig) { c.MaxPerIP = 1; c.ForceDisable = true }, []string{"10.0.0.1:1", "10.0.0.1:2"}, nil},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockReporter := metricsmocks.NewMockReporter(ctrl)
+			c := config.NewDefaultConnectionLimitingConfig()
+			table.config(c)
+			w := NewConnectionLimitingWrapper([]metrics.Reporter{mockReporter}, *c)
+
+			for i, addr := range table.addrs {
+				mockConn := newMockConnFrom(ctrl, addr)
+				reason, rejected := table.rejected[i]
+				if rejected {
+					mockConn.EXPECT().Close()
+					mockReporter.EXPECT().ReportCount(metrics.RejectedConnections, map[string]string{"reason": reason}, float64(1))
+					assert.Nil(t, w.wrapConn(mockConn))
+				} else {
+					assert.NotNil(t, w.wrapConn(mockConn))
+				}
+			}
+		})
+	}
+}
+
+func TestConnectionLimitingWrapperRelease(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c := config.NewDefaultConnectionLimitingConfig()
+	c.MaxPerIP = 1
+	c.MaxPerCIDR = 1
+	w := NewConnectionLimitingWrapper(nil, *c)
+
+	mockConn := newMockConnFrom(ctrl, "10.0.0.1:1")
+	conn := w.wrapConn(mockConn)
+	assert.NotNil(t, conn)
+	assert.Equal(t, map[string]int{"10.0.0.1": 1}, w.ipConns)
+	assert.Equal(t, map[string]int{"10.0.0.0/24": 1}, w.cidrConns)
+
+	// closing twice must release the slot only once
+	mockConn.EXPECT().Close().Times(2)
+	assert.NoError(t, conn.Close())
+	assert.NoError(t, conn.Close())
+	assert.Empty(t, w.ipConns)
+	assert.Empty(t, w.cidrConns)
+
+	assert.NotNil(t, w.wrapConn(newMockConnFrom(ctrl, "10.0.0.1:2")))
+}
+
+func TestRemoteIP(t *testing.T) {
+	t.Parallel()
+
+	tables := []struct {
+		name string
+		addr net.Addr
+		ip   net.IP
+	}{
+		{"nil", nil, nil},
+		{"tcp", &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1}, net.ParseIP("10.0.0.1")},
+		{"udp", &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 1}, net.ParseIP("2001:db8::1")},
+		{"unix", &net.UnixAddr{Name: "/tmp/pitaya.sock", Net: "unix"}, nil},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			assert.Equal(t, table.ip, remoteIP(table.addr))
+		})
+	}
+}
+
+func TestConnectionLimitingWrapperProxyProtocol(t *testing.T) {
+	c := config.NewDefaultConnectionLimitingConfig()
+	c.MaxPerIP = 1
+	tcpAcceptor := acceptor.NewTCPAcceptor("127.0.0.1:0")
+	tcpAcceptor.EnableProxyProtocol()
+	a := WithWrappers(tcpAcceptor, NewConnectionLimitingWrapper(nil, *c))
+	go a.ListenAndServe()
+	defer a.Stop()
+	helpers.ShouldEventuallyReturn(t, func() bool {
+		return a.GetAddr() != ""
+	}, true, 10*time.Millisecond, 100*time.Millisecond)
+
+	dial := func(source string) net.Conn {
+		conn, err := net.Dial("tcp", a.GetAddr())
+		assert.NoError(t, err)
+		_, err = conn.Write([]byte("PROXY TCP4 " + source + " 10.3.2.1 4321 1234\r\n"))
+		assert.NoError(t, err)
+		return conn
+	}
+
+	conn1 := dial("10.1.2.3")
+	defer conn1.Close()
+	playerConn := helpers.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(acceptor.PlayerConn)
+	assert.Equal(t, "10.1.2.3:4321", playerConn.RemoteAddr().String())
+
+	// same proxied source, closed by the wrapper
+	conn2 := dial("10.1.2.3")
+	defer conn2.Close()
+	conn2.SetReadDeadline(time.Now().Add(time.Second))
+	_, err := conn2.Read(make([]byte, 1))
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, os.ErrDeadlineExceeded)
+
+	conn3 := dial("10.1.2.4")
+	defer conn3.Close()
+	playerConn = helpers.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(acceptor.PlayerConn)
+	assert.Equal(t, "10.1.2.4:4321", playerConn.RemoteAddr().String())
+}
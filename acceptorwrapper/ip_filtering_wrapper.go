@@ -0,0 +1,151 @@
+// Copyright (c) TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package acceptorwrapper
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/topfreegames/pitaya/v2/acceptor"
+	"github.com/topfreegames/pitaya/v2/config"
+	"github.com/topfreegames/pitaya/v2/constants"
+	"github.com/topfreegames/pitaya/v2/metrics"
+)
+
+// rejectReasonIPFilter is the reason reported in the rejected connections
+// metric for connections not allowed by the ip filtering
+const rejectReasonIPFilter = "ipfilter"
+
+// IPFilteringWrapper rejects the connections not allowed by its CIDR
+// rules before they reach the handler service. Deny rules take precedence
+// over allow rules and, when there are allow rules, only the connections
+// matching one of them are accepted.
+// The IP is taken from the conn remote address, so it is the one sent in
+// the PROXY protocol header when the acceptor has it enabled. Connections
+// without an IP address, like unix sockets, are always accepted.
+// The rules can be replaced at runtime with Reload, which only affects the
+// connections accepted afterwards
+type IPFilteringWrapper struct {
+	BaseWrapper
+	reporters    []metrics.Reporter
+	mutex        sync.RWMutex
+	allow        []*net.IPNet
+	deny         []*net.IPNet
+	forceDisable bool
+}
+
+// NewIPFilteringWrapper returns an instance of *IPFilteringWrapper or an
+// error if any of the rules is invalid
+func NewIPFilteringWrapper(reporters []metrics.Reporter, c config.IPFilteringConfig) (*IPFilteringWrapper, error) {
+	w := &IPFilteringWrapper{reporters: reporters}
+	if err := w.Reload(c); err != nil {
+		return nil, err
+	}
+
+	w.BaseWrapper = NewBaseWrapper(w.filterConn)
+
+	return w, nil
+}
+
+// Wrap saves acceptor as an attribute
+func (w *IPFilteringWrapper) Wrap(a acceptor.Acceptor) acceptor.Acceptor {
+	w.Acceptor = a
+	return w
+}
+
+// Reload replaces the rules with the ones in c, the current rules are kept
+// if any of the new ones is invalid
+func (w *IPFilteringWrapper) Reload(c config.IPFilteringConfig) error {
+	allow, err := parseIPRules(c.Allow)
+	if err != nil {
+		return err
+	}
+	deny, err := parseIPRules(c.Deny)
+	if err != nil {
+		return err
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.allow = allow
+	w.deny = deny
+	w.forceDisable = c.ForceDisable
+	return nil
+}
+
+// IsAllowed returns whether a connection from ip is accepted by the rules
+func (w *IPFilteringWrapper) IsAllowed(ip net.IP) bool {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+
+	if w.forceDisable {
+		return true
+	}
+	if containsIP(w.deny, ip) {
+		return false
+	}
+	return len(w.allow) == 0 || containsIP(w.allow, ip)
+}
+
+func (w *IPFilteringWrapper) filterConn(conn acceptor.PlayerConn) acceptor.PlayerConn {
+	ip := remoteIP(conn.RemoteAddr())
+	if ip == nil || w.IsAllowed(ip) {
+		return conn
+	}
+	return rejectConn(w.reporters, conn, rejectReasonIPFilter, constants.ErrConnectionNotAllowed)
+}
+
+// parseIPRules parses CIDRs and bare IPs, which match only themselves
+func parseIPRules(rules []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(rules))
+	for _, rule := range rules {
+		rule = strings.TrimSpace(rule)
+		if !strings.Contains(rule, "/") {
+			ip := net.ParseIP(rule)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid ip filtering rule %q", rule)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(rule)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ip filtering rule %q: %w", rule, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
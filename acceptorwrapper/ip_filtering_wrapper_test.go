@@ -0,0 +1,156 @@
+// Copyright (c) TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package acceptorwrapper
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/topfreegames/pitaya/v2/acceptor"
+	"github.com/topfreegames/pitaya/v2/config"
+	"github.com/topfreegames/pitaya/v2/helpers"
+	"github.com/topfreegames/pitaya/v2/metrics"
+	metricsmocks "github.com/topfreegames/pitaya/v2/metrics/mocks"
+	"github.com/topfreegames/pitaya/v2/mocks"
+)
+
+func TestNewIPFilteringWrapper(t *testing.T) {
+	t.Parallel()
+
+	w, err := NewIPFilteringWrapper(nil, *config.NewDefaultIPFilteringConfig())
+	assert.NoError(t, err)
+	assert.NotNil(t, w.wrapConn)
+	assert.True(t, w.IsAllowed(net.ParseIP("10.0.0.1")))
+
+	_, err = NewIPFilteringWrapper(nil, config.IPFilteringConfig{Deny: []string{"10.0.0.0/33"}})
+	assert.Error(t, err)
+	_, err = NewIPFilteringWrapper(nil, config.IPFilteringConfig{Allow: []string{"office"}})
+	assert.Error(t, err)
+}
+
+func TestIPFilteringWrapperIsAllowed(t *testing.T) {
+	t.Parallel()
+
+	tables := []struct {
+		name    string
+		config  config.IPFilteringConfig
+		ip      string
+		allowed bool
+	}{
+		{"deny_cidr", config.IPFilteringConfig{Deny: []string{"10.0.0.0/8"}}, "10.1.2.3", false},
+		{"deny_other_cidr", config.IPFilteringConfig{Deny: []string{"10.0.0.0/8"}}, "192.168.0.1", true},
+		{"deny_ip", config.IPFilteringConfig{Deny: []string{"10.1.2.3"}}, "10.1.2.3", false},
+		{"deny_other_ip", config.IPFilteringConfig{Deny: []string{"10.1.2.3"}}, "10.1.2.4", true},
+		{"allow_cidr", config.IPFilteringConfig{Allow: []string{"192.168.0.0/16"}}, "192.168.10.1", true},
+		{"not_in_allow", config.IPFilteringConfig{Allow: []string{"192.168.0.0/16"}}, "10.1.2.3", false},
+		{"deny_wins", config.IPFilteringConfig{Allow: []string{"192.168.0.0/16"}, Deny: []string{"192.168.10.0/24"}}, "192.168.10.1", false},
+		{"allow_ipv6", config.IPFilteringConfig{Allow: []string{"2001:db8::/32"}}, "2001:db8::1", true},
+		{"deny_ipv6", config.IPFilteringConfig{Deny: []string{"2001:db8::1"}}, "2001:db8::1", false},
+		{"ipv4_not_in_ipv6_allow", config.IPFilteringConfig{Allow: []string{"2001:db8::/32"}}, "10.1.2.3", false},
+		{"force_disable", config.IPFilteringConfig{Deny: []string{"0.0.0.0/0"}, ForceDisable: true}, "10.1.2.3", true},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			w, err := NewIPFilteringWrapper(nil, table.config)
+			assert.NoError(t, err)
+			assert.Equal(t, table.allowed, w.IsAllowed(net.ParseIP(table.ip)))
+		})
+	}
+}
+
+func TestIPFilteringWrapperReload(t *testing.T) {
+	t.Parallel()
+
+	w, err := NewIPFilteringWrapper(nil, config.IPFilteringConfig{Deny: []string{"10.0.0.0/8"}})
+	assert.NoError(t, err)
+	assert.False(t, w.IsAllowed(net.ParseIP("10.1.2.3")))
+
+	// invalid rules keep the current ones
+	assert.Error(t, w.Reload(config.IPFilteringConfig{Deny: []string{"192.168.0.0/16", "invalid"}}))
+	assert.False(t, w.IsAllowed(net.ParseIP("10.1.2.3")))
+	assert.True(t, w.IsAllowed(net.ParseIP("192.168.0.1")))
+
+	assert.NoError(t, w.Reload(config.IPFilteringConfig{Deny: []string{"192.168.0.0/16"}}))
+	assert.True(t, w.IsAllowed(net.ParseIP("10.1.2.3")))
+	assert.False(t, w.IsAllowed(net.ParseIP("192.168.0.1")))
+}
+
+func TestIPFilteringWrapperFilterConn(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockReporter := metricsmocks.NewMockReporter(ctrl)
+	w, err := NewIPFilteringWrapper([]metrics.Reporter{mockReporter}, config.IPFilteringConfig{Allow: []string{"192.168.0.0/16"}})
+	assert.NoError(t, err)
+
+	allowedConn := newMockConnFrom(ctrl, "192.168.0.1:1")
+	assert.Equal(t, allowedConn, w.wrapConn(allowedConn))
+
+	unixConn := mocks.NewMockPlayerConn(ctrl)
+	unixConn.EXPECT().RemoteAddr().Return(&net.UnixAddr{Name: "@", Net: "unix"})
+	assert.Equal(t, unixConn, w.wrapConn(unixConn))
+
+	deniedConn := newMockConnFrom(ctrl, "10.1.2.3:1")
+	deniedConn.EXPECT().Close()
+	mockReporter.EXPECT().ReportCount(metrics.RejectedConnections, map[string]string{"reason": "ipfilter"}, float64(1))
+	assert.Nil(t, w.wrapConn(deniedConn))
+}
+
+func TestIPFilteringWrapperProxyProtocol(t *testing.T) {
+	w, err := NewIPFilteringWrapper(nil, config.IPFilteringConfig{Deny: []string{"10.1.2.0/24"}})
+	assert.NoError(t, err)
+	tcpAcceptor := acceptor.NewTCPAcceptor("127.0.0.1:0")
+	tcpAcceptor.EnableProxyProtocol()
+	a := WithWrappers(tcpAcceptor, w)
+	go a.ListenAndServe()
+	defer a.Stop()
+	helpers.ShouldEventuallyReturn(t, func() bool {
+		return a.GetAddr() != ""
+	}, true, 10*time.Millisecond, 100*time.Millisecond)
+
+	dial := func(source string) net.Conn {
+		conn, err := net.Dial("tcp", a.GetAddr())
+		assert.NoError(t, err)
+		_, err = conn.Write([]byte("PROXY TCP4 " + source + " 10.3.2.1 4321 1234\r\n"))
+		assert.NoError(t, err)
+		return conn
+	}
+
+	// the connection comes from 127.0.0.1 but the proxied source is denied
+	deniedConn := dial("10.1.2.3")
+	defer deniedConn.Close()
+	deniedConn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = deniedConn.Read(make([]byte, 1))
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, os.ErrDeadlineExceeded)
+
+	allowedConn := dial("10.1.3.3")
+	defer allowedConn.Close()
+	playerConn := helpers.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(acceptor.PlayerConn)
+	assert.Equal(t, "10.1.3.3:4321", playerConn.RemoteAddr().String())
+}
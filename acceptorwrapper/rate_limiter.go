@@ -22,6 +22,7 @@ package acceptorwrapper
 
 import (
 	"container/list"
+	"crypto/x509"
 	"time"
 
 	"github.com/topfreegames/pitaya/v2/acceptor"
@@ -92,6 +93,22 @@ func (r *RateLimiter) GetNextMessage() (msg []byte, err error) {
 	}
 }
 
+// ClientCertificate returns the verified client certificate of the wrapped
+// connection
+func (r *RateLimiter) ClientCertificate() (*x509.Certificate, error) {
+	return acceptor.GetClientCertificate(r.PlayerConn)
+}
+
+// ProxyTLVs returns the PROXY protocol TLVs of the wrapped connection
+func (r *RateLimiter) ProxyTLVs() acceptor.ProxyTLVs {
+	return acceptor.GetProxyTLVs(r.PlayerConn)
+}
+
+// Unwrap returns the wrapped connection
+func (r *RateLimiter) Unwrap() acceptor.PlayerConn {
+	return r.PlayerConn
+}
+
 // shouldRateLimit saves the now as time taken or returns an error if
 // in the limit of rate limiting
 func (r *RateLimiter) shouldRateLimit(now time.Time) bool {
@@ -0,0 +1,58 @@
+// Copyright (c) TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package acceptorwrapper
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topfreegames/pitaya/v2/acceptor"
+	"github.com/topfreegames/pitaya/v2/config"
+	"github.com/topfreegames/pitaya/v2/conn/codec"
+	"github.com/topfreegames/pitaya/v2/helpers"
+)
+
+func TestWithWrappersLimitPacketSize(t *testing.T) {
+	a := WithWrappers(
+		acceptor.NewTCPAcceptor("127.0.0.1:0"),
+		NewConnectionLimitingWrapper(nil, *config.NewDefaultConnectionLimitingConfig()),
+		NewRateLimitingWrapper(nil, *config.NewDefaultRateLimitingConfig()),
+	)
+	go a.ListenAndServe()
+	defer a.Stop()
+	helpers.ShouldEventuallyReturn(t, func() bool {
+		return a.GetAddr() != ""
+	}, true, 10*time.Millisecond, 100*time.Millisecond)
+
+	conn, err := net.Dial("tcp", a.GetAddr())
+	assert.NoError(t, err)
+	defer conn.Close()
+	playerConn := helpers.ShouldEventuallyReceive(t, a.GetConnChan(), 100*time.Millisecond).(acceptor.PlayerConn)
+
+	// the limit reaches the tcp conn through both wrappers
+	assert.True(t, acceptor.LimitPacketSize(playerConn, 4))
+	_, err = conn.Write([]byte{0x04, 0x00, 0x00, 0x05, 0x01, 0x02, 0x03, 0x04, 0x05})
+	assert.NoError(t, err)
+	_, err = playerConn.GetNextMessage()
+	assert.ErrorIs(t, err, codec.ErrPacketSizeExcced)
+}
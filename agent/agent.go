@@ -53,9 +53,17 @@ var (
 	hbd []byte
 	// hrd contains the handshake response data
 	hrd []byte
+	// hrdDictionary is the route dictionary sent in hrd
+	hrdDictionary *message.Dictionary
 	// herd contains the handshake error response data
 	herd []byte
 	once sync.Once
+	// writeBuffers keeps the buffers where the coalesced packets are joined
+	writeBuffers = sync.Pool{
+		New: func() interface{} {
+			return new([]byte)
+		},
+	}
 )
 
 const handlerType = "handler"
@@ -70,16 +78,27 @@ type (
 		chStopHeartbeat    chan struct{}     // stop heartbeats
 		chStopWrite        chan struct{}     // stop writing messages
 		closeMutex         sync.Mutex
+		codecMutex         sync.Mutex          // guards the codecs switched in the handshake and orders the sealed packets
 		conn               net.Conn            // low-level conn fd
 		decoder            codec.PacketDecoder // binary decoder
 		encoder            codec.PacketEncoder // binary encoder
+		codecEncoder       codec.PacketEncoder // encoder the clients can request after the handshake, nil if it is the pomelo one
+		heartbeatPacket    []byte              // heartbeat in the negotiated codec, nil if it is the pomelo one
 		heartbeatTimeout   time.Duration
 		lastAt             int64 // last heartbeat unix time stamp
 		messageEncoder     message.Encoder
 		messagesBufferSize int // size of the pending messages buffer
 		metricsReporters   []metrics.Reporter
-		serializer         serialize.Serializer // message serializer
-		state              int32                // current agent state
+		serializer         serialize.Serializer   // message serializer
+		state              int32                  // current agent state
+		writeMaxBytes      int                    // max bytes of the coalesced packets, zero disables coalescing
+		writeFlushDelay    time.Duration          // max time waiting for more packets to coalesce
+		ciphers            []string               // ciphers negotiated with the clients, none disables encryption
+		sequenceWindow     int                    // size of the replay window, zero disables sequence numbers
+		replayWindow       *replayWindow          // sequence numbers received, nil when they were not negotiated
+		protocolVersion    int                    // protocol version negotiated in the handshake
+		compression        string                 // compression algorithm negotiated in the handshake, empty if none
+		serializers        []serialize.Serializer // serializers the clients can request besides the default one
 	}
 
 	pendingMessage struct {
@@ -117,6 +136,49 @@ type (
 		AnswerWithError(ctx context.Context, mid uint, err error)
 	}
 
+	// PacketDecoderAgent is implemented by the agents that decode the packets
+	// of their clients with a decoder of their own, such as the one opening
+	// the sealed packets after encryption is negotiated
+	PacketDecoderAgent interface {
+		GetPacketDecoder() codec.PacketDecoder
+	}
+
+	// SequenceAgent is implemented by the agents that can negotiate sequence
+	// numbers in the messages sent by their clients
+	SequenceAgent interface {
+		// HasSequence returns true if the session negotiated sequence
+		// numbers, only then the messages are decoded with them
+		HasSequence() bool
+		// CheckSequence returns an error if the session negotiated sequence
+		// numbers and seq was already received, is older than the replay
+		// window or is missing
+		CheckSequence(seq uint64) error
+	}
+
+	// ProtocolVersionAgent is implemented by the agents that negotiate the
+	// protocol version of the messages with their clients
+	ProtocolVersionAgent interface {
+		// GetProtocolVersion returns the protocol version negotiated in the
+		// handshake, which is message.ProtocolVersion1 before it
+		GetProtocolVersion() int
+	}
+
+	// CompressionAgent is implemented by the agents that negotiate the
+	// compression algorithm of the messages with their clients
+	CompressionAgent interface {
+		// GetCompression returns the compression algorithm negotiated in
+		// the handshake, which is empty when there is none
+		GetCompression() string
+	}
+
+	// SerializerAgent is implemented by the agents that negotiate the
+	// serializer of the messages with their clients
+	SerializerAgent interface {
+		// GetSerializer returns the serializer of the messages exchanged
+		// with the client
+		GetSerializer() serialize.Serializer
+	}
+
 	// AgentFactory factory for creating Agent instances
 	AgentFactory interface {
 		CreateAgent(conn net.Conn) Agent
@@ -132,9 +194,59 @@ type (
 		messagesBufferSize int // size of the pending messages buffer
 		metricsReporters   []metrics.Reporter
 		serializer         serialize.Serializer // message serializer
+		writeMaxBytes      int
+		writeFlushDelay    time.Duration
+		ciphers            []string
+		sequenceWindow     int
+		serializers        []serialize.Serializer
 	}
+
+	// AgentFactoryOption configures the agents created by the factory
+	AgentFactoryOption func(f *agentFactoryImpl)
 )
 
+// WithEncryption makes the agents seal the packets of the clients that
+// advertise any of the ciphers in the handshake, the first of them supported
+// by the client is used. The keys of each session come from an X25519 key
+// exchange done in the handshake, which is not authenticated: it only
+// protects against passive eavesdropping, someone able to change the
+// handshake can impersonate the server, so it does not replace TLS
+func WithEncryption(ciphers []string) AgentFactoryOption {
+	return func(f *agentFactoryImpl) {
+		f.ciphers = ciphers
+	}
+}
+
+// WithReplayProtection makes the agents negotiate sequence numbers with the
+// clients that advertise them in the handshake, their messages are rejected
+// when the sequence number was already received or is older than the last
+// window ones. A window that is not positive disables it
+func WithReplayProtection(window int) AgentFactoryOption {
+	return func(f *agentFactoryImpl) {
+		f.sequenceWindow = window
+	}
+}
+
+// WithSerializers makes the agents switch to one of the serializers when the
+// client requests it by name in the handshake, the factory serializer is
+// used for the other clients
+func WithSerializers(serializers ...serialize.Serializer) AgentFactoryOption {
+	return func(f *agentFactoryImpl) {
+		f.serializers = serializers
+	}
+}
+
+// WithWriteCoalescing makes the agents join the queued packets in a single
+// write to the conn, up to maxBytes, waiting at most flushDelay for more
+// packets after the first one. A zero flushDelay only joins the packets
+// already queued, so it never delays a write
+func WithWriteCoalescing(maxBytes int, flushDelay time.Duration) AgentFactoryOption {
+	return func(f *agentFactoryImpl) {
+		f.writeMaxBytes = maxBytes
+		f.writeFlushDelay = flushDelay
+	}
+}
+
 // NewAgentFactory ctor
 func NewAgentFactory(
 	appDieChan chan bool,
@@ -146,8 +258,9 @@ func NewAgentFactory(
 	messagesBufferSize int,
 	sessionPool session.SessionPool,
 	metricsReporters []metrics.Reporter,
+	opts ...AgentFactoryOption,
 ) AgentFactory {
-	return &agentFactoryImpl{
+	f := &agentFactoryImpl{
 		appDieChan:         appDieChan,
 		decoder:            decoder,
 		encoder:            encoder,
@@ -158,11 +271,21 @@ func NewAgentFactory(
 		metricsReporters:   metricsReporters,
 		serializer:         serializer,
 	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
 }
 
 // CreateAgent returns a new agent
 func (f *agentFactoryImpl) CreateAgent(conn net.Conn) Agent {
-	return newAgent(conn, f.decoder, f.encoder, f.serializer, f.heartbeatTimeout, f.messagesBufferSize, f.appDieChan, f.messageEncoder, f.metricsReporters, f.sessionPool)
+	a := newAgent(conn, f.decoder, f.encoder, f.serializer, f.heartbeatTimeout, f.messagesBufferSize, f.appDieChan, f.messageEncoder, f.metricsReporters, f.sessionPool).(*agentImpl)
+	a.writeMaxBytes = f.writeMaxBytes
+	a.writeFlushDelay = f.writeFlushDelay
+	a.ciphers = f.ciphers
+	a.sequenceWindow = f.sequenceWindow
+	a.serializers = f.serializers
+	return a
 }
 
 // NewAgent create new agent instance
@@ -178,12 +301,21 @@ func newAgent(
 	metricsReporters []metrics.Reporter,
 	sessionPool session.SessionPool,
 ) Agent {
+	// the handshake is always in the pomelo codec, the configured one is
+	// used only with the clients requesting it
+	var codecEncoder codec.PacketEncoder
+	if codec.GetPacketCodecName(packetEncoder) != codec.PomeloPacketCodec {
+		codecEncoder = packetEncoder
+		packetEncoder = codec.NewPomeloPacketEncoder()
+	}
+
 	// initialize heartbeat and handshake data on first user connection
 	serializerName := serializer.GetName()
 
 	once.Do(func() {
-		hbdEncode(heartbeatTime, packetEncoder, messageEncoder.IsCompressionEnabled(), serializerName)
-		herdEncode(heartbeatTime, packetEncoder, messageEncoder.IsCompressionEnabled(), serializerName)
+		dictionary := message.GetEncoderDictionary(messageEncoder)
+		hbdEncode(heartbeatTime, packetEncoder, messageEncoder.IsCompressionEnabled(), serializerName, dictionary)
+		herdEncode(heartbeatTime, packetEncoder, messageEncoder.IsCompressionEnabled(), serializerName, dictionary)
 	})
 
 	a := &agentImpl{
@@ -196,6 +328,7 @@ func newAgent(
 		conn:               conn,
 		decoder:            packetDecoder,
 		encoder:            packetEncoder,
+		codecEncoder:       codecEncoder,
 		heartbeatTimeout:   heartbeatTime,
 		lastAt:             time.Now().Unix(),
 		serializer:         serializer,
@@ -260,6 +393,11 @@ func (a *agentImpl) send(pendingMsg pendingMessage) (err error) {
 		return err
 	}
 
+	// the packet is queued before the lock is released, so the packets
+	// sealed by an encrypted encoder are written in the order of their nonces
+	a.codecMutex.Lock()
+	defer a.codecMutex.Unlock()
+
 	// packet encode
 	p, err := a.packetEncodeMessage(m)
 	if err != nil {
@@ -380,7 +518,9 @@ func (a *agentImpl) GetStatus() int32 {
 // Kick sends a kick packet to a client
 func (a *agentImpl) Kick(ctx context.Context) error {
 	// packet encode
+	a.codecMutex.Lock()
 	p, err := a.encoder.Encode(packet.Kick, nil)
+	a.codecMutex.Unlock()
 	if err != nil {
 		return err
 	}
@@ -444,12 +584,7 @@ func (a *agentImpl) heartbeat() {
 				return
 			}
 
-			// chSend is never closed so we need this to don't block if agent is already closed
-			select {
-			case a.chSend <- pendingWrite{data: hbd}:
-			case <-a.chDie:
-				return
-			case <-a.chStopHeartbeat:
+			if !a.sendHeartbeat() {
 				return
 			}
 		case <-a.chDie:
@@ -460,6 +595,42 @@ func (a *agentImpl) heartbeat() {
 	}
 }
 
+// sendHeartbeat queues a heartbeat packet, it returns false if the agent
+// was closed or its heartbeats stopped
+func (a *agentImpl) sendHeartbeat() bool {
+	// the packet is queued before the lock is released, as in send
+	a.codecMutex.Lock()
+	defer a.codecMutex.Unlock()
+
+	data, err := a.heartbeatData()
+	if err != nil {
+		logger.Log.Errorf("Failed to encode heartbeat packet, SessionID=%d, Error=%s", a.Session.ID(), err.Error())
+		return false
+	}
+
+	// chSend is never closed so we need this to don't block if agent is already closed
+	select {
+	case a.chSend <- pendingWrite{data: data}:
+		return true
+	case <-a.chDie:
+	case <-a.chStopHeartbeat:
+	}
+	return false
+}
+
+// heartbeatData returns the heartbeat packet in the codec negotiated with
+// the client, the sealed ones are encoded each time since their nonces
+// differ. It must be called with codecMutex locked
+func (a *agentImpl) heartbeatData() ([]byte, error) {
+	if _, ok := a.encoder.(*codec.EncryptedPacketEncoder); ok {
+		return a.encoder.Encode(packet.Heartbeat, nil)
+	}
+	if a.heartbeatPacket != nil {
+		return a.heartbeatPacket, nil
+	}
+	return hbd, nil
+}
+
 func (a *agentImpl) onSessionClosed(s session.Session) {
 	defer func() {
 		if err := recover(); err != nil {
@@ -478,11 +649,184 @@ func (a *agentImpl) onSessionClosed(s session.Session) {
 
 // SendHandshakeResponse sends a handshake response
 func (a *agentImpl) SendHandshakeResponse() error {
-	_, err := a.conn.Write(hrd)
+	response, err := a.negotiate()
+	if e.Is(err, constants.ErrProtocolVersionNotSupported) {
+		if serr := a.SendHandshakeErrorResponse(); serr != nil {
+			logger.Log.Errorf("Error sending handshake error response: %s", serr.Error())
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	_, err = a.conn.Write(response)
 
 	return err
 }
 
+// negotiate picks the protocol version, serializer, packet codec, compression
+// algorithm, zstd dictionary, cipher and sequence numbers of the session from
+// the ones advertised by the client in the handshake and returns the handshake
+// response with them, without the route dictionary if the client has it
+// cached. Clients advertising none get the same response of the older versions
+func (a *agentImpl) negotiate() ([]byte, error) {
+	a.codecMutex.Lock()
+	defer a.codecMutex.Unlock()
+
+	handshakeData := a.Session.GetHandshakeData()
+	if handshakeData == nil {
+		handshakeData = &session.HandshakeData{}
+	}
+	clientSys := handshakeData.Sys
+	version, ok := message.NegotiateProtocolVersion(clientSys.MinProtocolVersion, clientSys.MaxProtocolVersion, message.GetEncoderProtocolVersion(a.messageEncoder))
+	if !ok {
+		return nil, fmt.Errorf("%w: client supports versions %d to %d", constants.ErrProtocolVersionNotSupported, clientSys.MinProtocolVersion, clientSys.MaxProtocolVersion)
+	}
+	a.protocolVersion = version
+	if err := a.Session.Set(constants.ProtocolVersionKey, version); err != nil {
+		return nil, err
+	}
+	versioned := clientSys.MaxProtocolVersion > 0
+
+	dictionary := message.GetEncoderDictionary(a.messageEncoder)
+	encoder, negotiable := a.messageEncoder.(message.NegotiableEncoder)
+	negotiable = negotiable && len(handshakeData.Sys.Compression) > 0
+	encrypted := len(a.ciphers) > 0 && len(handshakeData.Sys.Encryption) > 0
+	sequenced := a.sequenceWindow > 0 && handshakeData.Sys.Sequence
+	serialized := len(a.serializers) > 0 && handshakeData.Sys.Serializer != ""
+	framed := a.codecEncoder != nil && handshakeData.Sys.PacketCodec == codec.GetPacketCodecName(a.codecEncoder)
+	if !negotiable && !encrypted && !sequenced && !versioned && !serialized && !framed && handshakeData.Sys.DictHash == "" && dictionary == hrdDictionary {
+		return hrd, nil
+	}
+
+	// the response is in the pomelo codec even if another one is negotiated
+	handshakeEncoder := a.encoder
+
+	dataCompression := a.messageEncoder.IsCompressionEnabled()
+	sys := handshakeSys(a.heartbeatTimeout, a.encoder, a.serializer.GetName(), dictionary)
+	if handshakeData.Sys.DictHash == sys["dictHash"] {
+		delete(sys, "dict")
+	}
+	if negotiable {
+		messageEncoder, algorithm, zstdDictionary := encoder.Negotiate(handshakeData.Sys.Compression, handshakeData.Sys.CompressionDictionaries)
+		a.messageEncoder = messageEncoder
+		a.compression = algorithm
+		sys["compression"] = algorithm
+		if zstdDictionary != 0 {
+			sys["compressionDictionary"] = zstdDictionary
+		}
+	}
+	if serialized {
+		if err := a.negotiateSerializer(handshakeData.Sys.Serializer, sys); err != nil {
+			return nil, err
+		}
+	}
+	if versioned {
+		if encoder, ok := a.messageEncoder.(message.VersionedEncoder); ok && version > message.ProtocolVersion1 {
+			a.messageEncoder = encoder.WithProtocolVersion(version)
+		}
+		sys["protocolVersion"] = version
+	}
+	if framed {
+		heartbeat, err := a.codecEncoder.Encode(packet.Heartbeat, nil)
+		if err != nil {
+			return nil, err
+		}
+		a.encoder = a.codecEncoder
+		a.heartbeatPacket = heartbeat
+		sys["packetCodec"] = codec.GetPacketCodecName(a.encoder)
+	}
+	if encrypted {
+		if err := a.negotiateEncryption(handshakeData.Sys, sys); err != nil {
+			return nil, err
+		}
+	}
+	if sequenced {
+		a.replayWindow = newReplayWindow(a.sequenceWindow)
+		sys["sequence"] = true
+	}
+	return encodeHandshakeResponse(200, sys, handshakeEncoder, dataCompression)
+}
+
+// negotiateSerializer switches the session to the serializer requested by
+// the client when it is supported, and adds the supported ones to sys so that
+// the client can pick another one in the next connection
+func (a *agentImpl) negotiateSerializer(name string, sys map[string]interface{}) error {
+	names := []string{a.serializer.GetName()}
+	for _, serializer := range a.serializers {
+		names = append(names, serializer.GetName())
+		if serializer.GetName() == name {
+			a.serializer = serializer
+		}
+	}
+	sys["serializer"] = a.serializer.GetName()
+	sys["serializers"] = names
+	return a.Session.Set(constants.SerializerKey, a.serializer.GetName())
+}
+
+// negotiateEncryption picks the cipher of the session and does the server
+// side of the key exchange, whose public key is added to sys. The handshake
+// response is not sealed, all the packets encoded after it are
+func (a *agentImpl) negotiateEncryption(clientSys session.HandshakeClientData, sys map[string]interface{}) error {
+	name := codec.NegotiateCipher(a.ciphers, clientSys.Encryption)
+	if name == "" {
+		return nil
+	}
+	keyExchange, err := codec.NewKeyExchange()
+	if err != nil {
+		return err
+	}
+	cipher, err := keyExchange.ServerCipher(name, clientSys.PublicKey)
+	if err != nil {
+		return err
+	}
+	a.encoder = codec.NewEncryptedPacketEncoder(a.encoder, cipher)
+	a.decoder = codec.NewEncryptedPacketDecoder(a.decoder, cipher)
+	sys["encryption"] = name
+	sys["publicKey"] = keyExchange.PublicKey()
+	return nil
+}
+
+// HasSequence returns true if the session negotiated sequence numbers
+func (a *agentImpl) HasSequence() bool {
+	return a.replayWindow != nil
+}
+
+// CheckSequence returns an error if the session negotiated sequence numbers
+// and seq was already received, is older than the replay window or is missing
+func (a *agentImpl) CheckSequence(seq uint64) error {
+	if a.replayWindow == nil {
+		return nil
+	}
+	return a.replayWindow.check(seq)
+}
+
+// GetProtocolVersion returns the protocol version negotiated in the handshake
+func (a *agentImpl) GetProtocolVersion() int {
+	if a.protocolVersion == 0 {
+		return message.ProtocolVersion1
+	}
+	return a.protocolVersion
+}
+
+// GetCompression returns the compression algorithm negotiated in the handshake
+func (a *agentImpl) GetCompression() string {
+	return a.compression
+}
+
+// GetSerializer returns the serializer negotiated in the handshake, which is
+// the default one when the client did not request any
+func (a *agentImpl) GetSerializer() serialize.Serializer {
+	return a.serializer
+}
+
+// GetPacketDecoder returns the decoder of the packets sent by the client
+func (a *agentImpl) GetPacketDecoder() codec.PacketDecoder {
+	a.codecMutex.Lock()
+	defer a.codecMutex.Unlock()
+	return a.decoder
+}
+
 func (a *agentImpl) SendHandshakeErrorResponse() error {
 	_, err := a.conn.Write(herd)
 
@@ -495,25 +839,104 @@ func (a *agentImpl) write() {
 		a.Close()
 	}()
 
+	// next is the packet left out of the last coalesced write, which
+	// starts the next one
+	var next *pendingWrite
 	for {
-		select {
-		case pWrite := <-a.chSend:
-			// close agent if low-level Conn broken
-			if _, err := a.conn.Write(pWrite.data); err != nil {
-				tracing.FinishSpan(pWrite.ctx, err)
-				metrics.ReportTimingFromCtx(pWrite.ctx, a.metricsReporters, handlerType, err)
-				logger.Log.Errorf("Failed to write in conn: %s", err.Error())
+		var pWrite pendingWrite
+		if next != nil {
+			pWrite, next = *next, nil
+		} else {
+			select {
+			case pWrite = <-a.chSend:
+			case <-a.chStopWrite:
 				return
 			}
-			var e error
-			tracing.FinishSpan(pWrite.ctx, e)
-			metrics.ReportTimingFromCtx(pWrite.ctx, a.metricsReporters, handlerType, pWrite.err)
-		case <-a.chStopWrite:
+		}
+
+		writes := []pendingWrite{pWrite}
+		if a.writeMaxBytes > 0 {
+			var stopped bool
+			if writes, next, stopped = a.coalesce(writes); stopped {
+				return
+			}
+		}
+		// close agent if low-level Conn broken
+		if err := a.flush(writes); err != nil {
 			return
 		}
 	}
 }
 
+// coalesce appends to writes the packets queued after them, while they fit
+// in writeMaxBytes and are queued within writeFlushDelay. It returns the
+// packet that did not fit, if any, and true if the writing was stopped
+// while waiting. A single packet larger than writeMaxBytes is written alone
+func (a *agentImpl) coalesce(writes []pendingWrite) ([]pendingWrite, *pendingWrite, bool) {
+	size := len(writes[0].data)
+	var delay <-chan time.Time
+	if a.writeFlushDelay > 0 {
+		timer := time.NewTimer(a.writeFlushDelay)
+		defer timer.Stop()
+		delay = timer.C
+	}
+
+	for size < a.writeMaxBytes {
+		var pWrite pendingWrite
+		if delay == nil {
+			select {
+			case pWrite = <-a.chSend:
+			default:
+				return writes, nil, false
+			}
+		} else {
+			select {
+			case pWrite = <-a.chSend:
+			case <-delay:
+				return writes, nil, false
+			case <-a.chStopWrite:
+				return writes, nil, true
+			}
+		}
+		if size+len(pWrite.data) > a.writeMaxBytes {
+			return writes, &pWrite, false
+		}
+		writes = append(writes, pWrite)
+		size += len(pWrite.data)
+	}
+	return writes, nil, false
+}
+
+// flush writes the packets to the conn in a single write, in the order
+// they were queued
+func (a *agentImpl) flush(writes []pendingWrite) error {
+	data := writes[0].data
+	if len(writes) > 1 {
+		buf := writeBuffers.Get().(*[]byte)
+		defer writeBuffers.Put(buf)
+		*buf = (*buf)[:0]
+		for _, pWrite := range writes {
+			*buf = append(*buf, pWrite.data...)
+		}
+		data = *buf
+	}
+
+	if _, err := a.conn.Write(data); err != nil {
+		for _, pWrite := range writes {
+			tracing.FinishSpan(pWrite.ctx, err)
+			metrics.ReportTimingFromCtx(pWrite.ctx, a.metricsReporters, handlerType, err)
+		}
+		logger.Log.Errorf("Failed to write in conn: %s", err.Error())
+		return err
+	}
+	for _, pWrite := range writes {
+		var e error
+		tracing.FinishSpan(pWrite.ctx, e)
+		metrics.ReportTimingFromCtx(pWrite.ctx, a.metricsReporters, handlerType, pWrite.err)
+	}
+	return nil
+}
+
 // SendRequest sends a request to a server
 func (a *agentImpl) SendRequest(ctx context.Context, serverID, route string, v interface{}) (*protos.Response, error) {
 	return nil, e.New("not implemented")
@@ -545,51 +968,52 @@ func (a *agentImpl) AnswerWithError(ctx context.Context, mid uint, err error) {
 	}
 }
 
-func hbdEncode(heartbeatTimeout time.Duration, packetEncoder codec.PacketEncoder, dataCompression bool, serializerName string) {
-	hData := map[string]interface{}{
-		"code": 200,
-		"sys": map[string]interface{}{
-			"heartbeat":  heartbeatTimeout.Seconds(),
-			"dict":       message.GetDictionary(),
-			"serializer": serializerName,
-		},
-	}
-
-	data, err := encodeAndCompress(hData, dataCompression)
+func hbdEncode(heartbeatTimeout time.Duration, packetEncoder codec.PacketEncoder, dataCompression bool, serializerName string, dictionary *message.Dictionary) {
+	var err error
+	hrd, err = encodeHandshakeResponse(200, handshakeSys(heartbeatTimeout, packetEncoder, serializerName, dictionary), packetEncoder, dataCompression)
 	if err != nil {
 		panic(err)
 	}
+	hrdDictionary = dictionary
 
-	hrd, err = packetEncoder.Encode(packet.Handshake, data)
+	hbd, err = packetEncoder.Encode(packet.Heartbeat, nil)
 	if err != nil {
 		panic(err)
 	}
+}
 
-	hbd, err = packetEncoder.Encode(packet.Heartbeat, nil)
+func herdEncode(heartbeatTimeout time.Duration, packetEncoder codec.PacketEncoder, dataCompression bool, serializerName string, dictionary *message.Dictionary) {
+	var err error
+	herd, err = encodeHandshakeResponse(400, handshakeSys(heartbeatTimeout, packetEncoder, serializerName, dictionary), packetEncoder, dataCompression)
 	if err != nil {
 		panic(err)
 	}
 }
 
-func herdEncode(heartbeatTimeout time.Duration, packetEncoder codec.PacketEncoder, dataCompression bool, serializerName string) {
-	hErrData := map[string]interface{}{
-		"code": 400,
-		"sys": map[string]interface{}{
-			"heartbeat":  heartbeatTimeout.Seconds(),
-			"dict":       message.GetDictionary(),
-			"serializer": serializerName,
-		},
+// handshakeSys returns the sys data of the handshake response, which is the
+// same for all the sessions
+func handshakeSys(heartbeatTimeout time.Duration, packetEncoder codec.PacketEncoder, serializerName string, dictionary *message.Dictionary) map[string]interface{} {
+	return map[string]interface{}{
+		"heartbeat":   heartbeatTimeout.Seconds(),
+		"dict":        dictionary.Routes(),
+		"dictHash":    dictionary.Hash(),
+		"serializer":  serializerName,
+		"packetCodec": codec.GetPacketCodecName(packetEncoder),
 	}
+}
 
-	errData, err := encodeAndCompress(hErrData, dataCompression)
-	if err != nil {
-		panic(err)
+func encodeHandshakeResponse(code int, sys map[string]interface{}, packetEncoder codec.PacketEncoder, dataCompression bool) ([]byte, error) {
+	hData := map[string]interface{}{
+		"code": code,
+		"sys":  sys,
 	}
 
-	herd, err = packetEncoder.Encode(packet.Handshake, errData)
+	data, err := encodeAndCompress(hData, dataCompression)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
+
+	return packetEncoder.Encode(packet.Handshake, data)
 }
 
 func encodeAndCompress(data interface{}, dataCompression bool) ([]byte, error) {
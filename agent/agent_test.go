@@ -22,9 +22,12 @@ package agent
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"reflect"
 	"sync"
 	"testing"
@@ -33,6 +36,7 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/topfreegames/pitaya/v2/conn/codec"
 	codecmocks "github.com/topfreegames/pitaya/v2/conn/codec/mocks"
 	"github.com/topfreegames/pitaya/v2/conn/message"
 	messagemocks "github.com/topfreegames/pitaya/v2/conn/message/mocks"
@@ -45,8 +49,12 @@ import (
 	metricsmocks "github.com/topfreegames/pitaya/v2/metrics/mocks"
 	"github.com/topfreegames/pitaya/v2/mocks"
 	"github.com/topfreegames/pitaya/v2/protos"
+	"github.com/topfreegames/pitaya/v2/serialize"
 	serializemocks "github.com/topfreegames/pitaya/v2/serialize/mocks"
+	"github.com/topfreegames/pitaya/v2/serialize/msgpack"
+	"github.com/topfreegames/pitaya/v2/serialize/protojson"
 	"github.com/topfreegames/pitaya/v2/session"
+	"github.com/topfreegames/pitaya/v2/util/compression"
 )
 
 type mockAddr struct{}
@@ -835,6 +843,488 @@ func TestAgentSendHandshakeResponse(t *testing.T) {
 	}
 }
 
+func TestAgentSendHandshakeResponseNegotiatesCompression(t *testing.T) {
+	tables := []struct {
+		name         string
+		client       []string
+		dictionaries []uint32
+		algorithm    string
+		dictionary   uint32
+		compression  bool
+	}{
+		{"server_preference", []string{"deflate", "snappy"}, nil, "snappy", 0, true},
+		{"no_common_algorithm", []string{"lz4"}, nil, "", 0, false},
+		{"zstd_dictionary", []string{"zstd"}, []uint32{1, 42}, "zstd", 1, true},
+		{"zstd_without_dictionary", []string{"zstd"}, []uint32{42}, "zstd", 0, true},
+	}
+
+	dictionary, err := os.ReadFile(filepath.Join("..", "util", "compression", "fixtures", "zstd_dictionary_1"))
+	assert.NoError(t, err)
+	_, err = compression.LoadZstdDictionary(dictionary)
+	assert.NoError(t, err)
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockConn := mocks.NewMockPlayerConn(ctrl)
+			mockSerializer := serializemocks.NewMockSerializer(ctrl)
+			mockSerializer.EXPECT().GetName().Return("json").AnyTimes()
+			messageEncoder := message.NewMessagesEncoder(true)
+			messageEncoder.CompressionAlgorithms = []string{"zstd", "snappy", "deflate"}
+
+			sessionPool := session.NewSessionPool()
+			ag := newAgent(mockConn, nil, codec.NewPomeloPacketEncoder(), mockSerializer, time.Second, 0, nil, messageEncoder, nil, sessionPool)
+			ag.GetSession().SetHandshakeData(&session.HandshakeData{
+				Sys: session.HandshakeClientData{Compression: table.client, CompressionDictionaries: table.dictionaries},
+			})
+
+			var written []byte
+			mockConn.EXPECT().Write(gomock.Any()).Do(func(b []byte) { written = b })
+			assert.NoError(t, ag.SendHandshakeResponse())
+
+			packets, err := codec.NewPomeloPacketDecoder().Decode(written)
+			assert.NoError(t, err)
+			data := packets[0].Data
+			if compression.IsCompressed(data) {
+				data, err = compression.InflateData(data)
+				assert.NoError(t, err)
+			}
+			response := struct {
+				Sys struct {
+					Compression           string `json:"compression"`
+					CompressionDictionary uint32 `json:"compressionDictionary"`
+				} `json:"sys"`
+			}{}
+			assert.NoError(t, json.Unmarshal(data, &response))
+			assert.Equal(t, table.algorithm, response.Sys.Compression)
+			assert.Equal(t, table.dictionary, response.Sys.CompressionDictionary)
+
+			negotiated := ag.(*agentImpl).messageEncoder
+			assert.Equal(t, table.compression, negotiated.IsCompressionEnabled())
+			assert.Equal(t, table.algorithm, ag.(CompressionAgent).GetCompression())
+			assert.True(t, messageEncoder.IsCompressionEnabled())
+			if table.algorithm == compression.Zstd {
+				compressor := negotiated.(*message.MessagesEncoder).Compressor.(*compression.ZstdCompressor)
+				assert.Equal(t, table.dictionary, compressor.DictionaryID())
+			}
+		})
+	}
+}
+
+func TestAgentSendHandshakeResponseNegotiatesEncryption(t *testing.T) {
+	tables := []struct {
+		name    string
+		ciphers []string
+		client  []string
+		cipher  string
+	}{
+		{"server_preference", []string{codec.ChaCha20Poly1305, codec.AESGCM}, []string{codec.AESGCM, codec.ChaCha20Poly1305}, codec.ChaCha20Poly1305},
+		{"no_common_cipher", []string{codec.AESGCM}, []string{codec.ChaCha20Poly1305}, ""},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockConn := mocks.NewMockPlayerConn(ctrl)
+			mockSerializer := serializemocks.NewMockSerializer(ctrl)
+			mockSerializer.EXPECT().GetName().Return("json").AnyTimes()
+			clientExchange, err := codec.NewKeyExchange()
+			assert.NoError(t, err)
+
+			sessionPool := session.NewSessionPool()
+			ag := newAgent(mockConn, codec.NewPomeloPacketDecoder(), codec.NewPomeloPacketEncoder(), mockSerializer, time.Second, 1, nil, message.NewMessagesEncoder(false), nil, sessionPool)
+			ag.(*agentImpl).ciphers = table.ciphers
+			ag.GetSession().SetHandshakeData(&session.HandshakeData{
+				Sys: session.HandshakeClientData{Encryption: table.client, PublicKey: clientExchange.PublicKey()},
+			})
+
+			var written []byte
+			mockConn.EXPECT().Write(gomock.Any()).Do(func(b []byte) { written = b })
+			assert.NoError(t, ag.SendHandshakeResponse())
+
+			packets, err := codec.NewPomeloPacketDecoder().Decode(written)
+			assert.NoError(t, err)
+			response := struct {
+				Sys struct {
+					Encryption string `json:"encryption"`
+					PublicKey  []byte `json:"publicKey"`
+				} `json:"sys"`
+			}{}
+			assert.NoError(t, json.Unmarshal(packets[0].Data, &response))
+			assert.Equal(t, table.cipher, response.Sys.Encryption)
+
+			data, err := ag.(*agentImpl).encoder.Encode(packet.Data, []byte("hello"))
+			assert.NoError(t, err)
+			packets, err = codec.NewPomeloPacketDecoder().Decode(data)
+			assert.NoError(t, err)
+			if table.cipher == "" {
+				assert.Nil(t, response.Sys.PublicKey)
+				assert.Equal(t, []byte("hello"), packets[0].Data)
+				return
+			}
+
+			clientCipher, err := clientExchange.ClientCipher(table.cipher, response.Sys.PublicKey)
+			assert.NoError(t, err)
+			opened, err := clientCipher.Open(packet.Data, packets[0].Data)
+			assert.NoError(t, err)
+			assert.Equal(t, []byte("hello"), opened)
+
+			data, err = codec.NewEncryptedPacketEncoder(codec.NewPomeloPacketEncoder(), clientCipher).Encode(packet.Data, []byte("hi"))
+			assert.NoError(t, err)
+			packets, err = ag.(PacketDecoderAgent).GetPacketDecoder().Decode(data)
+			assert.NoError(t, err)
+			assert.Equal(t, []byte("hi"), packets[0].Data)
+
+			// the heartbeats and kicks are sealed too, so they can't be forged
+			clientDecoder := codec.NewEncryptedPacketDecoder(codec.NewPomeloPacketDecoder(), clientCipher)
+			assert.True(t, ag.(*agentImpl).sendHeartbeat())
+			pWrite := <-ag.(*agentImpl).chSend
+			packets, err = clientDecoder.Decode(pWrite.data)
+			assert.NoError(t, err)
+			assert.EqualValues(t, packet.Heartbeat, packets[0].Type)
+
+			mockConn.EXPECT().Write(gomock.Any()).Do(func(b []byte) { written = b })
+			assert.NoError(t, ag.Kick(context.Background()))
+			packets, err = clientDecoder.Decode(written)
+			assert.NoError(t, err)
+			assert.EqualValues(t, packet.Kick, packets[0].Type)
+
+			unsealed, err := codec.NewPomeloPacketEncoder().Encode(packet.Heartbeat, nil)
+			assert.NoError(t, err)
+			_, err = ag.(PacketDecoderAgent).GetPacketDecoder().Decode(unsealed)
+			assert.Equal(t, codec.ErrOpenPacket, err)
+		})
+	}
+}
+
+func TestAgentPushEncryptedInOrder(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn := mocks.NewMockPlayerConn(ctrl)
+	mockSerializer := serializemocks.NewMockSerializer(ctrl)
+	mockSerializer.EXPECT().GetName().Return("json").AnyTimes()
+	clientExchange, err := codec.NewKeyExchange()
+	assert.NoError(t, err)
+
+	const pushes = 50
+	sessionPool := session.NewSessionPool()
+	ag := newAgent(mockConn, codec.NewPomeloPacketDecoder(), codec.NewPomeloPacketEncoder(), mockSerializer, time.Second, pushes, nil, message.NewMessagesEncoder(false), nil, sessionPool)
+	ag.(*agentImpl).ciphers = []string{codec.AESGCM}
+	ag.GetSession().SetHandshakeData(&session.HandshakeData{
+		Sys: session.HandshakeClientData{Encryption: []string{codec.AESGCM}, PublicKey: clientExchange.PublicKey()},
+	})
+
+	var written []byte
+	mockConn.EXPECT().Write(gomock.Any()).Do(func(b []byte) { written = b })
+	assert.NoError(t, ag.SendHandshakeResponse())
+	packets, err := codec.NewPomeloPacketDecoder().Decode(written)
+	assert.NoError(t, err)
+	response := struct {
+		Sys struct {
+			PublicKey []byte `json:"publicKey"`
+		} `json:"sys"`
+	}{}
+	assert.NoError(t, json.Unmarshal(packets[0].Data, &response))
+	clientCipher, err := clientExchange.ClientCipher(codec.AESGCM, response.Sys.PublicKey)
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < pushes; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, ag.Push("route", []byte("hello")))
+		}()
+	}
+	wg.Wait()
+
+	// the client rejects the packets sealed before the last one it opened
+	decoder := codec.NewEncryptedPacketDecoder(codec.NewPomeloPacketDecoder(), clientCipher)
+	for i := 0; i < pushes; i++ {
+		pWrite := <-ag.(*agentImpl).chSend
+		_, err := decoder.Decode(pWrite.data)
+		assert.NoError(t, err)
+	}
+}
+
+func TestAgentSendHandshakeResponseNegotiatesSequence(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn := mocks.NewMockPlayerConn(ctrl)
+	mockSerializer := serializemocks.NewMockSerializer(ctrl)
+	mockSerializer.EXPECT().GetName().Return("json").AnyTimes()
+
+	sessionPool := session.NewSessionPool()
+	ag := newAgent(mockConn, nil, codec.NewPomeloPacketEncoder(), mockSerializer, time.Second, 0, nil, message.NewMessagesEncoder(false), nil, sessionPool)
+	ag.(*agentImpl).sequenceWindow = 10
+	ag.GetSession().SetHandshakeData(&session.HandshakeData{
+		Sys: session.HandshakeClientData{Sequence: true},
+	})
+	sequenceAgent := ag.(SequenceAgent)
+	assert.NoError(t, sequenceAgent.CheckSequence(0))
+
+	var written []byte
+	mockConn.EXPECT().Write(gomock.Any()).Do(func(b []byte) { written = b })
+	assert.NoError(t, ag.SendHandshakeResponse())
+
+	packets, err := codec.NewPomeloPacketDecoder().Decode(written)
+	assert.NoError(t, err)
+	response := struct {
+		Sys struct {
+			Sequence bool `json:"sequence"`
+		} `json:"sys"`
+	}{}
+	assert.NoError(t, json.Unmarshal(packets[0].Data, &response))
+	assert.True(t, response.Sys.Sequence)
+
+	assert.Equal(t, constants.ErrMissingSequence, sequenceAgent.CheckSequence(0))
+	assert.NoError(t, sequenceAgent.CheckSequence(2))
+	assert.NoError(t, sequenceAgent.CheckSequence(1))
+	assert.Equal(t, constants.ErrReplayedMessage, sequenceAgent.CheckSequence(2))
+	assert.NoError(t, sequenceAgent.CheckSequence(12))
+	assert.Equal(t, constants.ErrSequenceOutOfWindow, sequenceAgent.CheckSequence(2))
+}
+
+func TestAgentSendHandshakeResponseNegotiatesPacketCodec(t *testing.T) {
+	tables := []struct {
+		name  string
+		codec string
+	}{
+		{"requested", codec.LengthPrefixedPacketCodec},
+		{"not_requested", ""},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockConn := mocks.NewMockPlayerConn(ctrl)
+			mockSerializer := serializemocks.NewMockSerializer(ctrl)
+			mockSerializer.EXPECT().GetName().Return("json").AnyTimes()
+
+			sessionPool := session.NewSessionPool()
+			ag := newAgent(mockConn, nil, codec.NewLengthPrefixedPacketEncoder(), mockSerializer, time.Second, 0, nil, message.NewMessagesEncoder(false), nil, sessionPool).(*agentImpl)
+			ag.GetSession().SetHandshakeData(&session.HandshakeData{
+				Sys: session.HandshakeClientData{PacketCodec: table.codec},
+			})
+
+			var written []byte
+			mockConn.EXPECT().Write(gomock.Any()).Do(func(b []byte) { written = b })
+			assert.NoError(t, ag.SendHandshakeResponse())
+
+			if table.codec == "" {
+				assert.Equal(t, hrd, written)
+				assert.Equal(t, codec.PomeloPacketCodec, codec.GetPacketCodecName(ag.encoder))
+				heartbeat, err := ag.heartbeatData()
+				assert.NoError(t, err)
+				assert.Equal(t, hbd, heartbeat)
+				return
+			}
+
+			// the handshake response is a pomelo packet
+			assert.Zero(t, written[0]&codec.LengthPrefixedFlag)
+			packets, err := codec.NewPomeloPacketDecoder().Decode(written)
+			assert.NoError(t, err)
+			response := struct {
+				Sys struct {
+					PacketCodec string `json:"packetCodec"`
+				} `json:"sys"`
+			}{}
+			assert.NoError(t, json.Unmarshal(packets[0].Data, &response))
+			assert.Equal(t, codec.LengthPrefixedPacketCodec, response.Sys.PacketCodec)
+
+			assert.Equal(t, codec.LengthPrefixedPacketCodec, codec.GetPacketCodecName(ag.encoder))
+			expected, err := codec.NewLengthPrefixedPacketEncoder().Encode(packet.Heartbeat, nil)
+			assert.NoError(t, err)
+			heartbeat, err := ag.heartbeatData()
+			assert.NoError(t, err)
+			assert.Equal(t, expected, heartbeat)
+		})
+	}
+}
+
+func TestAgentSendHandshakeResponseNegotiatesProtocolVersion(t *testing.T) {
+	tables := []struct {
+		name       string
+		clientMin  int
+		clientMax  int
+		version    int
+		advertised int
+		err        error
+	}{
+		{"client_without_versions", 0, 0, message.ProtocolVersion1, 0, nil},
+		{"client_supports_first_version", 1, 1, message.ProtocolVersion1, message.ProtocolVersion1, nil},
+		{"client_supports_all_versions", 1, message.MaxProtocolVersion, message.MaxProtocolVersion, message.MaxProtocolVersion, nil},
+		{"client_supports_newer_versions", message.MaxProtocolVersion + 1, message.MaxProtocolVersion + 2, 0, 0, constants.ErrProtocolVersionNotSupported},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockConn := mocks.NewMockPlayerConn(ctrl)
+			mockSerializer := serializemocks.NewMockSerializer(ctrl)
+			mockSerializer.EXPECT().GetName().Return("json").AnyTimes()
+
+			sessionPool := session.NewSessionPool()
+			ag := newAgent(mockConn, nil, codec.NewPomeloPacketEncoder(), mockSerializer, time.Second, 0, nil, message.NewMessagesEncoder(false), nil, sessionPool)
+			ag.GetSession().SetHandshakeData(&session.HandshakeData{
+				Sys: session.HandshakeClientData{
+					MinProtocolVersion: table.clientMin,
+					MaxProtocolVersion: table.clientMax,
+				},
+			})
+
+			var written []byte
+			mockConn.EXPECT().Write(gomock.Any()).Do(func(b []byte) { written = b })
+			err := ag.SendHandshakeResponse()
+			if table.err != nil {
+				assert.ErrorIs(t, err, table.err)
+				assert.Equal(t, herd, written)
+				return
+			}
+			assert.NoError(t, err)
+
+			if table.advertised == 0 {
+				assert.Equal(t, hrd, written)
+			} else {
+				packets, err := codec.NewPomeloPacketDecoder().Decode(written)
+				assert.NoError(t, err)
+				response := struct {
+					Sys struct {
+						ProtocolVersion int `json:"protocolVersion"`
+					} `json:"sys"`
+				}{}
+				assert.NoError(t, json.Unmarshal(packets[0].Data, &response))
+				assert.Equal(t, table.advertised, response.Sys.ProtocolVersion)
+			}
+
+			assert.Equal(t, table.version, ag.(ProtocolVersionAgent).GetProtocolVersion())
+			assert.Equal(t, table.version, ag.GetSession().Int(constants.ProtocolVersionKey))
+		})
+	}
+}
+
+func TestAgentSendHandshakeResponseNegotiatesSerializer(t *testing.T) {
+	tables := []struct {
+		name        string
+		serializers []serialize.Serializer
+		requested   string
+		serializer  string
+		advertised  []string
+	}{
+		{"requested_serializer", []serialize.Serializer{msgpack.NewSerializer()}, "msgpack", "msgpack", []string{"json", "msgpack"}},
+		{"requested_default_serializer", []serialize.Serializer{msgpack.NewSerializer()}, "json", "json", []string{"json", "msgpack"}},
+		{"unsupported_serializer", []serialize.Serializer{msgpack.NewSerializer()}, "protobuf", "json", []string{"json", "msgpack"}},
+		{"server_without_serializers", nil, "msgpack", "json", nil},
+		{"requested_protojson", []serialize.Serializer{protojson.NewSerializer()}, "protojson", "protojson", []string{"json", "protojson"}},
+		{"requested_json_with_protojson", []serialize.Serializer{protojson.NewSerializer()}, "json", "json", []string{"json", "protojson"}},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockConn := mocks.NewMockPlayerConn(ctrl)
+			mockSerializer := serializemocks.NewMockSerializer(ctrl)
+			mockSerializer.EXPECT().GetName().Return("json").AnyTimes()
+
+			sessionPool := session.NewSessionPool()
+			ag := newAgent(mockConn, nil, codec.NewPomeloPacketEncoder(), mockSerializer, time.Second, 0, nil, message.NewMessagesEncoder(false), nil, sessionPool)
+			ag.(*agentImpl).serializers = table.serializers
+			ag.GetSession().SetHandshakeData(&session.HandshakeData{
+				Sys: session.HandshakeClientData{Serializer: table.requested},
+			})
+
+			var written []byte
+			mockConn.EXPECT().Write(gomock.Any()).Do(func(b []byte) { written = b })
+			assert.NoError(t, ag.SendHandshakeResponse())
+			assert.Equal(t, table.serializer, ag.(SerializerAgent).GetSerializer().GetName())
+
+			if table.advertised == nil {
+				assert.Equal(t, hrd, written)
+				assert.Empty(t, ag.GetSession().String(constants.SerializerKey))
+				return
+			}
+			packets, err := codec.NewPomeloPacketDecoder().Decode(written)
+			assert.NoError(t, err)
+			response := struct {
+				Sys struct {
+					Serializer  string   `json:"serializer"`
+					Serializers []string `json:"serializers"`
+				} `json:"sys"`
+			}{}
+			assert.NoError(t, json.Unmarshal(packets[0].Data, &response))
+			assert.Equal(t, table.serializer, response.Sys.Serializer)
+			assert.Equal(t, table.advertised, response.Sys.Serializers)
+			assert.Equal(t, table.serializer, ag.GetSession().String(constants.SerializerKey))
+		})
+	}
+}
+
+func TestAgentSendHandshakeResponseRouteDictionary(t *testing.T) {
+	dictionary := message.NewDictionary()
+	assert.NoError(t, dictionary.Set(map[string]uint16{"room.room.join": 1}))
+
+	tables := []struct {
+		name     string
+		dictHash string
+		sendDict bool
+	}{
+		{"no_cached_dictionary", "", true},
+		{"cached_dictionary", dictionary.Hash(), false},
+		{"stale_cached_dictionary", "stale", true},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockConn := mocks.NewMockPlayerConn(ctrl)
+			mockSerializer := serializemocks.NewMockSerializer(ctrl)
+			mockSerializer.EXPECT().GetName().Return("json").AnyTimes()
+			messageEncoder := message.NewMessagesEncoder(false)
+			messageEncoder.Dictionary = dictionary
+
+			sessionPool := session.NewSessionPool()
+			ag := newAgent(mockConn, nil, codec.NewPomeloPacketEncoder(), mockSerializer, time.Second, 0, nil, messageEncoder, nil, sessionPool)
+			ag.GetSession().SetHandshakeData(&session.HandshakeData{
+				Sys: session.HandshakeClientData{DictHash: table.dictHash},
+			})
+
+			var written []byte
+			mockConn.EXPECT().Write(gomock.Any()).Do(func(b []byte) { written = b })
+			assert.NoError(t, ag.SendHandshakeResponse())
+
+			packets, err := codec.NewPomeloPacketDecoder().Decode(written)
+			assert.NoError(t, err)
+			response := struct {
+				Sys struct {
+					Dict     map[string]uint16 `json:"dict"`
+					DictHash string            `json:"dictHash"`
+				} `json:"sys"`
+			}{}
+			assert.NoError(t, json.Unmarshal(packets[0].Data, &response))
+			assert.Equal(t, dictionary.Hash(), response.Sys.DictHash)
+			if table.sendDict {
+				assert.Equal(t, dictionary.Routes(), response.Sys.Dict)
+			} else {
+				assert.Nil(t, response.Sys.Dict)
+			}
+		})
+	}
+}
+
 func TestAnswerWithError(t *testing.T) {
 	tables := []struct {
 		name          string
@@ -1006,6 +1496,87 @@ func TestAgentWriteChSend(t *testing.T) {
 	wg.Wait()
 }
 
+func TestAgentWriteCoalescing(t *testing.T) {
+	tables := []struct {
+		name     string
+		maxBytes int
+		packets  []string
+		writes   []string
+	}{
+		{"disabled", 0, []string{"a", "bb", "c"}, []string{"a", "bb", "c"}},
+		{"joins_queued_packets", 1024, []string{"a", "bb", "c"}, []string{"abbc"}},
+		{"max_bytes", 3, []string{"a", "bb", "c", "dd", "e"}, []string{"abb", "cdd", "e"}},
+		{"never_exceeds_max_bytes", 2, []string{"a", "bb", "c", "dd", "e"}, []string{"a", "bb", "c", "dd", "e"}},
+		{"larger_packet_alone", 2, []string{"abc", "d", "e"}, []string{"abc", "de"}},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockConn := mocks.NewMockPlayerConn(ctrl)
+			ag := &agentImpl{
+				conn:          mockConn,
+				chSend:        make(chan pendingWrite, 10),
+				writeMaxBytes: table.maxBytes,
+			}
+			for _, p := range table.packets {
+				ag.chSend <- pendingWrite{data: []byte(p)}
+			}
+
+			var wg sync.WaitGroup
+			wg.Add(len(table.writes))
+			calls := make([]*gomock.Call, 0, len(table.writes))
+			for _, w := range table.writes {
+				calls = append(calls, mockConn.EXPECT().Write([]byte(w)).Do(func(b []byte) { wg.Done() }))
+			}
+			gomock.InOrder(calls...)
+			go ag.write()
+			wg.Wait()
+		})
+	}
+}
+
+func TestAgentWriteCoalescingFlushDelay(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn := mocks.NewMockPlayerConn(ctrl)
+	ag := &agentImpl{
+		conn:            mockConn,
+		chSend:          make(chan pendingWrite, 10),
+		writeMaxBytes:   1024,
+		writeFlushDelay: 100 * time.Millisecond,
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	mockConn.EXPECT().Write([]byte("ab")).Do(func(b []byte) { wg.Done() })
+	go ag.write()
+	ag.chSend <- pendingWrite{data: []byte("a")}
+	time.Sleep(10 * time.Millisecond)
+	ag.chSend <- pendingWrite{data: []byte("b")}
+	wg.Wait()
+}
+
+func TestNewAgentFactoryWithWriteCoalescing(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSerializer := serializemocks.NewMockSerializer(ctrl)
+	mockSerializer.EXPECT().GetName().AnyTimes()
+	mockEncoder := codecmocks.NewMockPacketEncoder(ctrl)
+	heartbeatAndHandshakeMocks(mockEncoder)
+	mockConn := mocks.NewMockPlayerConn(ctrl)
+	messageEncoder := message.NewMessagesEncoder(false)
+
+	factory := NewAgentFactory(nil, nil, mockEncoder, mockSerializer, time.Second, messageEncoder, 10, session.NewSessionPool(), nil, WithWriteCoalescing(512, time.Millisecond))
+	ag := factory.CreateAgent(mockConn).(*agentImpl)
+	assert.Equal(t, 512, ag.writeMaxBytes)
+	assert.Equal(t, time.Millisecond, ag.writeFlushDelay)
+}
+
 func TestAgentHandle(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
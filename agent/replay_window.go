@@ -0,0 +1,79 @@
+// Copyright (c) TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package agent
+
+import (
+	"github.com/topfreegames/pitaya/v2/constants"
+)
+
+const replayWindowBlockBits = 64
+
+// replayWindow keeps the sequence numbers received within the last size
+// ones of the highest received, so that messages can arrive out of order
+// within the window but never twice. Older messages are rejected since it
+// is not known whether they were received. It is not safe for concurrent use
+type replayWindow struct {
+	size    uint64
+	highest uint64
+	// the bit seq%64 of the block seq/64, modulo the number of blocks, is
+	// set when seq was received. There is one block more than the window
+	// needs, so that moving the window only clears whole blocks
+	blocks []uint64
+}
+
+func newReplayWindow(size int) *replayWindow {
+	return &replayWindow{
+		size:   uint64(size),
+		blocks: make([]uint64, (size+replayWindowBlockBits-1)/replayWindowBlockBits+1),
+	}
+}
+
+// check returns an error if seq was already received or is older than the
+// window, otherwise it marks seq as received
+func (w *replayWindow) check(seq uint64) error {
+	if seq == 0 {
+		return constants.ErrMissingSequence
+	}
+	if seq+w.size <= w.highest {
+		return constants.ErrSequenceOutOfWindow
+	}
+
+	count := uint64(len(w.blocks))
+	block := seq / replayWindowBlockBits
+	if seq > w.highest {
+		current := w.highest / replayWindowBlockBits
+		cleared := block - current
+		if cleared > count {
+			cleared = count
+		}
+		for i := uint64(1); i <= cleared; i++ {
+			w.blocks[(current+i)%count] = 0
+		}
+		w.highest = seq
+	}
+
+	bit := uint64(1) << (seq % replayWindowBlockBits)
+	if w.blocks[block%count]&bit != 0 {
+		return constants.ErrReplayedMessage
+	}
+	w.blocks[block%count] |= bit
+	return nil
+}
@@ -0,0 +1,61 @@
+// Copyright (c) TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package agent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topfreegames/pitaya/v2/constants"
+)
+
+func TestReplayWindow(t *testing.T) {
+	t.Parallel()
+
+	w := newReplayWindow(100)
+	assert.Equal(t, constants.ErrMissingSequence, w.check(0))
+	assert.NoError(t, w.check(1))
+	assert.Equal(t, constants.ErrReplayedMessage, w.check(1))
+
+	// out of order within the window
+	assert.NoError(t, w.check(10))
+	assert.NoError(t, w.check(5))
+	assert.Equal(t, constants.ErrReplayedMessage, w.check(5))
+	assert.Equal(t, constants.ErrReplayedMessage, w.check(10))
+
+	assert.NoError(t, w.check(105))
+	assert.Equal(t, constants.ErrSequenceOutOfWindow, w.check(5))
+	assert.NoError(t, w.check(6))
+	assert.Equal(t, constants.ErrReplayedMessage, w.check(10))
+	assert.NoError(t, w.check(104))
+
+	// jumps larger than the window clear every block
+	assert.NoError(t, w.check(1000))
+	assert.Equal(t, constants.ErrSequenceOutOfWindow, w.check(105))
+	assert.NoError(t, w.check(901))
+	assert.Equal(t, constants.ErrReplayedMessage, w.check(1000))
+	for seq := uint64(1001); seq < 1300; seq++ {
+		assert.NoError(t, w.check(seq))
+	}
+	assert.Equal(t, constants.ErrReplayedMessage, w.check(1299))
+	assert.Equal(t, constants.ErrSequenceOutOfWindow, w.check(1199))
+	assert.Equal(t, constants.ErrReplayedMessage, w.check(1200))
+}
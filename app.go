@@ -82,6 +82,7 @@ type Pitaya interface {
 	GetSessionFromCtx(ctx context.Context) session.Session
 	Start()
 	SetDictionary(dict map[string]uint16) error
+	AddPushRoutes(routes ...string) error
 	AddRoute(serverType string, routingFunction router.RoutingFunc) error
 	Shutdown()
 	StartWorker()
@@ -141,6 +142,7 @@ type App struct {
 	metricsReporters []metrics.Reporter
 	running          bool
 	serializer       serialize.Serializer
+	serializers      []serialize.Serializer
 	server           *cluster.Server
 	serverMode       ServerMode
 	serviceDiscovery cluster.ServiceDiscovery
@@ -154,6 +156,8 @@ type App struct {
 	modulesArr       []moduleWrapper
 	groups           groups.GroupService
 	sessionPool      session.SessionPool
+	dictionary       *message.Dictionary
+	pushRoutes       []string
 }
 
 // NewApp is the base constructor for a pitaya app instance
@@ -198,6 +202,7 @@ func NewApp(
 		remoteComp:       make([]regComp, 0),
 		modulesMap:       make(map[string]interfaces.Module),
 		modulesArr:       []moduleWrapper{},
+		dictionary:       message.DefaultDictionary(),
 		sessionPool:      sessionPool,
 	}
 	if app.heartbeat == time.Duration(0) {
@@ -365,6 +370,9 @@ func (app *App) Start() {
 
 func (app *App) listen() {
 	app.startupComponents()
+	if err := app.buildDictionary(); err != nil {
+		logger.Log.Fatalf("error building route dictionary: %s", err.Error())
+	}
 	// create global ticker instance, timer precision could be customized
 	// by SetTimerPrecision
 	timer.GlobalTicker = time.NewTicker(timer.Precision)
@@ -415,7 +423,33 @@ func (app *App) SetDictionary(dict map[string]uint16) error {
 	if app.running {
 		return constants.ErrChangeDictionaryWhileRunning
 	}
-	return message.SetDictionary(dict)
+	return app.dictionary.Set(dict)
+}
+
+// AddPushRoutes declares the routes of the pushes sent to the clients, which
+// are added to the route dictionary built when the app starts if
+// pitaya.handler.messages.routedictionary is enabled. The routes of handlers
+// of other server types reached through this one can also be declared here
+func (app *App) AddPushRoutes(routes ...string) error {
+	if app.running {
+		return constants.ErrChangeDictionaryWhileRunning
+	}
+	app.pushRoutes = append(app.pushRoutes, routes...)
+	return nil
+}
+
+// buildDictionary adds the routes of the handlers and the declared push
+// routes to the route dictionary
+func (app *App) buildDictionary() error {
+	if !app.config.Handler.Messages.RouteDictionary {
+		return nil
+	}
+	routes := append(app.handlerService.Routes(), app.pushRoutes...)
+	if err := app.dictionary.AddRoutes(routes...); err != nil {
+		return err
+	}
+	logger.Log.Infof("built route dictionary with %d routes, hash %s", len(app.dictionary.Routes()), app.dictionary.Hash())
+	return nil
 }
 
 // AddRoute adds a routing function to a server type
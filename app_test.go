@@ -27,6 +27,7 @@ import (
 	"net"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -37,6 +38,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/topfreegames/pitaya/v2/acceptor"
 	"github.com/topfreegames/pitaya/v2/cluster"
+	"github.com/topfreegames/pitaya/v2/component"
 	"github.com/topfreegames/pitaya/v2/config"
 	"github.com/topfreegames/pitaya/v2/conn/message"
 	"github.com/topfreegames/pitaya/v2/constants"
@@ -168,13 +170,64 @@ func TestSetDictionary(t *testing.T) {
 	dict := map[string]uint16{"someroute": 12}
 	err := app.SetDictionary(dict)
 	assert.NoError(t, err)
-	assert.Equal(t, dict, message.GetDictionary())
+	assert.Equal(t, dict, app.dictionary.Routes())
 
 	app.running = true
 	err = app.SetDictionary(dict)
 	assert.EqualError(t, constants.ErrChangeDictionaryWhileRunning, err.Error())
 }
 
+type DictionaryComp struct {
+	component.Base
+}
+
+func (c *DictionaryComp) Join(ctx context.Context)  {}
+func (c *DictionaryComp) Leave(ctx context.Context) {}
+
+func TestAddPushRoutes(t *testing.T) {
+	builderConfig := config.NewDefaultBuilderConfig()
+	app := NewDefaultApp(true, "testtype", Cluster, map[string]string{}, *builderConfig).(*App)
+
+	assert.NoError(t, app.AddPushRoutes("onChat", "onJoin"))
+	assert.Equal(t, []string{"onChat", "onJoin"}, app.pushRoutes)
+
+	app.running = true
+	err := app.AddPushRoutes("onLeave")
+	assert.EqualError(t, constants.ErrChangeDictionaryWhileRunning, err.Error())
+}
+
+func TestBuildDictionary(t *testing.T) {
+	tables := []struct {
+		name     string
+		enabled  bool
+		expected map[string]uint16
+	}{
+		{"enabled", true, map[string]uint16{
+			"onChat":                    1,
+			"testtype.dictionary.join":  2,
+			"testtype.dictionary.leave": 3,
+		}},
+		{"disabled", false, map[string]uint16{}},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			builderConfig := config.NewDefaultBuilderConfig()
+			builderConfig.Pitaya.Handler.Messages.RouteDictionary = table.enabled
+			builder := NewDefaultBuilder(true, "testtype", Standalone, map[string]string{}, *builderConfig)
+			app := builder.Build().(*App)
+
+			app.Register(&DictionaryComp{}, component.WithName("dictionary"), component.WithNameFunc(strings.ToLower))
+			assert.NoError(t, app.AddPushRoutes("onChat"))
+			app.startupComponents()
+			assert.NoError(t, app.buildDictionary())
+
+			assert.Equal(t, table.expected, builder.MessageEncoder.Dictionary.Routes())
+			assert.NotContains(t, message.GetDictionary(), "onChat")
+		})
+	}
+}
+
 func TestAddRoute(t *testing.T) {
 	builderConfig := config.NewDefaultBuilderConfig()
 	app := NewDefaultApp(true, "testtype", Cluster, map[string]string{}, *builderConfig).(*App)
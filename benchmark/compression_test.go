@@ -0,0 +1,115 @@
+// Copyright (c) TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package benchmark
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/topfreegames/pitaya/v2/conn/message"
+	"github.com/topfreegames/pitaya/v2/util/compression"
+)
+
+// compressionPayload returns a json payload of about size bytes, with the
+// repetition usual in game state messages
+func compressionPayload(size int) []byte {
+	type item struct {
+		ID       int    `json:"id"`
+		Name     string `json:"name"`
+		Quantity int    `json:"quantity"`
+		Rarity   string `json:"rarity"`
+	}
+	items := []item{}
+	data := []byte("[]")
+	for i := 0; len(data) < size; i++ {
+		items = append(items, item{ID: i, Name: fmt.Sprintf("item-%d", i%50), Quantity: i % 7, Rarity: "common"})
+		data, _ = json.Marshal(items)
+	}
+	return data
+}
+
+var compressionPayloadSizes = []int{128, 1024, 16 * 1024, 256 * 1024}
+
+func BenchmarkCompress(b *testing.B) {
+	for _, algorithm := range compression.Algorithms() {
+		compressor, err := compression.GetCompressor(algorithm)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, size := range compressionPayloadSizes {
+			data := compressionPayload(size)
+			b.Run(fmt.Sprintf("%s/%d", algorithm, size), func(b *testing.B) {
+				b.SetBytes(int64(len(data)))
+				var compressed []byte
+				for i := 0; i < b.N; i++ {
+					compressed, err = compressor.Compress(data)
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.ReportMetric(float64(len(compressed))/float64(len(data)), "ratio")
+			})
+		}
+	}
+}
+
+func BenchmarkDecompress(b *testing.B) {
+	for _, algorithm := range compression.Algorithms() {
+		compressor, err := compression.GetCompressor(algorithm)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, size := range compressionPayloadSizes {
+			data := compressionPayload(size)
+			compressed, err := compressor.Compress(data)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.Run(fmt.Sprintf("%s/%d", algorithm, size), func(b *testing.B) {
+				b.SetBytes(int64(len(data)))
+				for i := 0; i < b.N; i++ {
+					if _, err := compressor.Decompress(compressed); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkMessagesEncoderCompression(b *testing.B) {
+	for _, algorithm := range compression.Algorithms() {
+		encoder, _, _ := message.NewMessagesEncoder(true).Negotiate([]string{algorithm}, nil)
+		for _, size := range compressionPayloadSizes {
+			data := compressionPayload(size)
+			b.Run(fmt.Sprintf("%s/%d", algorithm, size), func(b *testing.B) {
+				b.SetBytes(int64(len(data)))
+				for i := 0; i < b.N; i++ {
+					msg := &message.Message{Type: message.Push, Route: "room.state", Data: data}
+					if _, err := encoder.Encode(msg); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright (c) TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package benchmark
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/topfreegames/pitaya/v2/agent"
+	"github.com/topfreegames/pitaya/v2/conn/codec"
+	"github.com/topfreegames/pitaya/v2/conn/message"
+	"github.com/topfreegames/pitaya/v2/conn/packet"
+	"github.com/topfreegames/pitaya/v2/logger"
+	logruswrapper "github.com/topfreegames/pitaya/v2/logger/logrus"
+	"github.com/topfreegames/pitaya/v2/serialize/json"
+	"github.com/topfreegames/pitaya/v2/session"
+)
+
+// countingConn is a conn that discards the written data, counting the
+// writes, each of which would be a syscall in a real conn
+type countingConn struct {
+	writes  int64
+	written int64
+	closed  chan struct{}
+}
+
+func newCountingConn() *countingConn {
+	return &countingConn{closed: make(chan struct{})}
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	<-c.closed
+	return 0, net.ErrClosed
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	atomic.AddInt64(&c.writes, 1)
+	atomic.AddInt64(&c.written, int64(len(b)))
+	return len(b), nil
+}
+
+func (c *countingConn) Close() error {
+	select {
+	case <-c.closed:
+	default:
+		close(c.closed)
+	}
+	return nil
+}
+
+func (c *countingConn) LocalAddr() net.Addr                { return &net.TCPAddr{} }
+func (c *countingConn) RemoteAddr() net.Addr               { return &net.TCPAddr{} }
+func (c *countingConn) SetDeadline(t time.Time) error      { return nil }
+func (c *countingConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *countingConn) SetWriteDeadline(t time.Time) error { return nil }
+
+func BenchmarkAgentPushBurst(b *testing.B) {
+	const (
+		burst = 32
+		route = "room.state"
+	)
+	l := logrus.New()
+	l.SetLevel(logrus.FatalLevel)
+	logger.SetLogger(logruswrapper.NewWithLogger(l))
+
+	payload := bytes.Repeat([]byte("a"), 128)
+	m, err := message.NewMessagesEncoder(false).Encode(&message.Message{Type: message.Push, Route: route, Data: payload})
+	if err != nil {
+		b.Fatal(err)
+	}
+	p, err := codec.NewPomeloPacketEncoder().Encode(packet.Data, m)
+	if err != nil {
+		b.Fatal(err)
+	}
+	burstSize := int64(burst * len(p))
+
+	tables := []struct {
+		name string
+		opts []agent.AgentFactoryOption
+	}{
+		{"no_coalescing", nil},
+		{"coalescing", []agent.AgentFactoryOption{agent.WithWriteCoalescing(16*1024, 0)}},
+		{"coalescing_with_delay", []agent.AgentFactoryOption{agent.WithWriteCoalescing(16*1024, 100*time.Microsecond)}},
+	}
+
+	for _, table := range tables {
+		b.Run(fmt.Sprintf("%s/%d", table.name, burst), func(b *testing.B) {
+			factory := agent.NewAgentFactory(
+				make(chan bool), codec.NewPomeloPacketDecoder(), codec.NewPomeloPacketEncoder(), json.NewSerializer(),
+				time.Hour, message.NewMessagesEncoder(false), burst, session.NewSessionPool(), nil, table.opts...,
+			)
+			conn := newCountingConn()
+			ag := factory.CreateAgent(conn)
+			go ag.Handle()
+			defer ag.Close()
+
+			b.SetBytes(burstSize)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for j := 0; j < burst; j++ {
+					if err := ag.Push(route, payload); err != nil {
+						b.Fatal(err)
+					}
+				}
+				for atomic.LoadInt64(&conn.written) < int64(i+1)*burstSize {
+					runtime.Gosched()
+				}
+			}
+			b.StopTimer()
+			b.ReportMetric(float64(atomic.LoadInt64(&conn.writes))/float64(b.N), "writes/op")
+		})
+	}
+}
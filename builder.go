@@ -1,6 +1,8 @@
 package pitaya
 
 import (
+	"io/ioutil"
+
 	"github.com/google/uuid"
 	"github.com/topfreegames/pitaya/v2/acceptor"
 	"github.com/topfreegames/pitaya/v2/agent"
@@ -19,6 +21,7 @@ import (
 	"github.com/topfreegames/pitaya/v2/serialize/json"
 	"github.com/topfreegames/pitaya/v2/service"
 	"github.com/topfreegames/pitaya/v2/session"
+	"github.com/topfreegames/pitaya/v2/util/compression"
 	"github.com/topfreegames/pitaya/v2/worker"
 )
 
@@ -32,6 +35,7 @@ type Builder struct {
 	PacketEncoder    codec.PacketEncoder
 	MessageEncoder   *message.MessagesEncoder
 	Serializer       serialize.Serializer
+	Serializers      []serialize.Serializer
 	Router           *router.Router
 	RPCClient        cluster.RPCClient
 	RPCServer        cluster.RPCServer
@@ -182,6 +186,27 @@ func NewBuilder(isFrontend bool,
 		logger.Log.Fatalf("error creating default worker: %s", err.Error())
 	}
 
+	messageEncoder := message.NewMessagesEncoder(config.Pitaya.Handler.Messages.Compression)
+	// each app has its own route dictionary, shared by the encoder and the
+	// handler service, so apps in the same process do not mix their routes.
+	// It starts with the routes of message.SetDictionary, which is where
+	// they were set before the apps had their own dictionary
+	messageEncoder.Dictionary = message.NewDictionary()
+	if err := messageEncoder.Dictionary.Set(message.GetDictionary()); err != nil {
+		logger.Log.Fatalf("error copying the default route dictionary: %s", err.Error())
+	}
+	messageEncoder.CompressionThreshold = config.Pitaya.Handler.Messages.CompressionThreshold
+	messageEncoder.CompressionAlgorithms = config.Pitaya.Handler.Messages.CompressionAlgorithms
+	for _, path := range config.Pitaya.Handler.Messages.ZstdDictionaries {
+		dictionary, err := ioutil.ReadFile(path)
+		if err != nil {
+			logger.Log.Fatalf("error reading zstd dictionary %s: %s", path, err.Error())
+		}
+		if _, err := compression.LoadZstdDictionary(dictionary); err != nil {
+			logger.Log.Fatalf("error loading zstd dictionary %s: %s", path, err.Error())
+		}
+	}
+
 	gsi := groups.NewMemoryGroupService(groupServiceConfig)
 	if err != nil {
 		panic(err)
@@ -194,7 +219,7 @@ func NewBuilder(isFrontend bool,
 		DieChan:          dieChan,
 		PacketDecoder:    codec.NewPomeloPacketDecoder(),
 		PacketEncoder:    codec.NewPomeloPacketEncoder(),
-		MessageEncoder:   message.NewMessagesEncoder(config.Pitaya.Handler.Messages.Compression),
+		MessageEncoder:   messageEncoder,
 		Serializer:       json.NewSerializer(),
 		Router:           router.New(),
 		RPCClient:        rpcClient,
@@ -255,9 +280,30 @@ func (builder *Builder) Build() Pitaya {
 			handlerPool,
 		)
 
+		remoteService.SetSerializers(builder.Serializers)
 		builder.RPCServer.SetPitayaServer(remoteService)
 	}
 
+	var agentOpts []agent.AgentFactoryOption
+	if writeCoalescing := builder.Config.Pitaya.Conn.WriteCoalescing; writeCoalescing.Enabled {
+		agentOpts = append(agentOpts, agent.WithWriteCoalescing(writeCoalescing.MaxBytes, writeCoalescing.FlushDelay))
+	}
+	if encryption := builder.Config.Pitaya.Conn.Encryption; encryption.Enabled {
+		ciphers := encryption.Ciphers
+		if len(ciphers) == 0 {
+			ciphers = codec.Ciphers()
+		}
+		agentOpts = append(agentOpts, agent.WithEncryption(ciphers))
+	}
+	if replayProtection := builder.Config.Pitaya.Conn.ReplayProtection; replayProtection.Enabled {
+		if replayProtection.Window <= 0 {
+			logger.Log.Fatalf("invalid replay protection window %d, it must be positive", replayProtection.Window)
+		}
+		agentOpts = append(agentOpts, agent.WithReplayProtection(replayProtection.Window))
+	}
+	if len(builder.Serializers) > 0 {
+		agentOpts = append(agentOpts, agent.WithSerializers(builder.Serializers...))
+	}
 	agentFactory := agent.NewAgentFactory(builder.DieChan,
 		builder.PacketDecoder,
 		builder.PacketEncoder,
@@ -267,6 +313,7 @@ func (builder *Builder) Build() Pitaya {
 		builder.Config.Pitaya.Buffer.Agent.Messages,
 		builder.SessionPool,
 		builder.MetricsReporters,
+		agentOpts...,
 	)
 
 	handlerService := service.NewHandlerService(
@@ -281,6 +328,11 @@ func (builder *Builder) Build() Pitaya {
 		builder.HandlerHooks,
 		handlerPool,
 	)
+	handlerService.SetHandshakeConfig(builder.Config.Pitaya.Handshake)
+	handlerService.SetRouteDictionary(builder.MessageEncoder.GetDictionary())
+	if rateLimiting := builder.Config.Pitaya.Conn.RouteRateLimiting; rateLimiting.Enabled {
+		handlerService.SetRouteRateLimiter(service.NewRouteRateLimiter(builder.MetricsReporters, rateLimiting))
+	}
 
 	app := NewApp(
 		builder.ServerMode,
@@ -300,6 +352,8 @@ func (builder *Builder) Build() Pitaya {
 		builder.MetricsReporters,
 		builder.Config.Pitaya,
 	)
+	app.dictionary = builder.MessageEncoder.GetDictionary()
+	app.serializers = builder.Serializers
 
 	for _, postBuildHook := range builder.postBuildHooks {
 		postBuildHook(app)
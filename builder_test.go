@@ -24,6 +24,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/topfreegames/pitaya/v2/acceptor"
 	"github.com/topfreegames/pitaya/v2/config"
+	"github.com/topfreegames/pitaya/v2/conn/message"
 	"testing"
 )
 
@@ -56,3 +57,33 @@ func TestPostBuildHooks(t *testing.T) {
 		})
 	}
 }
+
+func TestBuildersHaveTheirOwnRouteDictionary(t *testing.T) {
+	builderConfig := config.NewDefaultBuilderConfig()
+	builder1 := NewDefaultBuilder(true, "type1", Standalone, map[string]string{}, *builderConfig)
+	app1 := builder1.Build().(*App)
+	builder2 := NewDefaultBuilder(true, "type2", Standalone, map[string]string{}, *builderConfig)
+	app2 := builder2.Build().(*App)
+
+	assert.NoError(t, app1.SetDictionary(map[string]uint16{"type1.room.join": 1}))
+	assert.NoError(t, app2.SetDictionary(map[string]uint16{"type2.room.leave": 1}))
+
+	assert.Equal(t, map[string]uint16{"type1.room.join": 1}, builder1.MessageEncoder.GetDictionary().Routes())
+	assert.Equal(t, map[string]uint16{"type2.room.leave": 1}, builder2.MessageEncoder.GetDictionary().Routes())
+	assert.Same(t, builder1.MessageEncoder.GetDictionary(), app1.dictionary)
+	assert.Same(t, builder2.MessageEncoder.GetDictionary(), app2.dictionary)
+	assert.NotContains(t, message.GetDictionary(), "type1.room.join")
+	assert.NotContains(t, message.GetDictionary(), "type2.room.leave")
+}
+
+func TestBuilderRouteDictionaryHasTheDefaultRoutes(t *testing.T) {
+	assert.NoError(t, message.SetDictionary(map[string]uint16{"default.room.join": 1000}))
+
+	builderConfig := config.NewDefaultBuilderConfig()
+	builder := NewDefaultBuilder(true, "type1", Standalone, map[string]string{}, *builderConfig)
+	app := builder.Build().(*App)
+	assert.NoError(t, app.SetDictionary(map[string]uint16{"type1.room.join": 1}))
+
+	assert.Equal(t, map[string]uint16{"default.room.join": 1000, "type1.room.join": 1}, app.dictionary.Routes())
+	assert.NotContains(t, message.GetDictionary(), "type1.room.join")
+}
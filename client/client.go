@@ -37,11 +37,13 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/sirupsen/logrus"
 	"github.com/topfreegames/pitaya/v2"
+	"github.com/topfreegames/pitaya/v2/config"
 	"github.com/topfreegames/pitaya/v2/conn/codec"
 	"github.com/topfreegames/pitaya/v2/conn/message"
 	"github.com/topfreegames/pitaya/v2/conn/packet"
 	"github.com/topfreegames/pitaya/v2/logger"
 	logruswrapper "github.com/topfreegames/pitaya/v2/logger/logrus"
+	"github.com/topfreegames/pitaya/v2/serialize"
 	"github.com/topfreegames/pitaya/v2/session"
 	"github.com/topfreegames/pitaya/v2/util/compression"
 )
@@ -51,6 +53,32 @@ type HandshakeSys struct {
 	Dict       map[string]uint16 `json:"dict"`
 	Heartbeat  int               `json:"heartbeat"`
 	Serializer string            `json:"serializer"`
+	// PacketCodec is the codec of the packets after the handshake, which is
+	// the one requested by the client when the server supports it
+	PacketCodec string `json:"packetCodec"`
+	// Compression is the algorithm picked by the server for the messages
+	Compression string `json:"compression"`
+	// CompressionDictionary is the ID of the zstd dictionary picked by the
+	// server for the messages, zero when there is none
+	CompressionDictionary uint32 `json:"compressionDictionary"`
+	// DictHash is the hash of the route dictionary, which is not sent in
+	// Dict when the client has it cached
+	DictHash string `json:"dictHash"`
+	// Encryption is the cipher picked by the server to seal the data
+	// packets, empty when they are not sealed
+	Encryption string `json:"encryption"`
+	// PublicKey is the X25519 public key of the server, which is sent
+	// along with Encryption
+	PublicKey []byte `json:"publicKey"`
+	// Sequence tells whether the server rejects the messages without
+	// sequence numbers, which the client then stamps in every message
+	Sequence bool `json:"sequence"`
+	// ProtocolVersion is the protocol version of the messages picked by the
+	// server, zero when it does not negotiate it
+	ProtocolVersion int `json:"protocolVersion"`
+	// Serializers are the serializers supported by the server, which are
+	// only sent to the clients that request one
+	Serializers []string `json:"serializers"`
 }
 
 // HandshakeData struct
@@ -75,11 +103,19 @@ type Client struct {
 	pendingChan         chan bool
 	pendingRequests     map[uint]*pendingRequest
 	pendingReqMutex     sync.Mutex
+	sendMutex           sync.Mutex
 	requestTimeout      time.Duration
 	closeChan           chan struct{}
 	nextID              uint32
+	sequenced           bool
+	nextSeq             uint64
+	protocolVersion     int
 	messageEncoder      message.Encoder
+	dictionary          *message.Dictionary
 	clientHandshakeData *session.HandshakeData
+	clientCert          *tls.Certificate
+	keyExchange         *codec.KeyExchange
+	serializer          serialize.Serializer
 }
 
 // MsgChannel return the incoming message channel
@@ -105,6 +141,10 @@ func New(logLevel logrus.Level, requestTimeout ...time.Duration) *Client {
 		reqTimeout = requestTimeout[0]
 	}
 
+	dictionary := message.NewDictionary()
+	messageEncoder := message.NewMessagesEncoder(false)
+	messageEncoder.Dictionary = dictionary
+
 	return &Client{
 		Connected:       false,
 		packetEncoder:   codec.NewPomeloPacketEncoder(),
@@ -115,7 +155,8 @@ func New(logLevel logrus.Level, requestTimeout ...time.Duration) *Client {
 		// 30 here is the limit of inflight messages
 		// TODO this should probably be configurable
 		pendingChan:    make(chan bool, 30),
-		messageEncoder: message.NewMessagesEncoder(false),
+		messageEncoder: messageEncoder,
+		dictionary:     dictionary,
 		clientHandshakeData: &session.HandshakeData{
 			Sys: session.HandshakeClientData{
 				Platform:    "mac",
@@ -135,7 +176,123 @@ func (c *Client) SetClientHandshakeData(data *session.HandshakeData) {
 	c.clientHandshakeData = data
 }
 
+// SetSerializer sets the serializer of the messages, such as msgpack, which is
+// requested in the handshake. The data of the requests and notifies is then
+// written as JSON and sent encoded with it, and the data of the messages
+// received is decoded with it and delivered as JSON. The connection fails if
+// the server picks another serializer. The data is sent and delivered as is
+// when it is not set
+func (c *Client) SetSerializer(serializer serialize.Serializer) {
+	c.serializer = serializer
+}
+
+// RouteDictionary returns the route dictionary received from the server and
+// its hash, which can be cached and set with SetRouteDictionary before
+// connecting again
+func (c *Client) RouteDictionary() (map[string]uint16, string) {
+	return c.dictionary.Routes(), c.dictionary.Hash()
+}
+
+// SetRouteDictionary sets the route dictionary cached from a previous
+// connection and sends its hash in the handshake, so that the server only
+// sends the dictionary again if it changed
+func (c *Client) SetRouteDictionary(dict map[string]uint16) error {
+	if err := c.setRouteDictionary(dict); err != nil {
+		return err
+	}
+	c.clientHandshakeData.Sys.DictHash = c.dictionary.Hash()
+	return nil
+}
+
+func (c *Client) setRouteDictionary(dict map[string]uint16) error {
+	dictionary := message.NewDictionary()
+	if err := dictionary.Set(dict); err != nil {
+		return err
+	}
+	messageEncoder := message.NewMessagesEncoder(false)
+	messageEncoder.Dictionary = dictionary
+	c.dictionary = dictionary
+	c.messageEncoder = messageEncoder
+	return nil
+}
+
+// LoadZstdDictionary loads a zstd dictionary and advertises it in the
+// handshake, so that the server can compress the messages with it
+func (c *Client) LoadZstdDictionary(dictionary []byte) error {
+	id, err := compression.LoadZstdDictionary(dictionary)
+	if err != nil {
+		return err
+	}
+	sys := &c.clientHandshakeData.Sys
+	for _, loaded := range sys.CompressionDictionaries {
+		if loaded == id {
+			return nil
+		}
+	}
+	sys.CompressionDictionaries = append(sys.CompressionDictionaries, id)
+	return nil
+}
+
+// EnableEncryption advertises the ciphers in the handshake, by order of
+// preference, so that the packets are sealed with one of them. All the
+// supported ciphers are advertised when none is given. The connection fails
+// if the server does not pick any of them. The key exchange is not
+// authenticated, so it only protects against passive eavesdropping
+func (c *Client) EnableEncryption(ciphers ...string) {
+	if len(ciphers) == 0 {
+		ciphers = codec.Ciphers()
+	}
+	c.clientHandshakeData.Sys.Encryption = ciphers
+}
+
+// EnableCompression advertises the compression algorithms in the handshake,
+// by order of preference, so that the server can compress the messages with
+// one of them instead of deflate. All the supported algorithms are
+// advertised when none is given
+func (c *Client) EnableCompression(algorithms ...string) {
+	if len(algorithms) == 0 {
+		algorithms = compression.Algorithms()
+	}
+	c.clientHandshakeData.Sys.Compression = algorithms
+}
+
+// EnableSequence advertises sequence numbers in the handshake, so that the
+// messages sent are stamped with them when the server has replay
+// protection enabled
+func (c *Client) EnableSequence() {
+	c.clientHandshakeData.Sys.Sequence = true
+}
+
+// EnableLengthPrefixedPacketCodec requests the length prefixed packet codec
+// in the handshake, so that packets larger than 16MB can be exchanged with
+// the servers that support it
+func (c *Client) EnableLengthPrefixedPacketCodec() {
+	c.clientHandshakeData.Sys.PacketCodec = codec.LengthPrefixedPacketCodec
+	c.packetDecoder = codec.NewLengthPrefixedPacketDecoder()
+}
+
+// EnableProtocolVersions advertises every protocol version supported by the
+// client in the handshake, so that the server can pick a newer one than the
+// first, which allows routes longer than 255 bytes
+func (c *Client) EnableProtocolVersions() {
+	c.clientHandshakeData.Sys.MinProtocolVersion = message.MinProtocolVersion
+	c.clientHandshakeData.Sys.MaxProtocolVersion = message.MaxProtocolVersion
+}
+
 func (c *Client) sendHandshakeRequest() error {
+	if len(c.clientHandshakeData.Sys.Encryption) > 0 {
+		keyExchange, err := codec.NewKeyExchange()
+		if err != nil {
+			return err
+		}
+		c.keyExchange = keyExchange
+		c.clientHandshakeData.Sys.PublicKey = keyExchange.PublicKey()
+	}
+
+	if c.serializer != nil {
+		c.clientHandshakeData.Sys.Serializer = c.serializer.GetName()
+	}
+
 	enc, err := json.Marshal(c.clientHandshakeData)
 	if err != nil {
 		return err
@@ -177,9 +334,25 @@ func (c *Client) handleHandshakeResponse() error {
 
 	logger.Log.Debug("got handshake from sv, data: %v", handshake)
 
+	if c.serializer != nil && handshake.Sys.Serializer != c.serializer.GetName() {
+		return fmt.Errorf("server picked the %s serializer instead of %s", handshake.Sys.Serializer, c.serializer.GetName())
+	}
 	if handshake.Sys.Dict != nil {
-		message.SetDictionary(handshake.Sys.Dict)
+		if err := c.setRouteDictionary(handshake.Sys.Dict); err != nil {
+			return err
+		}
+	}
+	if handshake.Sys.PacketCodec == codec.LengthPrefixedPacketCodec {
+		c.packetEncoder = codec.NewLengthPrefixedPacketEncoder()
 	}
+	if c.keyExchange != nil {
+		if err := c.setEncryption(handshake.Sys); err != nil {
+			return err
+		}
+	}
+	c.setProtocolVersion(handshake.Sys.ProtocolVersion)
+	c.sequenced = handshake.Sys.Sequence
+	c.nextSeq = 0
 	p, err := c.packetEncoder.Encode(packet.HandshakeAck, []byte{})
 	if err != nil {
 		return err
@@ -199,6 +372,33 @@ func (c *Client) handleHandshakeResponse() error {
 	return nil
 }
 
+// setProtocolVersion encodes and decodes the messages with the protocol
+// version picked by the server, which is the first one when it picked none
+func (c *Client) setProtocolVersion(version int) {
+	if version == 0 {
+		version = message.ProtocolVersion1
+	}
+	c.protocolVersion = version
+	if encoder, ok := c.messageEncoder.(message.VersionedEncoder); ok {
+		c.messageEncoder = encoder.WithProtocolVersion(version)
+	}
+}
+
+// setEncryption seals the packets sent to the server and opens the ones
+// received with the cipher it picked
+func (c *Client) setEncryption(sys HandshakeSys) error {
+	if sys.Encryption == "" {
+		return fmt.Errorf("server did not negotiate encryption")
+	}
+	cipher, err := c.keyExchange.ClientCipher(sys.Encryption, sys.PublicKey)
+	if err != nil {
+		return err
+	}
+	c.packetEncoder = codec.NewEncryptedPacketEncoder(c.packetEncoder, cipher)
+	c.packetDecoder = codec.NewEncryptedPacketDecoder(c.packetDecoder, cipher)
+	return nil
+}
+
 // pendingRequestsReaper delete timedout requests
 func (c *Client) pendingRequestsReaper() {
 	ticker := time.NewTicker(1 * time.Second)
@@ -243,10 +443,13 @@ func (c *Client) handlePackets() {
 			case packet.Data:
 				//handle data
 				logger.Log.Debug("got data: %s", string(p.Data))
-				m, err := message.Decode(p.Data)
+				m, err := message.DecodeWithVersion(p.Data, c.dictionary, c.protocolVersion)
 				if err != nil {
 					logger.Log.Errorf("error decoding msg from sv: %s", string(m.Data))
 				}
+				if err := c.decodeData(m); err != nil {
+					logger.Log.Errorf("error decoding msg data from sv: %s", err.Error())
+				}
 				if m.Type == message.Response {
 					c.pendingReqMutex.Lock()
 					if _, ok := c.pendingRequests[m.ID]; ok {
@@ -288,7 +491,7 @@ func (c *Client) readPackets(buf *bytes.Buffer) ([]*packet.Packet, error) {
 	}
 	totalProcessed := 0
 	for _, p := range packets {
-		totalProcessed += codec.HeadLength + p.Length
+		totalProcessed += codec.PacketHeadLength(buf.Bytes()[totalProcessed]) + p.Length
 	}
 	buf.Next(totalProcessed)
 
@@ -320,9 +523,7 @@ func (c *Client) sendHeartbeats(interval int) {
 	for {
 		select {
 		case <-t.C:
-			p, _ := c.packetEncoder.Encode(packet.Heartbeat, []byte{})
-			_, err := c.conn.Write(p)
-			if err != nil {
+			if err := c.sendHeartbeat(); err != nil {
 				logger.Log.Errorf("error sending heartbeat to server: %s", err.Error())
 				return
 			}
@@ -332,6 +533,19 @@ func (c *Client) sendHeartbeats(interval int) {
 	}
 }
 
+// sendHeartbeat writes a heartbeat, in order with the other packets since
+// it is sealed like them when encryption is negotiated
+func (c *Client) sendHeartbeat() error {
+	c.sendMutex.Lock()
+	defer c.sendMutex.Unlock()
+	p, err := c.packetEncoder.Encode(packet.Heartbeat, []byte{})
+	if err != nil {
+		return err
+	}
+	_, err = c.conn.Write(p)
+	return err
+}
+
 // Disconnect disconnects the client
 func (c *Client) Disconnect() {
 	if c.Connected {
@@ -341,13 +555,39 @@ func (c *Client) Disconnect() {
 	}
 }
 
+// SetClientCertificate sets the certificate presented to servers that
+// require TLS client authentication, connecting with it always uses TLS
+func (c *Client) SetClientCertificate(cert tls.Certificate) {
+	c.clientCert = &cert
+}
+
+// tlsConfig returns the tls config to connect with, adding the client
+// certificate to it, or nil if the connection should not use TLS
+func (c *Client) tlsConfig(tlsConfig ...*tls.Config) *tls.Config {
+	var tlsCfg *tls.Config
+	if len(tlsConfig) > 0 {
+		tlsCfg = tlsConfig[0]
+	}
+	if c.clientCert == nil {
+		return tlsCfg
+	}
+
+	if tlsCfg == nil {
+		tlsCfg = &tls.Config{}
+	} else {
+		tlsCfg = tlsCfg.Clone()
+	}
+	tlsCfg.Certificates = []tls.Certificate{*c.clientCert}
+	return tlsCfg
+}
+
 // ConnectTo connects to the server at addr, for now the only supported protocol is tcp
 // if tlsConfig is sent, it connects using TLS
 func (c *Client) ConnectTo(addr string, tlsConfig ...*tls.Config) error {
 	var conn net.Conn
 	var err error
-	if len(tlsConfig) > 0 {
-		conn, err = tls.Dial("tcp", addr, tlsConfig[0])
+	if tlsCfg := c.tlsConfig(tlsConfig...); tlsCfg != nil {
+		conn, err = tls.Dial("tcp", addr, tlsCfg)
 	} else {
 		conn, err = net.Dial("tcp", addr)
 	}
@@ -371,8 +611,8 @@ func (c *Client) ConnectToWS(addr string, path string, tlsConfig ...*tls.Config)
 	u := url.URL{Scheme: "ws", Host: addr, Path: path}
 	dialer := websocket.DefaultDialer
 
-	if len(tlsConfig) > 0 {
-		dialer.TLSClientConfig = tlsConfig[0]
+	if tlsCfg := c.tlsConfig(tlsConfig...); tlsCfg != nil {
+		dialer.TLSClientConfig = tlsCfg
 		u.Scheme = "wss"
 	}
 
@@ -397,6 +637,68 @@ func (c *Client) ConnectToWS(addr string, path string, tlsConfig ...*tls.Config)
 	return nil
 }
 
+// ConnectToKCP connects using kcp protocol, if kcpConfig is not sent the
+// default KCPAcceptor configuration is used
+func (c *Client) ConnectToKCP(addr string, kcpConfig ...config.KCPAcceptorConfig) error {
+	conf := *config.NewDefaultKCPAcceptorConfig()
+	if len(kcpConfig) > 0 {
+		conf = kcpConfig[0]
+	}
+
+	conn, err := acceptor.DialKCP(addr, conf)
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	c.IncomingMsgChan = make(chan *message.Message, 10)
+
+	if err = c.handleHandshake(); err != nil {
+		return err
+	}
+
+	c.closeChan = make(chan struct{})
+
+	return nil
+}
+
+// ConnectToQUIC connects using quic protocol, if tlsConfig is not sent
+// the default tls configuration is used to verify the server
+func (c *Client) ConnectToQUIC(addr string, tlsConfig ...*tls.Config) error {
+	conn, err := acceptor.DialQUIC(addr, c.tlsConfig(tlsConfig...))
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	c.IncomingMsgChan = make(chan *message.Message, 10)
+
+	if err = c.handleHandshake(); err != nil {
+		return err
+	}
+
+	c.closeChan = make(chan struct{})
+
+	return nil
+}
+
+// ConnectToMemory connects to a MemoryAcceptor, it blocks until the
+// connection is accepted by the app serving the acceptor
+func (c *Client) ConnectToMemory(memoryAcceptor *acceptor.MemoryAcceptor) error {
+	conn, err := memoryAcceptor.Dial()
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	c.IncomingMsgChan = make(chan *message.Message, 10)
+
+	if err = c.handleHandshake(); err != nil {
+		return err
+	}
+
+	c.closeChan = make(chan struct{})
+
+	return nil
+}
+
 func (c *Client) handleHandshake() error {
 	if err := c.sendHandshakeRequest(); err != nil {
 		return err
@@ -420,6 +722,9 @@ func (c *Client) SendNotify(route string, data []byte) error {
 }
 
 func (c *Client) buildPacket(msg message.Message) ([]byte, error) {
+	if c.sequenced {
+		msg.Seq = atomic.AddUint64(&c.nextSeq, 1)
+	}
 	encMsg, err := c.messageEncoder.Encode(&msg)
 	if err != nil {
 		return nil, err
@@ -435,6 +740,10 @@ func (c *Client) buildPacket(msg message.Message) ([]byte, error) {
 // sendMsg sends the request to the server
 func (c *Client) sendMsg(msgType message.Type, route string, data []byte) (uint, error) {
 	// TODO mount msg and encode
+	data, err := c.encodeData(data)
+	if err != nil {
+		return 0, err
+	}
 	m := message.Message{
 		Type:  msgType,
 		ID:    uint(atomic.AddUint32(&c.nextID, 1)),
@@ -442,7 +751,6 @@ func (c *Client) sendMsg(msgType message.Type, route string, data []byte) (uint,
 		Data:  data,
 		Err:   false,
 	}
-	p, err := c.buildPacket(m)
 	if msgType == message.Request {
 		c.pendingChan <- true
 		c.pendingReqMutex.Lock()
@@ -455,6 +763,11 @@ func (c *Client) sendMsg(msgType message.Type, route string, data []byte) (uint,
 		c.pendingReqMutex.Unlock()
 	}
 
+	// packets are written in the order they are built, as the server
+	// rejects the sealed ones whose nonce is older than the last received
+	c.sendMutex.Lock()
+	defer c.sendMutex.Unlock()
+	p, err := c.buildPacket(m)
 	if err != nil {
 		return m.ID, err
 	}
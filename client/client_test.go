@@ -1,15 +1,31 @@
 package client
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"github.com/topfreegames/pitaya/v2"
+	"github.com/topfreegames/pitaya/v2/acceptor"
+	"github.com/topfreegames/pitaya/v2/component"
+	"github.com/topfreegames/pitaya/v2/config"
+	"github.com/topfreegames/pitaya/v2/conn/codec"
 	"github.com/topfreegames/pitaya/v2/conn/message"
+	"github.com/topfreegames/pitaya/v2/constants"
 	"github.com/topfreegames/pitaya/v2/helpers"
 	"github.com/topfreegames/pitaya/v2/mocks"
+	"github.com/topfreegames/pitaya/v2/serialize"
+	"github.com/topfreegames/pitaya/v2/serialize/msgpack"
+	"github.com/topfreegames/pitaya/v2/serialize/protobuf"
+	"github.com/topfreegames/pitaya/v2/util/compression"
 )
 
 func TestSendRequestShouldTimeout(t *testing.T) {
@@ -46,3 +62,451 @@ func TestSendRequestShouldTimeout(t *testing.T) {
 
 	assert.Equal(t, true, msg.Err)
 }
+
+func TestClientTLSConfig(t *testing.T) {
+	c := New(logrus.InfoLevel)
+	assert.Nil(t, c.tlsConfig())
+
+	serverCfg := &tls.Config{ServerName: "example.com"}
+	assert.Equal(t, serverCfg, c.tlsConfig(serverCfg))
+
+	cert := tls.Certificate{Certificate: [][]byte{{0x01}}}
+	c.SetClientCertificate(cert)
+
+	tlsCfg := c.tlsConfig()
+	assert.Equal(t, []tls.Certificate{cert}, tlsCfg.Certificates)
+
+	tlsCfg = c.tlsConfig(serverCfg)
+	assert.Equal(t, "example.com", tlsCfg.ServerName)
+	assert.Equal(t, []tls.Certificate{cert}, tlsCfg.Certificates)
+	assert.Empty(t, serverCfg.Certificates)
+}
+
+func TestClientHandshakeOptions(t *testing.T) {
+	c := New(logrus.InfoLevel)
+	sys := c.clientHandshakeData.Sys
+	assert.Empty(t, sys.Compression)
+	assert.False(t, sys.Sequence)
+	assert.Empty(t, sys.PacketCodec)
+	assert.Zero(t, sys.MinProtocolVersion)
+	assert.Zero(t, sys.MaxProtocolVersion)
+	assert.IsType(t, codec.NewPomeloPacketDecoder(), c.packetDecoder)
+
+	c.EnableCompression()
+	c.EnableSequence()
+	c.EnableLengthPrefixedPacketCodec()
+	c.EnableProtocolVersions()
+	sys = c.clientHandshakeData.Sys
+	assert.Equal(t, compression.Algorithms(), sys.Compression)
+	assert.True(t, sys.Sequence)
+	assert.Equal(t, codec.LengthPrefixedPacketCodec, sys.PacketCodec)
+	assert.Equal(t, message.MinProtocolVersion, sys.MinProtocolVersion)
+	assert.Equal(t, message.MaxProtocolVersion, sys.MaxProtocolVersion)
+	assert.IsType(t, codec.NewLengthPrefixedPacketDecoder(), c.packetDecoder)
+
+	c.EnableCompression(compression.Snappy)
+	assert.Equal(t, []string{compression.Snappy}, c.clientHandshakeData.Sys.Compression)
+}
+
+func TestClientEncodeData(t *testing.T) {
+	c := New(logrus.InfoLevel)
+	data := []byte(`{"int":1,"float":1.5,"ints":[2,3]}`)
+	encoded, err := c.encodeData(data)
+	assert.NoError(t, err)
+	assert.Equal(t, data, encoded)
+
+	serializer := msgpack.NewSerializer()
+	c.SetSerializer(serializer)
+	encoded, err = c.encodeData(data)
+	assert.NoError(t, err)
+	decoded := struct {
+		Int   int     `json:"int"`
+		Float float64 `json:"float"`
+		Ints  []int32 `json:"ints"`
+	}{}
+	assert.NoError(t, serializer.Unmarshal(encoded, &decoded))
+	assert.Equal(t, 1, decoded.Int)
+	assert.Equal(t, 1.5, decoded.Float)
+	assert.Equal(t, []int32{2, 3}, decoded.Ints)
+
+	m := &message.Message{Data: encoded}
+	assert.NoError(t, c.decodeData(m))
+	assert.JSONEq(t, string(data), string(m.Data))
+}
+
+type MemoryTestMessage struct {
+	Data string `json:"data"`
+}
+
+type MemoryTestComp struct {
+	component.Base
+}
+
+func (c *MemoryTestComp) Echo(ctx context.Context, msg *MemoryTestMessage) (*MemoryTestMessage, error) {
+	s := pitaya.GetSessionFromCtx(ctx)
+	if err := s.Push("memory.pushed", msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (c *MemoryTestComp) Large(ctx context.Context, msg *MemoryTestMessage) (*MemoryTestMessage, error) {
+	return &MemoryTestMessage{Data: strings.Repeat(msg.Data, codec.MaxPacketSize)}, nil
+}
+
+func (c *MemoryTestComp) LongPush(ctx context.Context, msg *MemoryTestMessage) (*MemoryTestMessage, error) {
+	s := pitaya.GetSessionFromCtx(ctx)
+	if err := s.Push(strings.Repeat("memory.", 50)+"pushed", msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// memoryAppOption changes the config of the app started by startMemoryApp,
+// or its builder once the config is applied
+type memoryAppOption struct {
+	config  func(cfg *config.BuilderConfig)
+	builder func(builder *pitaya.Builder)
+}
+
+func withConfig(f func(cfg *config.BuilderConfig)) memoryAppOption {
+	return memoryAppOption{config: f}
+}
+
+func withBuilder(f func(builder *pitaya.Builder)) memoryAppOption {
+	return memoryAppOption{builder: f}
+}
+
+// startMemoryApp starts a standalone app serving MemoryTestComp on a memory
+// acceptor, which is shut down when the test finishes
+func startMemoryApp(t *testing.T, opts ...memoryAppOption) (*acceptor.MemoryAcceptor, *pitaya.Builder) {
+	t.Helper()
+	cfg := config.NewDefaultBuilderConfig()
+	for _, opt := range opts {
+		if opt.config != nil {
+			opt.config(cfg)
+		}
+	}
+	acc := acceptor.NewMemoryAcceptor("memory")
+	builder := pitaya.NewDefaultBuilder(true, "testtype", pitaya.Standalone, map[string]string{}, *cfg)
+	for _, opt := range opts {
+		if opt.builder != nil {
+			opt.builder(builder)
+		}
+	}
+	builder.AddAcceptor(acc)
+	app := builder.Build()
+	app.Register(&MemoryTestComp{}, component.WithName("memory"))
+	assert.NoError(t, app.AddPushRoutes("memory.pushed"))
+	go app.Start()
+	t.Cleanup(app.Shutdown)
+	helpers.ShouldEventuallyReturn(t, func() bool {
+		return app.IsRunning() && acc.IsRunning()
+	}, true)
+	return acc, builder
+}
+
+func TestConnectToMemory(t *testing.T) {
+	acc, _ := startMemoryApp(t)
+
+	c := New(logrus.InfoLevel)
+	assert.NoError(t, c.ConnectToMemory(acc))
+	defer c.Disconnect()
+
+	data, err := json.Marshal(&MemoryTestMessage{Data: "hello"})
+	assert.NoError(t, err)
+	_, err = c.SendRequest("testtype.memory.Echo", data)
+	assert.NoError(t, err)
+
+	received := map[message.Type]*message.Message{}
+	for len(received) < 2 {
+		msg := helpers.ShouldEventuallyReceive(t, c.IncomingMsgChan, time.Second).(*message.Message)
+		received[msg.Type] = msg
+	}
+	assert.Equal(t, "memory.pushed", received[message.Push].Route)
+	assert.JSONEq(t, string(data), string(received[message.Push].Data))
+	assert.False(t, received[message.Response].Err)
+	assert.JSONEq(t, string(data), string(received[message.Response].Data))
+}
+
+func TestConnectToMemoryLengthPrefixedPacketCodec(t *testing.T) {
+	acc, _ := startMemoryApp(t, withBuilder(func(builder *pitaya.Builder) {
+		builder.PacketEncoder = codec.NewLengthPrefixedPacketEncoder()
+		builder.PacketDecoder = codec.NewLengthPrefixedPacketDecoder()
+	}))
+
+	c := New(logrus.InfoLevel)
+	c.EnableLengthPrefixedPacketCodec()
+	assert.NoError(t, c.ConnectToMemory(acc))
+	defer c.Disconnect()
+
+	data, err := json.Marshal(&MemoryTestMessage{Data: "a"})
+	assert.NoError(t, err)
+	_, err = c.SendRequest("testtype.memory.Large", data)
+	assert.NoError(t, err)
+
+	msg := helpers.ShouldEventuallyReceive(t, c.IncomingMsgChan, 5*time.Second).(*message.Message)
+	assert.False(t, msg.Err)
+	response := &MemoryTestMessage{}
+	assert.NoError(t, json.Unmarshal(msg.Data, response))
+	assert.Equal(t, codec.MaxPacketSize, len(response.Data))
+}
+
+func TestConnectToMemoryZstdDictionary(t *testing.T) {
+	dictionaryPath := filepath.Join("..", "util", "compression", "fixtures", "zstd_dictionary_2")
+	acc, _ := startMemoryApp(t, withConfig(func(cfg *config.BuilderConfig) {
+		cfg.Pitaya.Handler.Messages.ZstdDictionaries = []string{dictionaryPath}
+	}))
+
+	c := New(logrus.InfoLevel)
+	c.EnableCompression()
+	dictionary, err := os.ReadFile(dictionaryPath)
+	assert.NoError(t, err)
+	assert.NoError(t, c.LoadZstdDictionary(dictionary))
+	assert.NoError(t, c.LoadZstdDictionary(dictionary))
+	assert.Equal(t, []uint32{2}, c.clientHandshakeData.Sys.CompressionDictionaries)
+	assert.NoError(t, c.ConnectToMemory(acc))
+	defer c.Disconnect()
+
+	data, err := json.Marshal(&MemoryTestMessage{Data: "hello"})
+	assert.NoError(t, err)
+	_, err = c.SendRequest("testtype.memory.Echo", data)
+	assert.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		msg := helpers.ShouldEventuallyReceive(t, c.IncomingMsgChan, time.Second).(*message.Message)
+		assert.False(t, msg.Err)
+		assert.JSONEq(t, string(data), string(msg.Data))
+	}
+}
+
+func TestConnectToMemoryRouteDictionary(t *testing.T) {
+	acc, builder := startMemoryApp(t, withConfig(func(cfg *config.BuilderConfig) {
+		cfg.Pitaya.Handler.Messages.RouteDictionary = true
+	}))
+
+	request := func(c *Client) {
+		data, err := json.Marshal(&MemoryTestMessage{Data: "hello"})
+		assert.NoError(t, err)
+		_, err = c.SendRequest("testtype.memory.Echo", data)
+		assert.NoError(t, err)
+
+		received := map[message.Type]*message.Message{}
+		for len(received) < 2 {
+			msg := helpers.ShouldEventuallyReceive(t, c.IncomingMsgChan, time.Second).(*message.Message)
+			received[msg.Type] = msg
+		}
+		assert.Equal(t, "memory.pushed", received[message.Push].Route)
+		assert.JSONEq(t, string(data), string(received[message.Response].Data))
+	}
+
+	c := New(logrus.InfoLevel)
+	assert.NoError(t, c.ConnectToMemory(acc))
+	dict, hash := c.RouteDictionary()
+	assert.Contains(t, dict, "memory.pushed")
+	assert.Contains(t, dict, "testtype.memory.Echo")
+	assert.Equal(t, builder.MessageEncoder.Dictionary.Hash(), hash)
+	request(c)
+	c.Disconnect()
+
+	cached := New(logrus.InfoLevel)
+	assert.NoError(t, cached.SetRouteDictionary(dict))
+	assert.Equal(t, hash, cached.clientHandshakeData.Sys.DictHash)
+	assert.NoError(t, cached.ConnectToMemory(acc))
+	defer cached.Disconnect()
+	cachedDict, _ := cached.RouteDictionary()
+	assert.Equal(t, dict, cachedDict)
+	request(cached)
+}
+
+func TestConnectToMemoryEncryption(t *testing.T) {
+	tables := []struct {
+		name    string
+		enabled bool
+		ciphers []string
+		err     bool
+	}{
+		{"aes_gcm", true, []string{codec.AESGCM}, false},
+		{"chacha20_poly1305", true, []string{codec.ChaCha20Poly1305}, false},
+		{"server_without_encryption", false, nil, true},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			acc, _ := startMemoryApp(t, withConfig(func(cfg *config.BuilderConfig) {
+				cfg.Pitaya.Conn.Encryption.Enabled = table.enabled
+			}))
+
+			c := New(logrus.InfoLevel)
+			c.EnableEncryption(table.ciphers...)
+			err := c.ConnectToMemory(acc)
+			if table.err {
+				assert.EqualError(t, err, "server did not negotiate encryption")
+				return
+			}
+			assert.NoError(t, err)
+			defer c.Disconnect()
+
+			data, err := json.Marshal(&MemoryTestMessage{Data: "hello"})
+			assert.NoError(t, err)
+			_, err = c.SendRequest("testtype.memory.Echo", data)
+			assert.NoError(t, err)
+			msg := helpers.ShouldEventuallyReceive(t, c.IncomingMsgChan, time.Second).(*message.Message)
+			for msg.Type != message.Response {
+				msg = helpers.ShouldEventuallyReceive(t, c.IncomingMsgChan, time.Second).(*message.Message)
+			}
+			assert.JSONEq(t, string(data), string(msg.Data))
+		})
+	}
+}
+
+func TestConnectToMemoryReplayProtection(t *testing.T) {
+	acc, _ := startMemoryApp(t, withConfig(func(cfg *config.BuilderConfig) {
+		cfg.Pitaya.Conn.ReplayProtection.Enabled = true
+	}))
+
+	c := New(logrus.InfoLevel)
+	c.EnableSequence()
+	assert.NoError(t, c.ConnectToMemory(acc))
+	defer c.Disconnect()
+	assert.True(t, c.sequenced)
+
+	response := func() *message.Message {
+		msg := helpers.ShouldEventuallyReceive(t, c.IncomingMsgChan, time.Second).(*message.Message)
+		for msg.Type != message.Response {
+			msg = helpers.ShouldEventuallyReceive(t, c.IncomingMsgChan, time.Second).(*message.Message)
+		}
+		return msg
+	}
+
+	// sends the packet as if it was the request with id sent by c
+	write := func(id uint, p []byte) {
+		c.pendingChan <- true
+		c.pendingReqMutex.Lock()
+		c.pendingRequests[id] = &pendingRequest{sentAt: time.Now()}
+		c.pendingReqMutex.Unlock()
+		_, err := c.conn.Write(p)
+		assert.NoError(t, err)
+	}
+
+	data, err := json.Marshal(&MemoryTestMessage{Data: "hello"})
+	assert.NoError(t, err)
+	p, err := c.buildPacket(message.Message{Type: message.Request, ID: 100, Route: "testtype.memory.Echo", Data: data})
+	assert.NoError(t, err)
+	write(100, p)
+	msg := response()
+	assert.False(t, msg.Err)
+	assert.JSONEq(t, string(data), string(msg.Data))
+
+	// the captured packet is rejected when it is sent again
+	write(100, p)
+	msg = response()
+	assert.True(t, msg.Err)
+	assert.Contains(t, string(msg.Data), constants.ErrReplayedMessage.Error())
+
+	_, err = c.SendRequest("testtype.memory.Echo", data)
+	assert.NoError(t, err)
+	msg = response()
+	assert.False(t, msg.Err)
+}
+
+func TestConnectToMemoryProtocolVersion(t *testing.T) {
+	acc, _ := startMemoryApp(t)
+
+	c := New(logrus.InfoLevel)
+	c.EnableProtocolVersions()
+	assert.NoError(t, c.ConnectToMemory(acc))
+	defer c.Disconnect()
+	assert.Equal(t, message.MaxProtocolVersion, c.protocolVersion)
+
+	// routes longer than 255 bytes only fit in the newer versions
+	data, err := json.Marshal(&MemoryTestMessage{Data: "hello"})
+	assert.NoError(t, err)
+	_, err = c.SendRequest("testtype.memory.LongPush", data)
+	assert.NoError(t, err)
+	msg := helpers.ShouldEventuallyReceive(t, c.IncomingMsgChan, time.Second).(*message.Message)
+	for msg.Type != message.Push {
+		msg = helpers.ShouldEventuallyReceive(t, c.IncomingMsgChan, time.Second).(*message.Message)
+	}
+	assert.Equal(t, strings.Repeat("memory.", 50)+"pushed", msg.Route)
+	assert.JSONEq(t, string(data), string(msg.Data))
+}
+
+func TestConnectToMemoryMsgpack(t *testing.T) {
+	acc, _ := startMemoryApp(t, withBuilder(func(builder *pitaya.Builder) {
+		builder.Serializer = msgpack.NewSerializer()
+	}))
+
+	c := New(logrus.InfoLevel)
+	c.SetSerializer(msgpack.NewSerializer())
+	assert.NoError(t, c.ConnectToMemory(acc))
+	defer c.Disconnect()
+
+	response := func() *message.Message {
+		msg := helpers.ShouldEventuallyReceive(t, c.IncomingMsgChan, time.Second).(*message.Message)
+		for msg.Type != message.Response {
+			msg = helpers.ShouldEventuallyReceive(t, c.IncomingMsgChan, time.Second).(*message.Message)
+		}
+		return msg
+	}
+
+	_, err := c.SendRequest("testtype.memory.Echo", []byte(`{"data":"hello"}`))
+	assert.NoError(t, err)
+	msg := response()
+	assert.False(t, msg.Err)
+	assert.JSONEq(t, `{"data":"hello"}`, string(msg.Data))
+
+	_, err = c.SendRequest("testtype.memory.Missing", []byte(`{"data":"hello"}`))
+	assert.NoError(t, err)
+	msg = response()
+	assert.True(t, msg.Err)
+	pErr := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(msg.Data, &pErr))
+	assert.Equal(t, "PIT-404", pErr["code"])
+
+	_, err = c.SendRequest("testtype.memory.Echo", []byte(`invalid`))
+	assert.Error(t, err)
+}
+
+func TestConnectToMemoryNegotiatesSerializer(t *testing.T) {
+	acc, _ := startMemoryApp(t, withBuilder(func(builder *pitaya.Builder) {
+		builder.Serializers = []serialize.Serializer{msgpack.NewSerializer()}
+	}))
+
+	tables := []struct {
+		name       string
+		serializer serialize.Serializer
+		err        string
+	}{
+		{"default_serializer", nil, ""},
+		{"msgpack", msgpack.NewSerializer(), ""},
+		{"unsupported_serializer", protobuf.NewSerializer(), "server picked the json serializer instead of protobuf"},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			c := New(logrus.InfoLevel)
+			if table.serializer != nil {
+				c.SetSerializer(table.serializer)
+			}
+			err := c.ConnectToMemory(acc)
+			if table.err != "" {
+				assert.EqualError(t, err, table.err)
+				return
+			}
+			assert.NoError(t, err)
+			defer c.Disconnect()
+
+			_, err = c.SendRequest("testtype.memory.Echo", []byte(`{"data":"hello"}`))
+			assert.NoError(t, err)
+			received := map[message.Type]*message.Message{}
+			for len(received) < 2 {
+				msg := helpers.ShouldEventuallyReceive(t, c.IncomingMsgChan, time.Second).(*message.Message)
+				received[msg.Type] = msg
+			}
+			assert.JSONEq(t, `{"data":"hello"}`, string(received[message.Push].Data))
+			assert.False(t, received[message.Response].Err)
+			assert.JSONEq(t, `{"data":"hello"}`, string(received[message.Response].Data))
+		})
+	}
+}
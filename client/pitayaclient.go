@@ -23,6 +23,7 @@ package client
 import (
 	"crypto/tls"
 
+	"github.com/topfreegames/pitaya/v2/config"
 	"github.com/topfreegames/pitaya/v2/conn/message"
 	"github.com/topfreegames/pitaya/v2/session"
 )
@@ -31,10 +32,13 @@ import (
 type PitayaClient interface {
 	ConnectTo(addr string, tlsConfig ...*tls.Config) error
 	ConnectToWS(addr string, path string, tlsConfig ...*tls.Config) error
+	ConnectToKCP(addr string, kcpConfig ...config.KCPAcceptorConfig) error
+	ConnectToQUIC(addr string, tlsConfig ...*tls.Config) error
 	ConnectedStatus() bool
 	Disconnect()
 	MsgChannel() chan *message.Message
 	SendNotify(route string, data []byte) error
 	SendRequest(route string, data []byte) (uint, error)
 	SetClientHandshakeData(data *session.HandshakeData)
+	SetClientCertificate(cert tls.Certificate)
 }
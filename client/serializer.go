@@ -0,0 +1,68 @@
+// Copyright (c) TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package client
+
+import (
+	"encoding/json"
+
+	"github.com/topfreegames/pitaya/v2/conn/message"
+	"github.com/topfreegames/pitaya/v2/protos"
+	pjson "github.com/topfreegames/pitaya/v2/serialize/json"
+	"github.com/topfreegames/pitaya/v2/util"
+)
+
+// encodeData converts data, which is written as JSON, to the serializer of
+// the client. Integer numbers are kept as integers, so that the server can
+// decode them into integer fields
+func (c *Client) encodeData(data []byte) ([]byte, error) {
+	if c.serializer == nil || len(data) == 0 {
+		return data, nil
+	}
+	v, err := util.UnmarshalValue(pjson.NewSerializer(), data)
+	if err != nil {
+		return nil, err
+	}
+	return c.serializer.Marshal(v)
+}
+
+// decodeData converts the data of m from the serializer of the client to
+// JSON, decoding it as a *protos.Error when m is an error
+func (c *Client) decodeData(m *message.Message) error {
+	if c.serializer == nil || len(m.Data) == 0 {
+		return nil
+	}
+	var v interface{}
+	if m.Err {
+		pErr := &protos.Error{}
+		if err := c.serializer.Unmarshal(m.Data, pErr); err != nil {
+			return err
+		}
+		v = pErr
+	} else if err := c.serializer.Unmarshal(m.Data, &v); err != nil {
+		return err
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	m.Data = data
+	return nil
+}
@@ -13,7 +13,11 @@ type PitayaConfig struct {
 	} `mapstructure:"heartbeat"`
 	Handler struct {
 		Messages struct {
-			Compression bool `mapstructure:"compression"`
+			Compression           bool     `mapstructure:"compression"`
+			CompressionThreshold  int      `mapstructure:"compressionthreshold"`
+			CompressionAlgorithms []string `mapstructure:"compressionalgorithms"`
+			ZstdDictionaries      []string `mapstructure:"zstddictionaries"`
+			RouteDictionary       bool     `mapstructure:"routedictionary"`
 		} `mapstructure:"messages"`
 	} `mapstructure:"handler"`
 	Buffer struct {
@@ -44,6 +48,13 @@ type PitayaConfig struct {
 	Acceptor struct {
 		ProxyProtocol bool `mapstructure:"proxyprotocol"`
 	} `mapstructure:"acceptor"`
+	Conn struct {
+		RouteRateLimiting RouteRateLimitingConfig `mapstructure:"routeratelimiting"`
+		WriteCoalescing   WriteCoalescingConfig   `mapstructure:"writecoalescing"`
+		Encryption        EncryptionConfig        `mapstructure:"encryption"`
+		ReplayProtection  ReplayProtectionConfig  `mapstructure:"replayprotection"`
+	} `mapstructure:"conn"`
+	Handshake HandshakeConfig `mapstructure:"handshake"`
 }
 
 // NewDefaultPitayaConfig provides default configuration for Pitaya App
@@ -56,13 +67,25 @@ func NewDefaultPitayaConfig() *PitayaConfig {
 		},
 		Handler: struct {
 			Messages struct {
-				Compression bool `mapstructure:"compression"`
+				Compression           bool     `mapstructure:"compression"`
+				CompressionThreshold  int      `mapstructure:"compressionthreshold"`
+				CompressionAlgorithms []string `mapstructure:"compressionalgorithms"`
+				ZstdDictionaries      []string `mapstructure:"zstddictionaries"`
+				RouteDictionary       bool     `mapstructure:"routedictionary"`
 			} `mapstructure:"messages"`
 		}{
 			Messages: struct {
-				Compression bool `mapstructure:"compression"`
+				Compression           bool     `mapstructure:"compression"`
+				CompressionThreshold  int      `mapstructure:"compressionthreshold"`
+				CompressionAlgorithms []string `mapstructure:"compressionalgorithms"`
+				ZstdDictionaries      []string `mapstructure:"zstddictionaries"`
+				RouteDictionary       bool     `mapstructure:"routedictionary"`
 			}{
-				Compression: true,
+				Compression:           true,
+				CompressionThreshold:  0,
+				CompressionAlgorithms: []string{"zstd", "snappy", "deflate"},
+				ZstdDictionaries:      []string{},
+				RouteDictionary:       false,
 			},
 		},
 		Buffer: struct {
@@ -127,6 +150,18 @@ func NewDefaultPitayaConfig() *PitayaConfig {
 		}{
 			ProxyProtocol: false,
 		},
+		Conn: struct {
+			RouteRateLimiting RouteRateLimitingConfig `mapstructure:"routeratelimiting"`
+			WriteCoalescing   WriteCoalescingConfig   `mapstructure:"writecoalescing"`
+			Encryption        EncryptionConfig        `mapstructure:"encryption"`
+			ReplayProtection  ReplayProtectionConfig  `mapstructure:"replayprotection"`
+		}{
+			RouteRateLimiting: *NewDefaultRouteRateLimitingConfig(),
+			WriteCoalescing:   *NewDefaultWriteCoalescingConfig(),
+			Encryption:        *NewDefaultEncryptionConfig(),
+			ReplayProtection:  *NewDefaultReplayProtectionConfig(),
+		},
+		Handshake: *NewDefaultHandshakeConfig(),
 	}
 }
 
@@ -670,3 +705,303 @@ func NewRateLimitingConfig(config *Config) *RateLimitingConfig {
 	}
 	return conf
 }
+
+// HandshakeConfig limits the clients that did not finish the handshake,
+// zero disables a limit. MaxPacketsBeforeAck does not count the handshake
+// packet itself, and MaxSize also rejects larger packets from their header
+// on the connections that support it
+type HandshakeConfig struct {
+	Timeout             time.Duration `mapstructure:"timeout"`
+	MaxPacketsBeforeAck int           `mapstructure:"maxpacketsbeforeack"`
+	MaxSize             int           `mapstructure:"maxsize"`
+}
+
+// NewDefaultHandshakeConfig handshake default config
+func NewDefaultHandshakeConfig() *HandshakeConfig {
+	return &HandshakeConfig{
+		Timeout:             0,
+		MaxPacketsBeforeAck: 0,
+		MaxSize:             0,
+	}
+}
+
+// NewHandshakeConfig reads from config to build handshake configuration
+func NewHandshakeConfig(config *Config) *HandshakeConfig {
+	conf := NewDefaultHandshakeConfig()
+	if err := config.UnmarshalKey("pitaya.handshake", &conf); err != nil {
+		panic(err)
+	}
+	return conf
+}
+
+// Actions taken by the route rate limiting when a client exceeds its limit
+const (
+	// RouteRateLimitingActionDrop ignores the packets exceeding the limit
+	RouteRateLimitingActionDrop = "drop"
+	// RouteRateLimitingActionError answers the requests exceeding the limit
+	// with an error with code PIT-429
+	RouteRateLimitingActionError = "error"
+	// RouteRateLimitingActionKick drops the packets exceeding the limit and
+	// kicks the client after KickAfter of them
+	RouteRateLimitingActionKick = "kick"
+)
+
+// RouteCost is the number of tokens spent by a message to route
+type RouteCost struct {
+	Route string `mapstructure:"route"`
+	Cost  int    `mapstructure:"cost"`
+}
+
+// RouteRateLimitingConfig configures the token bucket that limits the
+// packets received from each client, where each message spends the tokens
+// configured for its route
+type RouteRateLimitingConfig struct {
+	Enabled       bool        `mapstructure:"enabled"`
+	Rate          float64     `mapstructure:"rate"`
+	Burst         int         `mapstructure:"burst"`
+	DefaultCost   int         `mapstructure:"defaultcost"`
+	HeartbeatCost int         `mapstructure:"heartbeatcost"`
+	Costs         []RouteCost `mapstructure:"costs"`
+	Action        string      `mapstructure:"action"`
+	KickAfter     int         `mapstructure:"kickafter"`
+}
+
+// NewDefaultRouteRateLimitingConfig route rate limiting default config
+func NewDefaultRouteRateLimitingConfig() *RouteRateLimitingConfig {
+	return &RouteRateLimitingConfig{
+		Enabled:       false,
+		Rate:          20,
+		Burst:         20,
+		DefaultCost:   1,
+		HeartbeatCost: 0,
+		Costs:         []RouteCost{},
+		Action:        RouteRateLimitingActionDrop,
+		KickAfter:     10,
+	}
+}
+
+// NewRouteRateLimitingConfig reads from config to build route rate limiting configuration
+func NewRouteRateLimitingConfig(config *Config) *RouteRateLimitingConfig {
+	conf := NewDefaultRouteRateLimitingConfig()
+	if err := config.UnmarshalKey("pitaya.conn.routeratelimiting", &conf); err != nil {
+		panic(err)
+	}
+	return conf
+}
+
+// WriteCoalescingConfig configures the joining of the packets queued to a
+// client in a single write, up to MaxBytes, waiting at most FlushDelay for
+// more packets after the first one
+type WriteCoalescingConfig struct {
+	Enabled    bool          `mapstructure:"enabled"`
+	MaxBytes   int           `mapstructure:"maxbytes"`
+	FlushDelay time.Duration `mapstructure:"flushdelay"`
+}
+
+// NewDefaultWriteCoalescingConfig write coalescing default config
+func NewDefaultWriteCoalescingConfig() *WriteCoalescingConfig {
+	return &WriteCoalescingConfig{
+		Enabled:    false,
+		MaxBytes:   16 * 1024,
+		FlushDelay: 0,
+	}
+}
+
+// NewWriteCoalescingConfig reads from config to build write coalescing configuration
+func NewWriteCoalescingConfig(config *Config) *WriteCoalescingConfig {
+	conf := NewDefaultWriteCoalescingConfig()
+	if err := config.UnmarshalKey("pitaya.conn.writecoalescing", &conf); err != nil {
+		panic(err)
+	}
+	return conf
+}
+
+// EncryptionConfig configures the sealing of the packets of the clients that
+// advertise any of the ciphers in the handshake, all the supported ciphers
+// are negotiated when Ciphers is empty. The key exchange is not
+// authenticated, so it only protects against passive eavesdropping
+type EncryptionConfig struct {
+	Enabled bool     `mapstructure:"enabled"`
+	Ciphers []string `mapstructure:"ciphers"`
+}
+
+// NewDefaultEncryptionConfig encryption default config
+func NewDefaultEncryptionConfig() *EncryptionConfig {
+	return &EncryptionConfig{
+		Enabled: false,
+		Ciphers: []string{},
+	}
+}
+
+// NewEncryptionConfig reads from config to build encryption configuration
+func NewEncryptionConfig(config *Config) *EncryptionConfig {
+	conf := NewDefaultEncryptionConfig()
+	if err := config.UnmarshalKey("pitaya.conn.encryption", &conf); err != nil {
+		panic(err)
+	}
+	return conf
+}
+
+// ReplayProtectionConfig configures the sequence numbers negotiated with
+// the clients that advertise them in the handshake. Their messages are
+// rejected when the sequence number was already received or is older than
+// the last Window ones, which must be positive when it is enabled
+type ReplayProtectionConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	Window  int  `mapstructure:"window"`
+}
+
+// NewDefaultReplayProtectionConfig replay protection default config
+func NewDefaultReplayProtectionConfig() *ReplayProtectionConfig {
+	return &ReplayProtectionConfig{
+		Enabled: false,
+		Window:  1024,
+	}
+}
+
+// NewReplayProtectionConfig reads from config to build replay protection configuration
+func NewReplayProtectionConfig(config *Config) *ReplayProtectionConfig {
+	conf := NewDefaultReplayProtectionConfig()
+	if err := config.UnmarshalKey("pitaya.conn.replayprotection", &conf); err != nil {
+		panic(err)
+	}
+	return conf
+}
+
+// IPFilteringConfig has the CIDR rules of the connections accepted by a
+// frontend, bare IPs are also accepted as rules. Connections matching a deny
+// rule are rejected and, when there are allow rules, only the connections
+// matching one of them are accepted
+type IPFilteringConfig struct {
+	Allow        []string `mapstructure:"allow"`
+	Deny         []string `mapstructure:"deny"`
+	ForceDisable bool     `mapstructure:"forcedisable"`
+}
+
+// NewDefaultIPFilteringConfig ip filtering default config
+func NewDefaultIPFilteringConfig() *IPFilteringConfig {
+	return &IPFilteringConfig{
+		Allow:        []string{},
+		Deny:         []string{},
+		ForceDisable: false,
+	}
+}
+
+// NewIPFilteringConfig reads from config to build ip filtering configuration
+func NewIPFilteringConfig(config *Config) *IPFilteringConfig {
+	conf := NewDefaultIPFilteringConfig()
+	if err := config.UnmarshalKey("pitaya.conn.ipfiltering", &conf); err != nil {
+		panic(err)
+	}
+	return conf
+}
+
+// ConnectionLimitingConfig limits the connections accepted by a frontend,
+// zero disables a limit
+type ConnectionLimitingConfig struct {
+	MaxPerIP        int  `mapstructure:"maxperip"`
+	MaxPerCIDR      int  `mapstructure:"maxpercidr"`
+	IPv4CIDRPrefix  int  `mapstructure:"ipv4cidrprefix"`
+	IPv6CIDRPrefix  int  `mapstructure:"ipv6cidrprefix"`
+	MaxNewPerSecond int  `mapstructure:"maxnewpersecond"`
+	ForceDisable    bool `mapstructure:"forcedisable"`
+}
+
+// NewDefaultConnectionLimitingConfig connection limiting default config
+func NewDefaultConnectionLimitingConfig() *ConnectionLimitingConfig {
+	return &ConnectionLimitingConfig{
+		MaxPerIP:        0,
+		MaxPerCIDR:      0,
+		IPv4CIDRPrefix:  24,
+		IPv6CIDRPrefix:  64,
+		MaxNewPerSecond: 0,
+		ForceDisable:    false,
+	}
+}
+
+// NewConnectionLimitingConfig reads from config to build connection limiting configuration
+func NewConnectionLimitingConfig(config *Config) *ConnectionLimitingConfig {
+	conf := NewDefaultConnectionLimitingConfig()
+	if err := config.UnmarshalKey("pitaya.conn.connectionlimiting", &conf); err != nil {
+		panic(err)
+	}
+	return conf
+}
+
+// KCPAcceptorConfig provides configuration for KCPAcceptor
+type KCPAcceptorConfig struct {
+	NoDelay       bool          `mapstructure:"nodelay"`
+	Interval      time.Duration `mapstructure:"interval"`
+	Resend        int           `mapstructure:"resend"`
+	NoCongestion  bool          `mapstructure:"nocongestion"`
+	SendWindow    int           `mapstructure:"sendwindow"`
+	ReceiveWindow int           `mapstructure:"receivewindow"`
+	MTU           int           `mapstructure:"mtu"`
+	DataShards    int           `mapstructure:"datashards"`
+	ParityShards  int           `mapstructure:"parityshards"`
+}
+
+// NewDefaultKCPAcceptorConfig provides default configuration for KCPAcceptor,
+// tuned for low latency instead of bandwidth efficiency
+func NewDefaultKCPAcceptorConfig() *KCPAcceptorConfig {
+	return &KCPAcceptorConfig{
+		NoDelay:       true,
+		Interval:      time.Duration(10 * time.Millisecond),
+		Resend:        2,
+		NoCongestion:  true,
+		SendWindow:    128,
+		ReceiveWindow: 128,
+		MTU:           1350,
+		DataShards:    0,
+		ParityShards:  0,
+	}
+}
+
+// NewKCPAcceptorConfig reads from config to build KCPAcceptor configuration
+func NewKCPAcceptorConfig(config *Config) *KCPAcceptorConfig {
+	conf := NewDefaultKCPAcceptorConfig()
+	if err := config.UnmarshalKey("pitaya.acceptor.kcp", &conf); err != nil {
+		panic(err)
+	}
+	return conf
+}
+
+// WSAcceptorConfig provides configuration for WSAcceptor
+type WSAcceptorConfig struct {
+	// Compression enables permessage-deflate negotiation with the clients
+	Compression      bool `mapstructure:"compression"`
+	CompressionLevel int  `mapstructure:"compressionlevel"`
+	// Subprotocols are the accepted subprotocols in order of preference,
+	// an empty list means no subprotocol is negotiated
+	Subprotocols []string `mapstructure:"subprotocols"`
+	// AllowedOrigins accepts patterns like "*.example.com" or
+	// "https://*.example.com", if empty plain websockets accept any origin
+	// and TLS websockets only accept requests from the same origin
+	AllowedOrigins []string `mapstructure:"allowedorigins"`
+	// Paths the upgrade is served on, an empty list serves all paths
+	Paths []string `mapstructure:"paths"`
+	// MaxFrameSize is the max size in bytes of a message read from the
+	// client, 0 means no limit
+	MaxFrameSize int64 `mapstructure:"maxframesize"`
+}
+
+// NewDefaultWSAcceptorConfig provides default configuration for WSAcceptor
+func NewDefaultWSAcceptorConfig() *WSAcceptorConfig {
+	return &WSAcceptorConfig{
+		Compression:      false,
+		CompressionLevel: 1,
+		Subprotocols:     []string{},
+		AllowedOrigins:   []string{},
+		Paths:            []string{},
+		MaxFrameSize:     0,
+	}
+}
+
+// NewWSAcceptorConfig reads from config to build WSAcceptor configuration
+func NewWSAcceptorConfig(config *Config) *WSAcceptorConfig {
+	conf := NewDefaultWSAcceptorConfig()
+	if err := config.UnmarshalKey("pitaya.acceptor.ws", &conf); err != nil {
+		panic(err)
+	}
+	return conf
+}
@@ -179,3 +179,68 @@ func TestGet(t *testing.T) {
 		})
 	}
 }
+
+func TestNewRouteRateLimitingConfig(t *testing.T) {
+	t.Parallel()
+
+	cfg := viper.New()
+	cfg.Set("pitaya.conn.routeratelimiting.enabled", true)
+	cfg.Set("pitaya.conn.routeratelimiting.action", RouteRateLimitingActionKick)
+	cfg.Set("pitaya.conn.routeratelimiting.costs", []map[string]interface{}{
+		{"route": "room.room.join", "cost": 5},
+	})
+
+	c := NewRouteRateLimitingConfig(NewConfig(cfg))
+	assert.True(t, c.Enabled)
+	assert.Equal(t, RouteRateLimitingActionKick, c.Action)
+	assert.Equal(t, []RouteCost{{Route: "room.room.join", Cost: 5}}, c.Costs)
+	assert.Equal(t, 20, c.Burst)
+
+	builderConfig := NewBuilderConfig(NewConfig(cfg))
+	assert.Equal(t, *c, builderConfig.Pitaya.Conn.RouteRateLimiting)
+}
+
+func TestNewWriteCoalescingConfig(t *testing.T) {
+	t.Parallel()
+
+	cfg := viper.New()
+	cfg.Set("pitaya.conn.writecoalescing.enabled", true)
+	cfg.Set("pitaya.conn.writecoalescing.flushdelay", "2ms")
+
+	c := NewWriteCoalescingConfig(NewConfig(cfg))
+	assert.True(t, c.Enabled)
+	assert.Equal(t, 16*1024, c.MaxBytes)
+	assert.Equal(t, 2*time.Millisecond, c.FlushDelay)
+
+	builderConfig := NewBuilderConfig(NewConfig(cfg))
+	assert.Equal(t, *c, builderConfig.Pitaya.Conn.WriteCoalescing)
+}
+
+func TestNewEncryptionConfig(t *testing.T) {
+	t.Parallel()
+
+	cfg := viper.New()
+	cfg.Set("pitaya.conn.encryption.enabled", true)
+	cfg.Set("pitaya.conn.encryption.ciphers", []string{"chacha20-poly1305"})
+
+	c := NewEncryptionConfig(NewConfig(cfg))
+	assert.True(t, c.Enabled)
+	assert.Equal(t, []string{"chacha20-poly1305"}, c.Ciphers)
+
+	builderConfig := NewBuilderConfig(NewConfig(cfg))
+	assert.Equal(t, *c, builderConfig.Pitaya.Conn.Encryption)
+}
+
+func TestNewReplayProtectionConfig(t *testing.T) {
+	t.Parallel()
+
+	cfg := viper.New()
+	cfg.Set("pitaya.conn.replayprotection.enabled", true)
+
+	c := NewReplayProtectionConfig(NewConfig(cfg))
+	assert.True(t, c.Enabled)
+	assert.Equal(t, 1024, c.Window)
+
+	builderConfig := NewBuilderConfig(NewConfig(cfg))
+	assert.Equal(t, *c, builderConfig.Pitaya.Conn.ReplayProtection)
+}
@@ -66,8 +66,17 @@ func (c *Config) fillDefaultValues() {
 	groupServiceConfig := NewDefaultMemoryGroupConfig()
 	etcdGroupServiceConfig := NewDefaultEtcdGroupServiceConfig()
 	rateLimitingConfig := NewDefaultRateLimitingConfig()
+	connectionLimitingConfig := NewDefaultConnectionLimitingConfig()
+	routeRateLimitingConfig := NewDefaultRouteRateLimitingConfig()
+	writeCoalescingConfig := NewDefaultWriteCoalescingConfig()
+	encryptionConfig := NewDefaultEncryptionConfig()
+	replayProtectionConfig := NewDefaultReplayProtectionConfig()
+	ipFilteringConfig := NewDefaultIPFilteringConfig()
+	handshakeConfig := NewDefaultHandshakeConfig()
 	infoRetrieverConfig := NewDefaultInfoRetrieverConfig()
 	etcdBindingConfig := NewDefaultETCDBindingConfig()
+	kcpAcceptorConfig := NewDefaultKCPAcceptorConfig()
+	wsAcceptorConfig := NewDefaultWSAcceptorConfig()
 
 	defaultsMap := map[string]interface{}{
 		"pitaya.buffer.agent.messages": pitayaConfig.Buffer.Agent.Messages,
@@ -107,6 +116,21 @@ func (c *Config) fillDefaultValues() {
 		// a single backend server should have the config pitaya.buffer.cluster.rpc.server.nats.messages bigger
 		// than the sum of the config pitaya.concurrency.handler.dispatch among all frontend servers
 		"pitaya.acceptor.proxyprotocol":                    pitayaConfig.Acceptor.ProxyProtocol,
+		"pitaya.acceptor.kcp.nodelay":                      kcpAcceptorConfig.NoDelay,
+		"pitaya.acceptor.kcp.interval":                     kcpAcceptorConfig.Interval,
+		"pitaya.acceptor.kcp.resend":                       kcpAcceptorConfig.Resend,
+		"pitaya.acceptor.kcp.nocongestion":                 kcpAcceptorConfig.NoCongestion,
+		"pitaya.acceptor.kcp.sendwindow":                   kcpAcceptorConfig.SendWindow,
+		"pitaya.acceptor.kcp.receivewindow":                kcpAcceptorConfig.ReceiveWindow,
+		"pitaya.acceptor.kcp.mtu":                          kcpAcceptorConfig.MTU,
+		"pitaya.acceptor.kcp.datashards":                   kcpAcceptorConfig.DataShards,
+		"pitaya.acceptor.kcp.parityshards":                 kcpAcceptorConfig.ParityShards,
+		"pitaya.acceptor.ws.compression":                   wsAcceptorConfig.Compression,
+		"pitaya.acceptor.ws.compressionlevel":              wsAcceptorConfig.CompressionLevel,
+		"pitaya.acceptor.ws.subprotocols":                  wsAcceptorConfig.Subprotocols,
+		"pitaya.acceptor.ws.allowedorigins":                wsAcceptorConfig.AllowedOrigins,
+		"pitaya.acceptor.ws.paths":                         wsAcceptorConfig.Paths,
+		"pitaya.acceptor.ws.maxframesize":                  wsAcceptorConfig.MaxFrameSize,
 		"pitaya.concurrency.handler.dispatch":              pitayaConfig.Concurrency.Handler.Dispatch,
 		"pitaya.defaultpipelines.structvalidation.enabled": builderConfig.DefaultPipelines.StructValidation.Enabled,
 		"pitaya.groups.etcd.dialtimeout":                   etcdGroupServiceConfig.DialTimeout,
@@ -115,6 +139,10 @@ func (c *Config) fillDefaultValues() {
 		"pitaya.groups.etcd.transactiontimeout":            etcdGroupServiceConfig.TransactionTimeout,
 		"pitaya.groups.memory.tickduration":                groupServiceConfig.TickDuration,
 		"pitaya.handler.messages.compression":              pitayaConfig.Handler.Messages.Compression,
+		"pitaya.handler.messages.compressionthreshold":     pitayaConfig.Handler.Messages.CompressionThreshold,
+		"pitaya.handler.messages.compressionalgorithms":    pitayaConfig.Handler.Messages.CompressionAlgorithms,
+		"pitaya.handler.messages.routedictionary":          pitayaConfig.Handler.Messages.RouteDictionary,
+		"pitaya.handler.messages.zstddictionaries":         pitayaConfig.Handler.Messages.ZstdDictionaries,
 		"pitaya.heartbeat.interval":                        pitayaConfig.Heartbeat.Interval,
 		"pitaya.metrics.prometheus.additionalLabels":       prometheusConfig.Prometheus.AdditionalLabels,
 		"pitaya.metrics.constLabels":                       prometheusConfig.ConstLabels,
@@ -133,6 +161,33 @@ func (c *Config) fillDefaultValues() {
 		"pitaya.conn.ratelimiting.limit":                   rateLimitingConfig.Limit,
 		"pitaya.conn.ratelimiting.interval":                rateLimitingConfig.Interval,
 		"pitaya.conn.ratelimiting.forcedisable":            rateLimitingConfig.ForceDisable,
+		"pitaya.conn.connectionlimiting.maxperip":          connectionLimitingConfig.MaxPerIP,
+		"pitaya.conn.connectionlimiting.maxpercidr":        connectionLimitingConfig.MaxPerCIDR,
+		"pitaya.conn.connectionlimiting.ipv4cidrprefix":    connectionLimitingConfig.IPv4CIDRPrefix,
+		"pitaya.conn.connectionlimiting.ipv6cidrprefix":    connectionLimitingConfig.IPv6CIDRPrefix,
+		"pitaya.conn.connectionlimiting.maxnewpersecond":   connectionLimitingConfig.MaxNewPerSecond,
+		"pitaya.conn.connectionlimiting.forcedisable":      connectionLimitingConfig.ForceDisable,
+		"pitaya.handshake.timeout":                         handshakeConfig.Timeout,
+		"pitaya.handshake.maxpacketsbeforeack":             handshakeConfig.MaxPacketsBeforeAck,
+		"pitaya.handshake.maxsize":                         handshakeConfig.MaxSize,
+		"pitaya.conn.ipfiltering.allow":                    ipFilteringConfig.Allow,
+		"pitaya.conn.ipfiltering.deny":                     ipFilteringConfig.Deny,
+		"pitaya.conn.ipfiltering.forcedisable":             ipFilteringConfig.ForceDisable,
+		"pitaya.conn.routeratelimiting.enabled":            routeRateLimitingConfig.Enabled,
+		"pitaya.conn.routeratelimiting.rate":               routeRateLimitingConfig.Rate,
+		"pitaya.conn.routeratelimiting.burst":              routeRateLimitingConfig.Burst,
+		"pitaya.conn.routeratelimiting.defaultcost":        routeRateLimitingConfig.DefaultCost,
+		"pitaya.conn.routeratelimiting.heartbeatcost":      routeRateLimitingConfig.HeartbeatCost,
+		"pitaya.conn.routeratelimiting.costs":              routeRateLimitingConfig.Costs,
+		"pitaya.conn.routeratelimiting.action":             routeRateLimitingConfig.Action,
+		"pitaya.conn.routeratelimiting.kickafter":          routeRateLimitingConfig.KickAfter,
+		"pitaya.conn.writecoalescing.enabled":              writeCoalescingConfig.Enabled,
+		"pitaya.conn.writecoalescing.maxbytes":             writeCoalescingConfig.MaxBytes,
+		"pitaya.conn.writecoalescing.flushdelay":           writeCoalescingConfig.FlushDelay,
+		"pitaya.conn.encryption.enabled":                   encryptionConfig.Enabled,
+		"pitaya.conn.encryption.ciphers":                   encryptionConfig.Ciphers,
+		"pitaya.conn.replayprotection.enabled":             replayProtectionConfig.Enabled,
+		"pitaya.conn.replayprotection.window":              replayProtectionConfig.Window,
 		"pitaya.session.unique":                            pitayaConfig.Session.Unique,
 		"pitaya.session.drain.enabled":                     pitayaConfig.Session.Drain.Enabled,
 		"pitaya.session.drain.timeout":                     pitayaConfig.Session.Drain.Timeout,
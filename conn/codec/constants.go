@@ -20,12 +20,30 @@
 
 package codec
 
-import "errors"
+import (
+	"errors"
+	"math"
+)
 
 // Codec constants.
 const (
 	HeadLength    = 4
 	MaxPacketSize = 1 << 24 //16MB
+
+	// LengthPrefixedHeadLength is the header length of the length prefixed
+	// packets, one byte for the type and four for the length
+	LengthPrefixedHeadLength = 5
+	// MaxLengthPrefixedPacketSize is the max size of the length prefixed packets
+	MaxLengthPrefixedPacketSize = math.MaxInt32
+	// LengthPrefixedFlag is set in the type byte of the length prefixed
+	// packets, which tells them apart from the pomelo ones
+	LengthPrefixedFlag = 0x80
+)
+
+// Names of the packet codecs, sent to the clients in the handshake
+const (
+	PomeloPacketCodec         = "pomelo"
+	LengthPrefixedPacketCodec = "lengthprefixed"
 )
 
 // ErrPacketSizeExcced is the error used for encode/decode.
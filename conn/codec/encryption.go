@@ -0,0 +1,313 @@
+// Copyright (c) TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package codec
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync/atomic"
+
+	"github.com/topfreegames/pitaya/v2/conn/packet"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Names of the ciphers, which are negotiated with the clients
+const (
+	AESGCM           = "aes-gcm"
+	ChaCha20Poly1305 = "chacha20-poly1305"
+)
+
+const (
+	cipherKeySize = 32
+	// the nonce of the sealed packets is a direction prefix of four bytes
+	// followed by a counter of eight bytes, which is sent before the
+	// ciphertext
+	nonceCounterSize = 8
+)
+
+var (
+	// ErrUnknownCipher is returned when there is no cipher with a name
+	ErrUnknownCipher = errors.New("codec: unknown cipher")
+	// ErrOpenPacket is returned when a sealed packet can not be opened
+	ErrOpenPacket = errors.New("codec: failed to open sealed packet")
+	// ErrReplayedPacket is returned when a sealed packet has a counter that
+	// is not above the one of the last packet opened
+	ErrReplayedPacket = errors.New("codec: replayed sealed packet")
+
+	clientToServerNonce = []byte{'c', '2', 's', 0}
+	serverToClientNonce = []byte{'s', '2', 'c', 0}
+)
+
+// Ciphers returns the names of the ciphers supported, the first one is
+// the fastest on hardware with AES instructions
+func Ciphers() []string {
+	return []string{AESGCM, ChaCha20Poly1305}
+}
+
+// NegotiateCipher returns the first of ciphers that is supported by the
+// client, or an empty string if there is none
+func NegotiateCipher(ciphers []string, clientCiphers []string) string {
+	for _, name := range ciphers {
+		for _, clientCipher := range clientCiphers {
+			if name == clientCipher {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+func newAEAD(name string, key []byte) (cipher.AEAD, error) {
+	switch name {
+	case AESGCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case ChaCha20Poly1305:
+		return chacha20poly1305.New(key)
+	}
+	return nil, ErrUnknownCipher
+}
+
+// KeyExchange is one side of the X25519 key exchange done in the handshake,
+// whose shared secret derives the keys of the session
+type KeyExchange struct {
+	privateKey *ecdh.PrivateKey
+}
+
+// NewKeyExchange returns a key exchange with a new random key pair
+func NewKeyExchange() (*KeyExchange, error) {
+	privateKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyExchange{privateKey: privateKey}, nil
+}
+
+// PublicKey returns the public key sent to the other side
+func (k *KeyExchange) PublicKey() []byte {
+	return k.privateKey.PublicKey().Bytes()
+}
+
+// ServerCipher returns the cipher of the server side of a session, which
+// seals the packets sent to the client and opens the ones sent by it
+func (k *KeyExchange) ServerCipher(name string, clientPublicKey []byte) (*PacketCipher, error) {
+	secret, err := k.sharedSecret(clientPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return newSessionCipher(name, secret, clientPublicKey, k.PublicKey(), serverToClientNonce, clientToServerNonce)
+}
+
+// ClientCipher returns the cipher of the client side of a session, which
+// seals the packets sent to the server and opens the ones sent by it
+func (k *KeyExchange) ClientCipher(name string, serverPublicKey []byte) (*PacketCipher, error) {
+	secret, err := k.sharedSecret(serverPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return newSessionCipher(name, secret, k.PublicKey(), serverPublicKey, clientToServerNonce, serverToClientNonce)
+}
+
+func (k *KeyExchange) sharedSecret(peerPublicKey []byte) ([]byte, error) {
+	peerKey, err := ecdh.X25519().NewPublicKey(peerPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return k.privateKey.ECDH(peerKey)
+}
+
+// newSessionCipher derives the keys of both directions from the shared
+// secret and both public keys, so that they are unique to the session
+func newSessionCipher(name string, secret, clientPublicKey, serverPublicKey, sealNonce, openNonce []byte) (*PacketCipher, error) {
+	salt := append(append([]byte{}, clientPublicKey...), serverPublicKey...)
+	sealKey, err := deriveKey(secret, salt, sealNonce)
+	if err != nil {
+		return nil, err
+	}
+	openKey, err := deriveKey(secret, salt, openNonce)
+	if err != nil {
+		return nil, err
+	}
+	return NewPacketCipher(name, sealKey, openKey, sealNonce, openNonce)
+}
+
+func deriveKey(secret, salt, info []byte) ([]byte, error) {
+	key := make([]byte, cipherKeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, info), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// PacketCipher seals and opens the data of the packets of a session, each
+// direction has its own key and nonces. It is safe for concurrent use, but
+// the sealed packets must reach the other side in the order they were sealed
+// since the ones with a counter not above the last opened are rejected
+type PacketCipher struct {
+	name          string
+	seal          cipher.AEAD
+	open          cipher.AEAD
+	sealNonce     []byte
+	openNonce     []byte
+	counter       uint64
+	openedCounter uint64
+}
+
+// NewPacketCipher returns a cipher sealing with sealKey and opening with
+// openKey, using the nonce prefixes of each direction
+func NewPacketCipher(name string, sealKey, openKey, sealNonce, openNonce []byte) (*PacketCipher, error) {
+	seal, err := newAEAD(name, sealKey)
+	if err != nil {
+		return nil, err
+	}
+	open, err := newAEAD(name, openKey)
+	if err != nil {
+		return nil, err
+	}
+	return &PacketCipher{
+		name:      name,
+		seal:      seal,
+		open:      open,
+		sealNonce: sealNonce,
+		openNonce: openNonce,
+	}, nil
+}
+
+// GetName returns the name of the cipher
+func (c *PacketCipher) GetName() string {
+	return c.name
+}
+
+// Seal returns the counter of the nonce followed by the sealed data, the
+// type of the packet is authenticated along with it
+func (c *PacketCipher) Seal(typ packet.Type, data []byte) []byte {
+	counter := atomic.AddUint64(&c.counter, 1)
+	nonce := make([]byte, c.seal.NonceSize())
+	copy(nonce, c.sealNonce)
+	binary.BigEndian.PutUint64(nonce[len(nonce)-nonceCounterSize:], counter)
+
+	sealed := make([]byte, nonceCounterSize, nonceCounterSize+len(data)+c.seal.Overhead())
+	copy(sealed, nonce[len(nonce)-nonceCounterSize:])
+	return c.seal.Seal(sealed, nonce, data, []byte{byte(typ)})
+}
+
+// Open returns the data sealed by the other side of the session, failing with
+// ErrReplayedPacket if its counter is not above the one of the last opened
+func (c *PacketCipher) Open(typ packet.Type, sealed []byte) ([]byte, error) {
+	if len(sealed) < nonceCounterSize+c.open.Overhead() {
+		return nil, ErrOpenPacket
+	}
+	nonce := make([]byte, c.open.NonceSize())
+	copy(nonce, c.openNonce)
+	copy(nonce[len(nonce)-nonceCounterSize:], sealed[:nonceCounterSize])
+
+	data, err := c.open.Open(nil, nonce, sealed[nonceCounterSize:], []byte{byte(typ)})
+	if err != nil {
+		return nil, ErrOpenPacket
+	}
+
+	// only authenticated counters move the last opened one
+	counter := binary.BigEndian.Uint64(sealed[:nonceCounterSize])
+	for {
+		opened := atomic.LoadUint64(&c.openedCounter)
+		if counter <= opened {
+			return nil, ErrReplayedPacket
+		}
+		if atomic.CompareAndSwapUint64(&c.openedCounter, opened, counter) {
+			return data, nil
+		}
+	}
+}
+
+// EncryptedPacketEncoder seals the packets before encoding them with the
+// wrapped encoder, except for the handshake ones that negotiate the cipher
+type EncryptedPacketEncoder struct {
+	encoder PacketEncoder
+	cipher  *PacketCipher
+}
+
+// NewEncryptedPacketEncoder returns an encoder sealing the packets encoded
+// with encoder
+func NewEncryptedPacketEncoder(encoder PacketEncoder, cipher *PacketCipher) *EncryptedPacketEncoder {
+	return &EncryptedPacketEncoder{encoder: encoder, cipher: cipher}
+}
+
+// GetName returns the name of the wrapped codec
+func (e *EncryptedPacketEncoder) GetName() string {
+	return GetPacketCodecName(e.encoder)
+}
+
+// Encode seals the data of the packet and encodes it, the packets without
+// data are sealed too so that they can't be forged
+func (e *EncryptedPacketEncoder) Encode(typ packet.Type, data []byte) ([]byte, error) {
+	if sealed(typ) {
+		data = e.cipher.Seal(typ, data)
+	}
+	return e.encoder.Encode(typ, data)
+}
+
+// EncryptedPacketDecoder opens the packets decoded by the wrapped decoder,
+// which fails if any of them but the handshake ones was not sealed by the
+// other side
+type EncryptedPacketDecoder struct {
+	decoder PacketDecoder
+	cipher  *PacketCipher
+}
+
+// NewEncryptedPacketDecoder returns a decoder opening the packets decoded
+// by decoder
+func NewEncryptedPacketDecoder(decoder PacketDecoder, cipher *PacketCipher) *EncryptedPacketDecoder {
+	return &EncryptedPacketDecoder{decoder: decoder, cipher: cipher}
+}
+
+// Decode decodes the packets and opens their data, their Length is still
+// the one of the sealed data read from the conn
+func (d *EncryptedPacketDecoder) Decode(data []byte) ([]*packet.Packet, error) {
+	packets, err := d.decoder.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range packets {
+		if !sealed(p.Type) {
+			continue
+		}
+		if p.Data, err = d.cipher.Open(p.Type, p.Data); err != nil {
+			return nil, err
+		}
+	}
+	return packets, nil
+}
+
+// sealed returns true if the packets of typ are sealed, which are all the
+// ones sent after the handshake
+func sealed(typ packet.Type) bool {
+	return typ != packet.Handshake
+}
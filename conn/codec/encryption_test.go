@@ -0,0 +1,141 @@
+package codec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topfreegames/pitaya/v2/conn/packet"
+)
+
+func newSessionCiphers(t *testing.T, name string) (*PacketCipher, *PacketCipher) {
+	t.Helper()
+	server, err := NewKeyExchange()
+	assert.NoError(t, err)
+	client, err := NewKeyExchange()
+	assert.NoError(t, err)
+
+	serverCipher, err := server.ServerCipher(name, client.PublicKey())
+	assert.NoError(t, err)
+	clientCipher, err := client.ClientCipher(name, server.PublicKey())
+	assert.NoError(t, err)
+	return serverCipher, clientCipher
+}
+
+func TestNegotiateCipher(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, ChaCha20Poly1305, NegotiateCipher(Ciphers(), []string{"rot13", ChaCha20Poly1305}))
+	assert.Equal(t, AESGCM, NegotiateCipher(Ciphers(), []string{ChaCha20Poly1305, AESGCM}))
+	assert.Equal(t, "", NegotiateCipher(Ciphers(), []string{"rot13"}))
+}
+
+func TestPacketCipher(t *testing.T) {
+	t.Parallel()
+
+	for _, name := range Ciphers() {
+		t.Run(name, func(t *testing.T) {
+			serverCipher, clientCipher := newSessionCiphers(t, name)
+			assert.Equal(t, name, serverCipher.GetName())
+
+			data := []byte("hello")
+			sealed := serverCipher.Seal(packet.Data, data)
+			assert.NotContains(t, string(sealed), string(data))
+			opened, err := clientCipher.Open(packet.Data, sealed)
+			assert.NoError(t, err)
+			assert.Equal(t, data, opened)
+
+			// the nonces are never reused
+			assert.NotEqual(t, sealed, serverCipher.Seal(packet.Data, data))
+
+			// each direction has its own keys
+			_, err = serverCipher.Open(packet.Data, sealed)
+			assert.Equal(t, ErrOpenPacket, err)
+
+			sealed = clientCipher.Seal(packet.Data, data)
+			opened, err = serverCipher.Open(packet.Data, sealed)
+			assert.NoError(t, err)
+			assert.Equal(t, data, opened)
+
+			_, err = serverCipher.Open(packet.Kick, sealed)
+			assert.Equal(t, ErrOpenPacket, err)
+			sealed[len(sealed)-1] ^= 0xff
+			_, err = serverCipher.Open(packet.Data, sealed)
+			assert.Equal(t, ErrOpenPacket, err)
+			_, err = serverCipher.Open(packet.Data, []byte{0x01})
+			assert.Equal(t, ErrOpenPacket, err)
+		})
+	}
+}
+
+func TestPacketCipherReplayedPacket(t *testing.T) {
+	t.Parallel()
+
+	serverCipher, clientCipher := newSessionCiphers(t, ChaCha20Poly1305)
+	first := clientCipher.Seal(packet.Data, []byte("first"))
+	second := clientCipher.Seal(packet.Data, []byte("second"))
+
+	_, err := serverCipher.Open(packet.Data, second)
+	assert.NoError(t, err)
+	_, err = serverCipher.Open(packet.Data, second)
+	assert.Equal(t, ErrReplayedPacket, err)
+	_, err = serverCipher.Open(packet.Data, first)
+	assert.Equal(t, ErrReplayedPacket, err)
+
+	opened, err := serverCipher.Open(packet.Data, clientCipher.Seal(packet.Data, []byte("third")))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("third"), opened)
+}
+
+func TestPacketCipherUnknownCipher(t *testing.T) {
+	t.Parallel()
+
+	exchange, err := NewKeyExchange()
+	assert.NoError(t, err)
+	_, err = exchange.ServerCipher("rot13", exchange.PublicKey())
+	assert.Equal(t, ErrUnknownCipher, err)
+	_, err = exchange.ServerCipher(AESGCM, []byte{0x01})
+	assert.Error(t, err)
+}
+
+func TestEncryptedPacketCodec(t *testing.T) {
+	t.Parallel()
+
+	serverCipher, clientCipher := newSessionCiphers(t, AESGCM)
+	encoder := NewEncryptedPacketEncoder(NewLengthPrefixedPacketEncoder(), serverCipher)
+	decoder := NewEncryptedPacketDecoder(NewLengthPrefixedPacketDecoder(), clientCipher)
+	assert.Equal(t, LengthPrefixedPacketCodec, GetPacketCodecName(encoder))
+
+	data, err := encoder.Encode(packet.Data, []byte("hello"))
+	assert.NoError(t, err)
+	heartbeat, err := encoder.Encode(packet.Heartbeat, nil)
+	assert.NoError(t, err)
+	unsealed, err := NewLengthPrefixedPacketEncoder().Encode(packet.Heartbeat, nil)
+	assert.NoError(t, err)
+	assert.NotEqual(t, unsealed, heartbeat)
+	kick, err := encoder.Encode(packet.Kick, nil)
+	assert.NoError(t, err)
+
+	packets, err := decoder.Decode(append(append(data, heartbeat...), kick...))
+	assert.NoError(t, err)
+	assert.Len(t, packets, 3)
+	assert.EqualValues(t, packet.Data, packets[0].Type)
+	assert.Equal(t, []byte("hello"), packets[0].Data)
+	assert.Equal(t, len(data)-LengthPrefixedHeadLength, packets[0].Length)
+	assert.EqualValues(t, packet.Heartbeat, packets[1].Type)
+	assert.Empty(t, packets[1].Data)
+	assert.EqualValues(t, packet.Kick, packets[2].Type)
+
+	// only the handshake packets, which negotiate the cipher, are not sealed
+	handshake, err := encoder.Encode(packet.Handshake, []byte("{}"))
+	assert.NoError(t, err)
+	packets, err = decoder.Decode(handshake)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("{}"), packets[0].Data)
+
+	for _, typ := range []packet.Type{packet.Data, packet.Heartbeat, packet.Kick, packet.HandshakeAck} {
+		unsealed, err = NewLengthPrefixedPacketEncoder().Encode(typ, nil)
+		assert.NoError(t, err)
+		_, err = decoder.Decode(unsealed)
+		assert.Equal(t, ErrOpenPacket, err)
+	}
+}
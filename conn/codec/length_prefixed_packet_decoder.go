@@ -0,0 +1,38 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package codec
+
+// LengthPrefixedPacketDecoder decodes the packets encoded by the
+// LengthPrefixedPacketEncoder. It also decodes pomelo packets, so it reads
+// the handshake of the clients that do not know the server codec yet
+type LengthPrefixedPacketDecoder struct {
+	*PomeloPacketDecoder
+}
+
+// NewLengthPrefixedPacketDecoder returns a new decoder, which accepts the
+// same options of the pomelo one
+func NewLengthPrefixedPacketDecoder(opts ...PomeloPacketDecoderOption) *LengthPrefixedPacketDecoder {
+	c := &PomeloPacketDecoder{maxPacketSize: MaxLengthPrefixedPacketSize, lengthPrefixed: true}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return &LengthPrefixedPacketDecoder{PomeloPacketDecoder: c}
+}
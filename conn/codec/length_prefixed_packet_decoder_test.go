@@ -0,0 +1,56 @@
+package codec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topfreegames/pitaya/v2/conn/packet"
+)
+
+var lengthPrefixedDecodeTables = map[string]struct {
+	data   []byte
+	packet []*packet.Packet
+	err    error
+}{
+	"test_not_enough_bytes":        {[]byte{0x81, 0x00, 0x00, 0x00}, nil, nil},
+	"test_error_on_forward":        {[]byte{0x86, 0x00, 0x00, 0x00, 0x00}, nil, packet.ErrWrongPomeloPacketType},
+	"test_too_big_packet":          {[]byte{0x84, 0x80, 0x00, 0x00, 0x00}, nil, ErrPacketSizeExcced},
+	"test_forward":                 {[]byte{0x81, 0x00, 0x00, 0x00, 0x01, 0x01}, []*packet.Packet{{Type: packet.Handshake, Length: 1, Data: []byte{0x01}}}, nil},
+	"test_forward_pomelo":          {handshakeHeaderPacket, []*packet.Packet{{Type: packet.Handshake, Length: 1, Data: []byte{0x01}}}, nil},
+	"test_forward_incomplete_body": {[]byte{0x84, 0x00, 0x00, 0x00, 0x02, 0x01}, nil, nil},
+	"test_forward_mixed": {
+		append([]byte{0x84, 0x00, 0x00, 0x00, 0x01, 0x02}, handshakeHeaderPacket...),
+		[]*packet.Packet{{Type: packet.Data, Length: 1, Data: []byte{0x02}}, {Type: packet.Handshake, Length: 1, Data: []byte{0x01}}},
+		nil,
+	},
+}
+
+func TestLengthPrefixedDecode(t *testing.T) {
+	t.Parallel()
+
+	for name, table := range lengthPrefixedDecodeTables {
+		t.Run(name, func(t *testing.T) {
+			lpd := NewLengthPrefixedPacketDecoder()
+
+			packets, err := lpd.Decode(table.data)
+
+			assert.Equal(t, table.err, err)
+			assert.Equal(t, table.packet, packets)
+		})
+	}
+}
+
+func TestLengthPrefixedDecodeEncoded(t *testing.T) {
+	t.Parallel()
+
+	encoded, err := NewLengthPrefixedPacketEncoder().Encode(packet.Data, tooBigData)
+	assert.NoError(t, err)
+
+	packets, err := NewLengthPrefixedPacketDecoder(WithBufferPool()).Decode(encoded)
+	assert.NoError(t, err)
+	assert.Len(t, packets, 1)
+	assert.Equal(t, len(tooBigData), packets[0].Length)
+
+	_, err = NewLengthPrefixedPacketDecoder(WithMaxPacketSize(MaxPacketSize)).Decode(encoded)
+	assert.Equal(t, ErrPacketSizeExcced, err)
+}
@@ -0,0 +1,67 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package codec
+
+import (
+	"encoding/binary"
+
+	"github.com/topfreegames/pitaya/v2/conn/packet"
+)
+
+// LengthPrefixedPacketEncoder encodes packets with a four bytes length,
+// which allows them to be larger than the 16MB of the pomelo packets
+type LengthPrefixedPacketEncoder struct {
+}
+
+// NewLengthPrefixedPacketEncoder ctor
+func NewLengthPrefixedPacketEncoder() *LengthPrefixedPacketEncoder {
+	return &LengthPrefixedPacketEncoder{}
+}
+
+// GetName returns the name of the codec
+func (e *LengthPrefixedPacketEncoder) GetName() string {
+	return LengthPrefixedPacketCodec
+}
+
+// Encode create a packet.Packet from the raw bytes slice and then encode to
+// network bytes slice. The packet types are the same of the pomelo protocol,
+// with the LengthPrefixedFlag set
+//
+// -<type>-|--------<length>--------|-<data>-
+// --------|------------------------|--------
+// 1 byte packet type, 4 bytes packet data length(big end), and data segment
+func (e *LengthPrefixedPacketEncoder) Encode(typ packet.Type, data []byte) ([]byte, error) {
+	if typ < packet.Handshake || typ > packet.Kick {
+		return nil, packet.ErrWrongPomeloPacketType
+	}
+
+	if len(data) > MaxLengthPrefixedPacketSize {
+		return nil, ErrPacketSizeExcced
+	}
+
+	buf := make([]byte, len(data)+LengthPrefixedHeadLength)
+	buf[0] = byte(typ) | LengthPrefixedFlag
+
+	binary.BigEndian.PutUint32(buf[1:LengthPrefixedHeadLength], uint32(len(data)))
+	copy(buf[LengthPrefixedHeadLength:], data)
+
+	return buf, nil
+}
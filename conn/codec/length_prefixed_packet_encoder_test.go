@@ -0,0 +1,50 @@
+package codec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topfreegames/pitaya/v2/conn/packet"
+)
+
+var lengthPrefixedEncodeTables = map[string]struct {
+	packetType packet.Type
+	encoded    []byte
+	data       []byte
+	err        error
+}{
+	"test_encode_handshake":    {packet.Handshake, []byte{0x81, 0x00, 0x00, 0x00, 0x02, 0x01, 0x00}, []byte{0x01, 0x00}, nil},
+	"test_encode_empty":        {packet.Heartbeat, []byte{0x83, 0x00, 0x00, 0x00, 0x00}, nil, nil},
+	"test_invalid_packet_type": {0xff, nil, nil, packet.ErrWrongPomeloPacketType},
+}
+
+func TestLengthPrefixedEncode(t *testing.T) {
+	t.Parallel()
+
+	for name, table := range lengthPrefixedEncodeTables {
+		t.Run(name, func(t *testing.T) {
+			lpe := NewLengthPrefixedPacketEncoder()
+
+			encoded, err := lpe.Encode(table.packetType, table.data)
+			assert.Equal(t, table.err, err)
+			assert.Equal(t, table.encoded, encoded)
+		})
+	}
+}
+
+func TestLengthPrefixedEncodeLargerThanPomeloMaxPacketSize(t *testing.T) {
+	t.Parallel()
+
+	encoded, err := NewLengthPrefixedPacketEncoder().Encode(packet.Data, tooBigData)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x84, 0x02, 0x00, 0x00, 0x00}, encoded[:LengthPrefixedHeadLength])
+	assert.Len(t, encoded, len(tooBigData)+LengthPrefixedHeadLength)
+}
+
+func TestGetPacketCodecName(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, PomeloPacketCodec, GetPacketCodecName(NewPomeloPacketEncoder()))
+	assert.Equal(t, LengthPrefixedPacketCodec, GetPacketCodecName(NewLengthPrefixedPacketEncoder()))
+	assert.Equal(t, PomeloPacketCodec, GetPacketCodecName(nil))
+}
@@ -26,3 +26,18 @@ import "github.com/topfreegames/pitaya/v2/conn/packet"
 type PacketEncoder interface {
 	Encode(typ packet.Type, data []byte) ([]byte, error)
 }
+
+// NamedPacketEncoder is implemented by the encoders whose codec is
+// advertised to the clients in the handshake
+type NamedPacketEncoder interface {
+	GetName() string
+}
+
+// GetPacketCodecName returns the codec name of encoder, the encoders that do
+// not implement NamedPacketEncoder are taken as pomelo ones
+func GetPacketCodecName(encoder PacketEncoder) string {
+	if named, ok := encoder.(NamedPacketEncoder); ok {
+		return named.GetName()
+	}
+	return PomeloPacketCodec
+}
@@ -22,26 +22,94 @@ package codec
 
 import (
 	"bytes"
+	"sync"
 
 	"github.com/topfreegames/pitaya/v2/conn/packet"
 )
 
 // PomeloPacketDecoder reads and decodes network data slice following pomelo's protocol
-type PomeloPacketDecoder struct{}
+type PomeloPacketDecoder struct {
+	maxPacketSize  int
+	bufferPool     *sync.Pool
+	lengthPrefixed bool
+}
+
+// PomeloPacketDecoderOption configures a PomeloPacketDecoder
+type PomeloPacketDecoderOption func(*PomeloPacketDecoder)
+
+// WithMaxPacketSize makes the decoder fail with ErrPacketSizeExcced on the
+// packets larger than size bytes, instead of the max size of the protocol
+func WithMaxPacketSize(size int) PomeloPacketDecoderOption {
+	return func(c *PomeloPacketDecoder) {
+		if size > 0 && size < c.maxPacketSize {
+			c.maxPacketSize = size
+		}
+	}
+}
+
+// WithBufferPool makes the decoder read the data into buffers taken from a
+// pool instead of allocating a new one on each Decode. The data of the
+// decoded packets is copied out of the buffer, so they can be kept after
+// the buffer returns to the pool
+func WithBufferPool() PomeloPacketDecoderOption {
+	return func(c *PomeloPacketDecoder) {
+		c.bufferPool = &sync.Pool{
+			New: func() interface{} {
+				return new(bytes.Buffer)
+			},
+		}
+	}
+}
 
 // NewPomeloPacketDecoder returns a new decoder that used for decode network bytes slice.
-func NewPomeloPacketDecoder() *PomeloPacketDecoder {
-	return &PomeloPacketDecoder{}
+func NewPomeloPacketDecoder(opts ...PomeloPacketDecoderOption) *PomeloPacketDecoder {
+	c := &PomeloPacketDecoder{maxPacketSize: MaxPacketSize}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// headLength returns the header length of the next packet in buf
+func (c *PomeloPacketDecoder) headLength(buf *bytes.Buffer) int {
+	if c.lengthPrefixed && buf.Len() > 0 {
+		return PacketHeadLength(buf.Bytes()[0])
+	}
+	return HeadLength
 }
 
 func (c *PomeloPacketDecoder) forward(buf *bytes.Buffer) (int, packet.Type, error) {
-	header := buf.Next(HeadLength)
-	return ParseHeader(header)
+	var (
+		size int
+		typ  packet.Type
+		err  error
+	)
+	if c.lengthPrefixed {
+		size, typ, err = ParsePacketHeader(buf.Next(c.headLength(buf)))
+	} else {
+		size, typ, err = ParseHeader(buf.Next(HeadLength))
+	}
+	if err != nil {
+		return 0, 0x00, err
+	}
+	if c.maxPacketSize > 0 && size > c.maxPacketSize {
+		return 0, 0x00, ErrPacketSizeExcced
+	}
+	return size, typ, nil
 }
 
 // Decode decode the network bytes slice to packet.Packet(s)
 func (c *PomeloPacketDecoder) Decode(data []byte) ([]*packet.Packet, error) {
-	buf := bytes.NewBuffer(nil)
+	var buf *bytes.Buffer
+	if c.bufferPool != nil {
+		buf = c.bufferPool.Get().(*bytes.Buffer)
+		defer func() {
+			buf.Reset()
+			c.bufferPool.Put(buf)
+		}()
+	} else {
+		buf = bytes.NewBuffer(nil)
+	}
 	buf.Write(data)
 
 	var (
@@ -49,7 +117,7 @@ func (c *PomeloPacketDecoder) Decode(data []byte) ([]*packet.Packet, error) {
 		err     error
 	)
 	// check length
-	if buf.Len() < HeadLength {
+	if buf.Len() < c.headLength(buf) {
 		return nil, nil
 	}
 
@@ -60,11 +128,15 @@ func (c *PomeloPacketDecoder) Decode(data []byte) ([]*packet.Packet, error) {
 	}
 
 	for size <= buf.Len() {
-		p := &packet.Packet{Type: typ, Length: size, Data: buf.Next(size)}
+		data := buf.Next(size)
+		if c.bufferPool != nil {
+			data = append(make([]byte, 0, size), data...)
+		}
+		p := &packet.Packet{Type: typ, Length: size, Data: data}
 		packets = append(packets, p)
 
 		// if no more packets, break
-		if buf.Len() < HeadLength {
+		if buf.Len() < c.headLength(buf) {
 			break
 		}
 
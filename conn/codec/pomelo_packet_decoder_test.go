@@ -77,3 +77,68 @@ func TestDecode(t *testing.T) {
 		})
 	}
 }
+
+func TestDecodeMaxPacketSize(t *testing.T) {
+	t.Parallel()
+
+	ppd := NewPomeloPacketDecoder(WithMaxPacketSize(1))
+	packets, err := ppd.Decode(handshakeHeaderPacket)
+	assert.NoError(t, err)
+	assert.Equal(t, []*packet.Packet{{Type: packet.Handshake, Length: 1, Data: []byte{0x01}}}, packets)
+
+	_, err = ppd.Decode([]byte{packet.Handshake, 0x00, 0x00, 0x02, 0x01, 0x01})
+	assert.Equal(t, ErrPacketSizeExcced, err)
+
+	_, err = ppd.Decode(append(handshakeHeaderPacket, packet.Handshake, 0x00, 0x00, 0x02))
+	assert.Equal(t, ErrPacketSizeExcced, err)
+}
+
+func TestDecodeWithBufferPool(t *testing.T) {
+	t.Parallel()
+
+	for name, table := range decodeTables {
+		t.Run(name, func(t *testing.T) {
+			ppd := NewPomeloPacketDecoder(WithBufferPool())
+
+			packet, err := ppd.Decode(table.data)
+
+			assert.Equal(t, table.err, err)
+			assert.ElementsMatch(t, table.packet, packet)
+		})
+	}
+}
+
+func TestDecodeWithBufferPoolKeepsPackets(t *testing.T) {
+	t.Parallel()
+
+	ppd := NewPomeloPacketDecoder(WithBufferPool())
+	first, err := ppd.Decode([]byte{packet.Data, 0x00, 0x00, 0x02, 0x01, 0x02})
+	assert.NoError(t, err)
+	_, err = ppd.Decode([]byte{packet.Data, 0x00, 0x00, 0x02, 0x03, 0x04})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []byte{0x01, 0x02}, first[0].Data)
+}
+
+func FuzzPomeloPacketDecoderDecode(f *testing.F) {
+	for _, table := range decodeTables {
+		f.Add(table.data)
+	}
+	f.Add([]byte{packet.Data, 0xff, 0xff, 0xff})
+
+	plain := NewPomeloPacketDecoder()
+	pooled := NewPomeloPacketDecoder(WithBufferPool(), WithMaxPacketSize(MaxPacketSize-1))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		packets, err := plain.Decode(data)
+		pooledPackets, pooledErr := pooled.Decode(data)
+		if err != nil {
+			assert.Nil(t, packets)
+			return
+		}
+		assert.NoError(t, pooledErr)
+		assert.Equal(t, packets, pooledPackets)
+		for _, p := range packets {
+			assert.Equal(t, p.Length, len(p.Data))
+		}
+	})
+}
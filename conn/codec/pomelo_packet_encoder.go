@@ -33,6 +33,11 @@ func NewPomeloPacketEncoder() *PomeloPacketEncoder {
 	return &PomeloPacketEncoder{}
 }
 
+// GetName returns the name of the codec
+func (e *PomeloPacketEncoder) GetName() string {
+	return PomeloPacketCodec
+}
+
 // Encode create a packet.Packet from  the raw bytes slice and then encode to network bytes slice
 // Protocol refs: https://github.com/NetEase/pomelo/wiki/Communication-Protocol
 //
@@ -1,6 +1,10 @@
 package codec
 
-import "github.com/topfreegames/pitaya/v2/conn/packet"
+import (
+	"encoding/binary"
+
+	"github.com/topfreegames/pitaya/v2/conn/packet"
+)
 
 // ParseHeader parses a packet header and returns its dataLen and packetType or an error
 func ParseHeader(header []byte) (int, packet.Type, error) {
@@ -21,6 +25,36 @@ func ParseHeader(header []byte) (int, packet.Type, error) {
 	return size, packet.Type(typ), nil
 }
 
+// PacketHeadLength returns the header length of the packet whose first byte is b
+func PacketHeadLength(b byte) int {
+	if b&LengthPrefixedFlag != 0 {
+		return LengthPrefixedHeadLength
+	}
+	return HeadLength
+}
+
+// ParsePacketHeader parses the header of either a pomelo or a length
+// prefixed packet, as told by the LengthPrefixedFlag in its first byte
+func ParsePacketHeader(header []byte) (int, packet.Type, error) {
+	if len(header) == 0 || header[0]&LengthPrefixedFlag == 0 {
+		return ParseHeader(header)
+	}
+	if len(header) != LengthPrefixedHeadLength {
+		return 0, 0x00, packet.ErrInvalidPomeloHeader
+	}
+	typ := header[0] &^ LengthPrefixedFlag
+	if typ < packet.Handshake || typ > packet.Kick {
+		return 0, 0x00, packet.ErrWrongPomeloPacketType
+	}
+
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > MaxLengthPrefixedPacketSize {
+		return 0, 0x00, ErrPacketSizeExcced
+	}
+
+	return int(size), packet.Type(typ), nil
+}
+
 // BytesToInt decode packet data length byte to int(Big end)
 func BytesToInt(b []byte) int {
 	result := 0
@@ -0,0 +1,170 @@
+// Copyright (c) TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package message
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrDictionaryFull is returned when there are no codes left for the routes
+var ErrDictionaryFull = errors.New("route dictionary has no codes left")
+
+var defaultDictionary = NewDictionary()
+
+// DefaultDictionary returns the package dictionary, which is changed by
+// SetDictionary and used by the encoders that have no dictionary
+func DefaultDictionary() *Dictionary {
+	return defaultDictionary
+}
+
+// Dictionary maps the routes to the codes sent in their place in the
+// messages, which is known as route compression. It is safe for concurrent use
+type Dictionary struct {
+	mutex  sync.RWMutex
+	routes map[string]uint16 // route map to code
+	codes  map[uint16]string // code map to route
+}
+
+// NewDictionary returns a new empty dictionary
+func NewDictionary() *Dictionary {
+	return &Dictionary{
+		routes: make(map[string]uint16),
+		codes:  make(map[uint16]string),
+	}
+}
+
+// Set adds the routes in dict with their codes, it fails if any of the
+// routes or codes is already in the dictionary
+func (d *Dictionary) Set(dict map[string]uint16) error {
+	if dict == nil {
+		return nil
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for route, code := range dict {
+		r := strings.TrimSpace(route)
+
+		// duplication check
+		if _, ok := d.routes[r]; ok {
+			return fmt.Errorf("duplicated route(route: %s, code: %d)", r, code)
+		}
+
+		if _, ok := d.codes[code]; ok {
+			return fmt.Errorf("duplicated route(route: %s, code: %d)", r, code)
+		}
+
+		// update map, using last value when key duplicated
+		d.routes[r] = code
+		d.codes[code] = r
+	}
+
+	return nil
+}
+
+// AddRoutes adds the routes that are not in the dictionary, giving them
+// the codes after the highest one in sorted order, so that the same routes
+// always get the same codes
+func (d *Dictionary) AddRoutes(routes ...string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	added := map[string]bool{}
+	for _, route := range routes {
+		r := strings.TrimSpace(route)
+		if _, ok := d.routes[r]; !ok && r != "" {
+			added[r] = true
+		}
+	}
+	sorted := make([]string, 0, len(added))
+	for r := range added {
+		sorted = append(sorted, r)
+	}
+	sort.Strings(sorted)
+
+	next := 1
+	for code := range d.codes {
+		if int(code) >= next {
+			next = int(code) + 1
+		}
+	}
+	if next+len(sorted)-1 > math.MaxUint16 {
+		return ErrDictionaryFull
+	}
+	for _, r := range sorted {
+		d.routes[r] = uint16(next)
+		d.codes[uint16(next)] = r
+		next++
+	}
+	return nil
+}
+
+// Routes returns a copy of the map of routes to codes
+func (d *Dictionary) Routes() map[string]uint16 {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	dict := make(map[string]uint16, len(d.routes))
+	for k, v := range d.routes {
+		dict[k] = v
+	}
+	return dict
+}
+
+// Hash returns the version of the dictionary, which is the hex encoded
+// sha256 of its routes sorted and followed by their codes, one per line as
+// in "route=code\n". Clients that have the dictionary cached send its hash
+// in the handshake so that it is not sent again
+func (d *Dictionary) Hash() string {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	sorted := make([]string, 0, len(d.routes))
+	for r := range d.routes {
+		sorted = append(sorted, r)
+	}
+	sort.Strings(sorted)
+
+	h := sha256.New()
+	for _, r := range sorted {
+		fmt.Fprintf(h, "%s=%d\n", r, d.routes[r])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (d *Dictionary) code(route string) (uint16, bool) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	code, ok := d.routes[route]
+	return code, ok
+}
+
+func (d *Dictionary) route(code uint16) (string, bool) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	route, ok := d.codes[code]
+	return route, ok
+}
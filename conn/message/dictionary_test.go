@@ -0,0 +1,87 @@
+package message
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDictionarySet(t *testing.T) {
+	t.Parallel()
+	d := NewDictionary()
+	assert.NoError(t, d.Set(map[string]uint16{" a ": 1, "b": 2}))
+	assert.Equal(t, map[string]uint16{"a": 1, "b": 2}, d.Routes())
+
+	assert.Error(t, d.Set(map[string]uint16{"a": 3}))
+	assert.Error(t, d.Set(map[string]uint16{"c": 2}))
+	assert.NoError(t, d.Set(nil))
+}
+
+func TestDictionaryAddRoutes(t *testing.T) {
+	t.Parallel()
+	d := NewDictionary()
+	assert.NoError(t, d.Set(map[string]uint16{"room.room.join": 10}))
+	assert.NoError(t, d.AddRoutes("room.room.leave", "onChat", "room.room.join", "onChat", ""))
+	assert.Equal(t, map[string]uint16{
+		"room.room.join":  10,
+		"onChat":          11,
+		"room.room.leave": 12,
+	}, d.Routes())
+
+	other := NewDictionary()
+	assert.NoError(t, other.Set(map[string]uint16{"room.room.join": 10}))
+	assert.NoError(t, other.AddRoutes("onChat", "room.room.leave"))
+	assert.Equal(t, d.Routes(), other.Routes())
+	assert.Equal(t, d.Hash(), other.Hash())
+}
+
+func TestDictionaryAddRoutesFull(t *testing.T) {
+	t.Parallel()
+	d := NewDictionary()
+	assert.NoError(t, d.Set(map[string]uint16{"a": math.MaxUint16 - 1}))
+	assert.NoError(t, d.AddRoutes("b"))
+	assert.Equal(t, ErrDictionaryFull, d.AddRoutes("c"))
+	assert.Equal(t, uint16(math.MaxUint16), d.Routes()["b"])
+}
+
+func TestDictionaryHash(t *testing.T) {
+	t.Parallel()
+	d := NewDictionary()
+	empty := d.Hash()
+	assert.Len(t, empty, 64)
+
+	assert.NoError(t, d.Set(map[string]uint16{"a": 1, "b": 2}))
+	hash := d.Hash()
+	assert.NotEqual(t, empty, hash)
+
+	other := NewDictionary()
+	assert.NoError(t, other.Set(map[string]uint16{"b": 2}))
+	assert.NoError(t, other.Set(map[string]uint16{"a": 1}))
+	assert.Equal(t, hash, other.Hash())
+
+	swapped := NewDictionary()
+	assert.NoError(t, swapped.Set(map[string]uint16{"a": 2, "b": 1}))
+	assert.NotEqual(t, hash, swapped.Hash())
+}
+
+func TestMessagesEncoderDictionary(t *testing.T) {
+	t.Parallel()
+	d := NewDictionary()
+	assert.NoError(t, d.Set(map[string]uint16{"room.state": 7}))
+	messageEncoder := NewMessagesEncoder(false)
+	messageEncoder.Dictionary = d
+	assert.Equal(t, d, GetEncoderDictionary(messageEncoder))
+	assert.Equal(t, defaultDictionary, GetEncoderDictionary(NewMessagesEncoder(false)))
+
+	encoded, err := messageEncoder.Encode(&Message{Type: Push, Route: "room.state", Data: []byte("data")})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{byte(Push)<<1 | msgRouteCompressMask, 0x00, 0x07, 'd', 'a', 't', 'a'}, encoded)
+
+	decoded, err := messageEncoder.Decode(encoded)
+	assert.NoError(t, err)
+	assert.Equal(t, "room.state", decoded.Route)
+
+	_, err = Decode(encoded)
+	assert.Equal(t, ErrRouteInfoNotFound, err)
+}
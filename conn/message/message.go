@@ -23,8 +23,8 @@ package message
 import (
 	"errors"
 	"fmt"
-	"strings"
-	"sync"
+
+	"github.com/topfreegames/pitaya/v2/util/compression"
 )
 
 // Type represents the type of message, which could be Request/Notify/Response/Push
@@ -45,8 +45,61 @@ const (
 	msgTypeMask          = 0x07
 	msgRouteLengthMask   = 0xFF
 	msgHeadLength        = 0x02
+	// compressionMask has the algorithm of the messages with the gzipMask
+	// set, which is zero for deflate so old clients can read them
+	compressionMask = 0xC0
+	// sequenceMask is set in the messages with a sequence number, which
+	// comes after the ID. The types only need two of the three bits after
+	// msgRouteCompressMask, so the last one is used for it in the sessions
+	// that negotiated sequence numbers, the other ones read it as a type bit
+	sequenceMask = 0x08
+	// sequencedTypeMask is the msgTypeMask of the sessions that negotiated
+	// sequence numbers
+	sequencedTypeMask = 0x03
+)
+
+// Versions of the wire protocol, the highest one supported by both the
+// server and the client is negotiated in the handshake
+const (
+	// ProtocolVersion1 is the protocol of the clients that do not negotiate
+	// a version, whose uncompressed routes have a one byte length
+	ProtocolVersion1 = 1
+	// ProtocolVersion2 encodes the length of the uncompressed routes as a
+	// varint, so they can be longer than 255 bytes
+	ProtocolVersion2 = 2
+
+	// MinProtocolVersion is the lowest protocol version supported
+	MinProtocolVersion = ProtocolVersion1
+	// MaxProtocolVersion is the highest protocol version supported
+	MaxProtocolVersion = ProtocolVersion2
 )
 
+// NegotiateProtocolVersion returns the highest protocol version up to max
+// within the range supported by a client, whose zero bounds default to
+// ProtocolVersion1. It returns false if there is none
+func NegotiateProtocolVersion(clientMin, clientMax, max int) (int, bool) {
+	if clientMin == 0 {
+		clientMin = ProtocolVersion1
+	}
+	if clientMax == 0 {
+		clientMax = ProtocolVersion1
+	}
+	if clientMax < max {
+		max = clientMax
+	}
+	if max < clientMin || max < MinProtocolVersion {
+		return 0, false
+	}
+	return max, true
+}
+
+// compressionFlags has the compressionMask bits of each algorithm
+var compressionFlags = map[string]byte{
+	compression.Deflate: 0x00,
+	compression.Zstd:    0x40,
+	compression.Snappy:  0x80,
+}
+
 var types = map[Type]string{
 	Request:  "Request",
 	Notify:   "Notify",
@@ -54,17 +107,12 @@ var types = map[Type]string{
 	Push:     "Push",
 }
 
-var (
-	routesCodesMutex = sync.RWMutex{}
-	routes           = make(map[string]uint16) // route map to code
-	codes            = make(map[uint16]string) // code map to route
-)
-
 // Errors that could be occurred in message codec
 var (
-	ErrWrongMessageType  = errors.New("wrong message type")
-	ErrInvalidMessage    = errors.New("invalid message")
-	ErrRouteInfoNotFound = errors.New("route info not found in dictionary")
+	ErrWrongMessageType         = errors.New("wrong message type")
+	ErrInvalidMessage           = errors.New("invalid message")
+	ErrRouteInfoNotFound        = errors.New("route info not found in dictionary")
+	ErrCompressionNotNegotiated = errors.New("compression algorithm not negotiated")
 )
 
 // Message represents a unmarshaled message or a message which to be marshaled
@@ -75,6 +123,7 @@ type Message struct {
 	Data       []byte // payload
 	compressed bool   // is message compressed
 	Err        bool   // is an error message
+	Seq        uint64 // sequence number, zero when the message has none
 }
 
 // New returns a new message instance
@@ -109,41 +158,12 @@ func invalidType(t Type) bool {
 
 // SetDictionary set routes map which be used to compress route.
 func SetDictionary(dict map[string]uint16) error {
-	if dict == nil {
-		return nil
-	}
-	routesCodesMutex.Lock()
-	defer routesCodesMutex.Unlock()
-
-	for route, code := range dict {
-		r := strings.TrimSpace(route)
-
-		// duplication check
-		if _, ok := routes[r]; ok {
-			return fmt.Errorf("duplicated route(route: %s, code: %d)", r, code)
-		}
-
-		if _, ok := codes[code]; ok {
-			return fmt.Errorf("duplicated route(route: %s, code: %d)", r, code)
-		}
-
-		// update map, using last value when key duplicated
-		routes[r] = code
-		codes[code] = r
-	}
-
-	return nil
+	return defaultDictionary.Set(dict)
 }
 
 // GetDictionary gets the routes map which is used to compress route.
 func GetDictionary() map[string]uint16 {
-	routesCodesMutex.RLock()
-	defer routesCodesMutex.RUnlock()
-	dict := make(map[string]uint16)
-	for k, v := range routes {
-		dict[k] = v
-	}
-	return dict
+	return defaultDictionary.Routes()
 }
 
 func (t *Type) String() string {
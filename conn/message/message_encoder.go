@@ -32,14 +32,74 @@ type Encoder interface {
 	Encode(message *Message) ([]byte, error)
 }
 
+// NegotiableEncoder is implemented by the encoders whose compression
+// algorithm is negotiated with each client
+type NegotiableEncoder interface {
+	Encoder
+	// Negotiate returns the encoder for a client supporting the compression
+	// algorithms and zstd dictionaries, along with the chosen ones
+	Negotiate(algorithms []string, dictionaries []uint32) (Encoder, string, uint32)
+}
+
+// VersionedEncoder is implemented by the encoders whose format changes with
+// the protocol version negotiated with each client
+type VersionedEncoder interface {
+	Encoder
+	// WithProtocolVersion returns the encoder for a client using version
+	WithProtocolVersion(version int) Encoder
+}
+
+// GetEncoderProtocolVersion returns the highest protocol version supported
+// by encoder, which is ProtocolVersion1 if its format never changes
+func GetEncoderProtocolVersion(encoder Encoder) int {
+	if _, ok := encoder.(VersionedEncoder); ok {
+		return MaxProtocolVersion
+	}
+	return ProtocolVersion1
+}
+
+// DictionaryEncoder is implemented by the encoders that compress the routes
+// with their own dictionary
+type DictionaryEncoder interface {
+	Encoder
+	// GetDictionary returns the dictionary used to compress the routes
+	GetDictionary() *Dictionary
+}
+
+// GetEncoderDictionary returns the dictionary used by encoder to compress
+// the routes, which is the default one if encoder has none
+func GetEncoderDictionary(encoder Encoder) *Dictionary {
+	if e, ok := encoder.(DictionaryEncoder); ok {
+		return e.GetDictionary()
+	}
+	return defaultDictionary
+}
+
 // MessagesEncoder implements MessageEncoder interface
 type MessagesEncoder struct {
 	DataCompression bool
+	// Compressor compresses the data of the messages, deflate is used when
+	// it is nil
+	Compressor compression.Compressor
+	// CompressionThreshold is the min size of the data that is compressed
+	CompressionThreshold int
+	// CompressionAlgorithms are the algorithms, by order of preference,
+	// negotiated with the clients that advertise the ones they support
+	CompressionAlgorithms []string
+	// Dictionary compresses the routes of the messages, the default one is
+	// used when it is nil
+	Dictionary *Dictionary
+	// ProtocolVersion is the version of the messages format, zero is the
+	// same as ProtocolVersion1
+	ProtocolVersion int
 }
 
 // NewMessagesEncoder returns a new message encoder
 func NewMessagesEncoder(dataCompression bool) *MessagesEncoder {
-	me := &MessagesEncoder{dataCompression}
+	me := &MessagesEncoder{
+		DataCompression:       dataCompression,
+		CompressionAlgorithms: compression.Algorithms(),
+	}
 	return me
 }
 
@@ -48,6 +108,64 @@ func (me *MessagesEncoder) IsCompressionEnabled() bool {
 	return me.DataCompression
 }
 
+// WithProtocolVersion returns a copy of the encoder with the messages
+// format of version
+func (me *MessagesEncoder) WithProtocolVersion(version int) Encoder {
+	versioned := *me
+	versioned.ProtocolVersion = version
+	return &versioned
+}
+
+// Negotiate returns a copy of the encoder compressing the data with the
+// first of its CompressionAlgorithms that is supported by the client, the
+// copy does not compress the data when there is none. When zstd is picked
+// the data is compressed with the latest loaded dictionary the client has,
+// whose ID is returned
+func (me *MessagesEncoder) Negotiate(algorithms []string, dictionaries []uint32) (Encoder, string, uint32) {
+	negotiated := *me
+	negotiated.DataCompression = false
+	if !me.DataCompression {
+		return &negotiated, "", 0
+	}
+	for _, name := range me.CompressionAlgorithms {
+		for _, algorithm := range algorithms {
+			if name != algorithm {
+				continue
+			}
+			compressor, err := compression.GetCompressor(name)
+			if err != nil {
+				continue
+			}
+			negotiated.DataCompression = true
+			negotiated.Compressor = compressor
+			if name != compression.Zstd {
+				return &negotiated, name, 0
+			}
+			dictionary := compression.LatestZstdDictionary(dictionaries)
+			if dictionaryCompressor, err := compression.GetZstdDictionaryCompressor(dictionary); err == nil {
+				negotiated.Compressor = dictionaryCompressor
+			}
+			return &negotiated, name, dictionary
+		}
+	}
+	return &negotiated, "", 0
+}
+
+// GetDictionary returns the dictionary used to compress the routes
+func (me *MessagesEncoder) GetDictionary() *Dictionary {
+	if me.Dictionary == nil {
+		return defaultDictionary
+	}
+	return me.Dictionary
+}
+
+func (me *MessagesEncoder) compressor() compression.Compressor {
+	if me.Compressor == nil {
+		return &compression.DeflateCompressor{}
+	}
+	return me.Compressor
+}
+
 // Encode marshals message to binary format. Different message types is corresponding to
 // different message header, message types is identified by 2-4 bit of flag field. The
 // relationship between message types and message header is presented as follows:
@@ -69,9 +187,7 @@ func (me *MessagesEncoder) Encode(message *Message) ([]byte, error) {
 	buf := make([]byte, 0)
 	flag := byte(message.Type) << 1
 
-	routesCodesMutex.RLock()
-	code, compressed := routes[message.Route]
-	routesCodesMutex.RUnlock()
+	code, compressed := me.GetDictionary().code(message.Route)
 	if compressed {
 		flag |= msgRouteCompressMask
 	}
@@ -80,6 +196,10 @@ func (me *MessagesEncoder) Encode(message *Message) ([]byte, error) {
 		flag |= errorMask
 	}
 
+	if message.Seq > 0 {
+		flag |= sequenceMask
+	}
+
 	buf = append(buf, flag)
 
 	if message.Type == Request || message.Type == Response {
@@ -97,25 +217,38 @@ func (me *MessagesEncoder) Encode(message *Message) ([]byte, error) {
 		}
 	}
 
+	if message.Seq > 0 {
+		buf = binary.AppendUvarint(buf, message.Seq)
+	}
+
 	if routable(message.Type) {
 		if compressed {
 			buf = append(buf, byte((code>>8)&0xFF))
 			buf = append(buf, byte(code&0xFF))
 		} else {
-			buf = append(buf, byte(len(message.Route)))
+			if me.ProtocolVersion >= ProtocolVersion2 {
+				buf = binary.AppendUvarint(buf, uint64(len(message.Route)))
+			} else {
+				buf = append(buf, byte(len(message.Route)))
+			}
 			buf = append(buf, []byte(message.Route)...)
 		}
 	}
 
-	if me.DataCompression {
-		d, err := compression.DeflateData(message.Data)
+	if me.DataCompression && len(message.Data) >= me.CompressionThreshold {
+		compressor := me.compressor()
+		compressionFlag, ok := compressionFlags[compressor.GetName()]
+		if !ok {
+			return nil, compression.ErrUnknownCompressor
+		}
+		d, err := compressor.Compress(message.Data)
 		if err != nil {
 			return nil, err
 		}
 
 		if len(d) < len(message.Data) {
 			message.Data = d
-			buf[0] |= gzipMask
+			buf[0] |= gzipMask | compressionFlag
 		}
 	}
 
@@ -125,19 +258,62 @@ func (me *MessagesEncoder) Encode(message *Message) ([]byte, error) {
 
 // Decode decodes the message
 func (me *MessagesEncoder) Decode(data []byte) (*Message, error) {
-	return Decode(data)
+	return DecodeWithVersion(data, me.GetDictionary(), me.ProtocolVersion)
 }
 
 // Decode unmarshal the bytes slice to a message
 // See ref: https://github.com/topfreegames/pitaya/v2/blob/master/docs/communication_protocol.md
 func Decode(data []byte) (*Message, error) {
+	return DecodeWithDictionary(data, defaultDictionary)
+}
+
+// DecodeWithDictionary unmarshal the bytes slice to a message, whose route
+// code is looked up in dictionary
+func DecodeWithDictionary(data []byte, dictionary *Dictionary) (*Message, error) {
+	return DecodeWithVersion(data, dictionary, ProtocolVersion1)
+}
+
+// DecodeWithVersion unmarshal the bytes slice to a message with the format
+// of the protocol version, whose route code is looked up in dictionary
+func DecodeWithVersion(data []byte, dictionary *Dictionary, version int) (*Message, error) {
+	return decode(data, dictionary, version, false, nil)
+}
+
+// DecodeWithSequence is DecodeWithVersion for the sessions that negotiated
+// sequence numbers, which reads the sequence number of the messages that
+// have one. Other sessions must not use it, since the sequenceMask bit is a
+// type bit for them
+func DecodeWithSequence(data []byte, dictionary *Dictionary, version int) (*Message, error) {
+	return decode(data, dictionary, version, true, nil)
+}
+
+// DecodeWithCompression is DecodeWithVersion, or DecodeWithSequence when
+// sequenced, for a session that negotiated the compression algorithm in its
+// handshake, which is empty if it negotiated none. The data compressed with
+// other algorithms than it and deflate, which the clients use without
+// negotiating, fails with ErrCompressionNotNegotiated, and the data can't
+// decompress to more than compression.MaxDecompressedSize
+func DecodeWithCompression(data []byte, dictionary *Dictionary, version int, sequenced bool, algorithm string) (*Message, error) {
+	return decode(data, dictionary, version, sequenced, func(name string) bool {
+		return name == compression.Deflate || name == algorithm
+	})
+}
+
+// decode decodes data, whose compressed data is decompressed without limit
+// if negotiated is nil, otherwise only if negotiated accepts the algorithm
+// and up to compression.MaxDecompressedSize
+func decode(data []byte, dictionary *Dictionary, version int, sequenced bool, negotiated func(algorithm string) bool) (*Message, error) {
 	if len(data) < msgHeadLength {
 		return nil, ErrInvalidMessage
 	}
 	m := New()
 	flag := data[0]
 	offset := 1
-	m.Type = Type((flag >> 1) & msgTypeMask)
+	typeMask := byte(msgTypeMask)
+	if sequenced {
+		typeMask = sequencedTypeMask
+	}
+	m.Type = Type((flag >> 1) & typeMask)
 
 	if invalidType(m.Type) {
 		return nil, ErrWrongMessageType
@@ -162,6 +338,18 @@ func Decode(data []byte) (*Message, error) {
 	m.Err = flag&errorMask == errorMask
 
 	size := len(data)
+	if sequenced && flag&sequenceMask == sequenceMask {
+		if offset > size {
+			return nil, ErrInvalidMessage
+		}
+		seq, n := binary.Uvarint(data[offset:])
+		if n <= 0 || seq == 0 {
+			return nil, ErrInvalidMessage
+		}
+		m.Seq = seq
+		offset += n
+	}
+
 	if routable(m.Type) {
 		if flag&msgRouteCompressMask == 1 {
 			if offset > size || (offset+2) > size {
@@ -170,9 +358,7 @@ func Decode(data []byte) (*Message, error) {
 
 			m.compressed = true
 			code := binary.BigEndian.Uint16(data[offset:(offset + 2)])
-			routesCodesMutex.RLock()
-			route, ok := codes[code]
-			routesCodesMutex.RUnlock()
+			route, ok := dictionary.route(code)
 			if !ok {
 				return nil, ErrRouteInfoNotFound
 			}
@@ -180,14 +366,16 @@ func Decode(data []byte) (*Message, error) {
 			offset += 2
 		} else {
 			m.compressed = false
-			rl := data[offset]
-			offset++
+			rl, err := decodeRouteLength(data, &offset, version)
+			if err != nil {
+				return nil, err
+			}
 
-			if offset > size || (offset+int(rl)) > size {
+			if offset > size || (offset+rl) > size {
 				return nil, ErrInvalidMessage
 			}
-			m.Route = string(data[offset:(offset + int(rl))])
-			offset += int(rl)
+			m.Route = string(data[offset:(offset + rl)])
+			offset += rl
 		}
 	}
 
@@ -196,12 +384,51 @@ func Decode(data []byte) (*Message, error) {
 	}
 
 	m.Data = data[offset:]
-	var err error
 	if flag&gzipMask == gzipMask {
-		m.Data, err = compression.InflateData(m.Data)
+		compressor, err := compressorOf(flag)
+		if err != nil {
+			return nil, err
+		}
+		if negotiated == nil {
+			m.Data, err = compressor.Decompress(m.Data)
+		} else if negotiated(compressor.GetName()) {
+			m.Data, err = compression.DecompressLimited(compressor, m.Data)
+		} else {
+			err = ErrCompressionNotNegotiated
+		}
 		if err != nil {
 			return nil, err
 		}
 	}
 	return m, nil
 }
+
+// compressorOf returns the compressor of the algorithm in the
+// compressionMask bits of a message flag
+func compressorOf(flag byte) (compression.Compressor, error) {
+	for name, compressionFlag := range compressionFlags {
+		if flag&compressionMask == compressionFlag {
+			return compression.GetCompressor(name)
+		}
+	}
+	return nil, compression.ErrUnknownCompressor
+}
+
+// decodeRouteLength returns the length of the uncompressed route at offset,
+// which is moved past it
+func decodeRouteLength(data []byte, offset *int, version int) (int, error) {
+	if *offset >= len(data) {
+		return 0, ErrInvalidMessage
+	}
+	if version < ProtocolVersion2 {
+		rl := data[*offset]
+		*offset++
+		return int(rl), nil
+	}
+	rl, n := binary.Uvarint(data[*offset:])
+	if n <= 0 || rl > uint64(len(data)) {
+		return 0, ErrInvalidMessage
+	}
+	*offset += n
+	return int(rl), nil
+}
@@ -1,24 +1,28 @@
 package message
 
 import (
+	"bytes"
 	"errors"
 	"flag"
 	"fmt"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/topfreegames/pitaya/v2/helpers"
+	"github.com/topfreegames/pitaya/v2/util/compression"
 )
 
 var update = flag.Bool("update", false, "update .golden files")
 
 func resetDicts(t *testing.T) {
 	t.Helper()
-	routesCodesMutex.Lock()
-	defer routesCodesMutex.Unlock()
-	routes = make(map[string]uint16)
-	codes = make(map[uint16]string)
+	defaultDictionary.mutex.Lock()
+	defer defaultDictionary.mutex.Unlock()
+	defaultDictionary.routes = make(map[string]uint16)
+	defaultDictionary.codes = make(map[uint16]string)
 }
 
 func TestNew(t *testing.T) {
@@ -166,8 +170,8 @@ func TestSetDictionary(t *testing.T) {
 				SetDictionary(dict)
 			}
 
-			assert.Equal(t, table.routes, routes)
-			assert.Equal(t, table.codes, codes)
+			assert.Equal(t, table.routes, defaultDictionary.routes)
+			assert.Equal(t, table.codes, defaultDictionary.codes)
 
 			resetDicts(t)
 		})
@@ -192,10 +196,10 @@ func TestSetDictionaryRace(t *testing.T) {
 	<-done
 
 	expected_codes := map[uint16]string{1: "a", 2: "b"}
-	assert.EqualValues(t, expected_codes, codes)
+	assert.EqualValues(t, expected_codes, defaultDictionary.codes)
 
 	expected_routes := map[string]uint16{"a": 1, "b": 2}
-	assert.EqualValues(t, expected_routes, routes)
+	assert.EqualValues(t, expected_routes, defaultDictionary.routes)
 }
 
 func TestGetDictionary(t *testing.T) {
@@ -207,5 +211,212 @@ func TestGetDictionary(t *testing.T) {
 	assert.Equal(t, expected, dict)
 
 	// make sure we're copying the routes maps
-	assert.NotEqual(t, fmt.Sprintf("%p", routes), fmt.Sprintf("%p", dict))
+	assert.NotEqual(t, fmt.Sprintf("%p", defaultDictionary.routes), fmt.Sprintf("%p", dict))
+}
+
+func TestEncodeDecodeCompression(t *testing.T) {
+	data := bytes.Repeat([]byte(`{"id":1,"name":"sword"}`), 20)
+	for _, algorithm := range compression.Algorithms() {
+		t.Run(algorithm, func(t *testing.T) {
+			compressor, err := compression.GetCompressor(algorithm)
+			assert.NoError(t, err)
+			messageEncoder := NewMessagesEncoder(true)
+			messageEncoder.Compressor = compressor
+
+			result, err := messageEncoder.Encode(&Message{Type: Push, Route: "room.state", Data: data})
+			assert.NoError(t, err)
+			assert.Equal(t, byte(gzipMask), result[0]&gzipMask)
+			assert.Equal(t, compressionFlags[algorithm], result[0]&compressionMask)
+
+			decoded, err := Decode(result)
+			assert.NoError(t, err)
+			assert.Equal(t, data, decoded.Data)
+			assert.Equal(t, "room.state", decoded.Route)
+		})
+	}
+}
+
+func TestEncodeDecodeSequence(t *testing.T) {
+	messageEncoder := NewMessagesEncoder(false)
+	for _, msg := range []*Message{
+		{Type: Request, ID: 300, Route: "shop.buy", Data: []byte("{}"), Seq: 1},
+		{Type: Notify, Route: "shop.buy", Data: []byte("{}"), Seq: 1 << 40},
+		{Type: Request, ID: 1, Route: "shop.buy", Data: []byte("{}")},
+	} {
+		result, err := messageEncoder.Encode(msg)
+		assert.NoError(t, err)
+		assert.Equal(t, msg.Seq > 0, result[0]&sequenceMask == sequenceMask)
+
+		decoded, err := DecodeWithSequence(result, nil, ProtocolVersion1)
+		assert.NoError(t, err)
+		assert.Equal(t, msg, decoded)
+	}
+
+	_, err := DecodeWithSequence([]byte{byte(Notify)<<1 | sequenceMask, 0x80}, nil, ProtocolVersion1)
+	assert.Equal(t, ErrInvalidMessage, err)
+	_, err = DecodeWithSequence([]byte{byte(Notify)<<1 | sequenceMask, 0x00, 0x01, 'a'}, nil, ProtocolVersion1)
+	assert.Equal(t, ErrInvalidMessage, err)
+
+	// the sessions that did not negotiate sequence numbers read the bit as
+	// part of the type, as before they existed
+	_, err = Decode([]byte{byte(Notify)<<1 | sequenceMask, 0x01, 0x01, 'a'})
+	assert.Equal(t, ErrWrongMessageType, err)
+}
+
+func TestNegotiateProtocolVersion(t *testing.T) {
+	tables := []struct {
+		name      string
+		clientMin int
+		clientMax int
+		max       int
+		version   int
+		ok        bool
+	}{
+		{"no_range", 0, 0, MaxProtocolVersion, ProtocolVersion1, true},
+		{"highest_mutual", 1, 5, MaxProtocolVersion, MaxProtocolVersion, true},
+		{"client_max", 1, 1, MaxProtocolVersion, ProtocolVersion1, true},
+		{"server_max", 1, 2, ProtocolVersion1, ProtocolVersion1, true},
+		{"only_max", 0, 2, MaxProtocolVersion, ProtocolVersion2, true},
+		{"client_too_new", 3, 5, MaxProtocolVersion, 0, false},
+		{"invalid_range", 2, 1, MaxProtocolVersion, 0, false},
+	}
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			version, ok := NegotiateProtocolVersion(table.clientMin, table.clientMax, table.max)
+			assert.Equal(t, table.version, version)
+			assert.Equal(t, table.ok, ok)
+		})
+	}
+}
+
+func TestEncodeDecodeProtocolVersion(t *testing.T) {
+	longRoute := strings.Repeat("a", 300)
+	messageEncoder := NewMessagesEncoder(false)
+	assert.Equal(t, MaxProtocolVersion, GetEncoderProtocolVersion(messageEncoder))
+	versioned := messageEncoder.WithProtocolVersion(ProtocolVersion2).(*MessagesEncoder)
+	assert.Equal(t, 0, messageEncoder.ProtocolVersion)
+
+	msg := &Message{Type: Notify, Route: longRoute, Data: []byte("{}")}
+	result, err := versioned.Encode(msg)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0xac, 0x02}, result[1:3])
+	decoded, err := versioned.Decode(result)
+	assert.NoError(t, err)
+	assert.Equal(t, msg, decoded)
+
+	// version 1 keeps the one byte length
+	msg = &Message{Type: Notify, Route: "room.join", Data: []byte("{}")}
+	result, err = messageEncoder.Encode(msg)
+	assert.NoError(t, err)
+	assert.Equal(t, byte(len(msg.Route)), result[1])
+	decoded, err = DecodeWithVersion(result, nil, ProtocolVersion1)
+	assert.NoError(t, err)
+	assert.Equal(t, msg, decoded)
+	_, err = DecodeWithVersion(result[:1], nil, ProtocolVersion2)
+	assert.Equal(t, ErrInvalidMessage, err)
+}
+
+func TestEncodeCompressionThreshold(t *testing.T) {
+	data := bytes.Repeat([]byte("a"), 100)
+	messageEncoder := NewMessagesEncoder(true)
+
+	messageEncoder.CompressionThreshold = 101
+	result, err := messageEncoder.Encode(&Message{Type: Push, Route: "room.state", Data: data})
+	assert.NoError(t, err)
+	assert.Equal(t, byte(0), result[0]&gzipMask)
+
+	messageEncoder.CompressionThreshold = 100
+	result, err = messageEncoder.Encode(&Message{Type: Push, Route: "room.state", Data: data})
+	assert.NoError(t, err)
+	assert.Equal(t, byte(gzipMask), result[0]&gzipMask)
+}
+
+func TestDecodeUnknownCompression(t *testing.T) {
+	_, err := Decode([]byte{byte(Push)<<1 | gzipMask | compressionMask, 0x01, 'a', 0x01})
+	assert.Equal(t, compression.ErrUnknownCompressor, err)
+}
+
+func TestDecodeWithCompression(t *testing.T) {
+	data := bytes.Repeat([]byte("a"), 100)
+	for _, name := range compression.Algorithms() {
+		t.Run(name, func(t *testing.T) {
+			compressor, err := compression.GetCompressor(name)
+			assert.NoError(t, err)
+			messageEncoder := NewMessagesEncoder(true)
+			messageEncoder.Compressor = compressor
+			msg := &Message{Type: Notify, Route: "room.join", Data: data}
+			result, err := messageEncoder.Encode(msg)
+			assert.NoError(t, err)
+
+			decoded, err := DecodeWithCompression(result, nil, ProtocolVersion1, false, name)
+			assert.NoError(t, err)
+			assert.Equal(t, data, decoded.Data)
+
+			// deflate is accepted without negotiating, as old clients use it
+			_, err = DecodeWithCompression(result, nil, ProtocolVersion1, false, "")
+			if name == compression.Deflate {
+				assert.NoError(t, err)
+			} else {
+				assert.Equal(t, ErrCompressionNotNegotiated, err)
+			}
+		})
+	}
+}
+
+func TestMessagesEncoderNegotiate(t *testing.T) {
+	tables := []struct {
+		name        string
+		compression bool
+		server      []string
+		client      []string
+		algorithm   string
+	}{
+		{"server_preference", true, []string{"zstd", "snappy", "deflate"}, []string{"deflate", "snappy", "zstd"}, "zstd"},
+		{"common_algorithm", true, []string{"zstd", "deflate"}, []string{"snappy", "deflate"}, "deflate"},
+		{"no_common_algorithm", true, []string{"zstd"}, []string{"snappy"}, ""},
+		{"unknown_algorithm", true, []string{"lz4", "snappy"}, []string{"lz4", "snappy"}, "snappy"},
+		{"compression_disabled", false, []string{"zstd"}, []string{"zstd"}, ""},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			messageEncoder := NewMessagesEncoder(table.compression)
+			messageEncoder.CompressionAlgorithms = table.server
+
+			negotiated, algorithm, dictionary := messageEncoder.Negotiate(table.client, nil)
+			assert.Equal(t, uint32(0), dictionary)
+			assert.Equal(t, table.algorithm, algorithm)
+			assert.Equal(t, table.algorithm != "", negotiated.IsCompressionEnabled())
+			if table.algorithm != "" {
+				assert.Equal(t, table.algorithm, negotiated.(*MessagesEncoder).Compressor.GetName())
+			}
+			assert.Equal(t, table.compression, messageEncoder.IsCompressionEnabled())
+			assert.Nil(t, messageEncoder.Compressor)
+		})
+	}
+}
+
+func TestMessagesEncoderNegotiateZstdDictionary(t *testing.T) {
+	dictionary, err := os.ReadFile(filepath.Join("..", "..", "util", "compression", "fixtures", "zstd_dictionary_1"))
+	assert.NoError(t, err)
+	id, err := compression.LoadZstdDictionary(dictionary)
+	assert.NoError(t, err)
+
+	messageEncoder := NewMessagesEncoder(true)
+	negotiated, algorithm, negotiatedID := messageEncoder.Negotiate([]string{compression.Zstd}, []uint32{42, id})
+	assert.Equal(t, compression.Zstd, algorithm)
+	assert.Equal(t, id, negotiatedID)
+	assert.Equal(t, id, negotiated.(*MessagesEncoder).Compressor.(*compression.ZstdCompressor).DictionaryID())
+
+	data := bytes.Repeat([]byte(`{"id":1,"name":"sword"}`), 10)
+	encoded, err := negotiated.Encode(&Message{Type: Push, Route: "room.state", Data: data})
+	assert.NoError(t, err)
+	decoded, err := Decode(encoded)
+	assert.NoError(t, err)
+	assert.Equal(t, data, decoded.Data)
+
+	_, _, negotiatedID = messageEncoder.Negotiate([]string{compression.Snappy}, []uint32{id})
+	assert.Equal(t, uint32(0), negotiatedID)
+	_, _, negotiatedID = messageEncoder.Negotiate([]string{compression.Zstd}, []uint32{42})
+	assert.Equal(t, uint32(0), negotiatedID)
 }
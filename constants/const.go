@@ -93,6 +93,21 @@ var GRPCExternalPortKey = "grpc-external-port"
 // RegionKey is the key to save the region server is on
 var RegionKey = "region"
 
+// ProxyProtocolKey is the key to save the PROXY protocol TLVs on the
+// session, prefixed so it does not collide with the keys set by the
+// application
+var ProxyProtocolKey = "pitaya.proxyprotocol"
+
+// ProtocolVersionKey is the key to save the protocol version negotiated in
+// the handshake on the session, prefixed so it does not collide with the
+// keys set by the application
+var ProtocolVersionKey = "pitaya.protocolversion"
+
+// SerializerKey is the key to save the serializer negotiated in the
+// handshake on the session, prefixed so it does not collide with the keys
+// set by the application
+var SerializerKey = "pitaya.serializer"
+
 // IP constants
 const (
 	IPVersionKey = "ipversion"
@@ -24,6 +24,7 @@ import "errors"
 
 // Errors that can occur during message handling.
 var (
+	ErrAcceptorStopped                = errors.New("acceptor is stopped")
 	ErrBindingNotFound                = errors.New("binding for this user was not found in etcd")
 	ErrBrokenPipe                     = errors.New("broken low-level pipe")
 	ErrBufferExceed                   = errors.New("session send buffer exceed")
@@ -84,7 +85,14 @@ var (
 	ErrTimeoutTerminatingBinaryModule = errors.New("timeout waiting to binary module to die")
 	ErrWrongValueType                 = errors.New("protobuf: convert on wrong type value")
 	ErrRateLimitExceeded              = errors.New("rate limit exceeded")
+	ErrConnectionLimitExceeded        = errors.New("connection limit exceeded")
+	ErrConnectionNotAllowed           = errors.New("connection not allowed by ip filtering")
 	ErrReceivedMsgSmallerThanExpected = errors.New("received less data than expected, EOF?")
 	ErrReceivedMsgBiggerThanExpected  = errors.New("received more data than expected")
 	ErrConnectionClosed               = errors.New("client connection closed")
+	ErrOutgoingQueueFull              = errors.New("too much data queued for the client")
+	ErrMissingSequence                = errors.New("message has no sequence number")
+	ErrReplayedMessage                = errors.New("message sequence number was already received")
+	ErrSequenceOutOfWindow            = errors.New("message sequence number is older than the replay window")
+	ErrProtocolVersionNotSupported    = errors.New("no protocol version supported by both client and server")
 )
@@ -42,7 +42,9 @@ import (
 	"github.com/topfreegames/pitaya/v2/modules"
 	"github.com/topfreegames/pitaya/v2/protos/test"
 	"github.com/topfreegames/pitaya/v2/serialize/json"
+	"github.com/topfreegames/pitaya/v2/serialize/msgpack"
 	"github.com/topfreegames/pitaya/v2/serialize/protobuf"
+	"github.com/topfreegames/pitaya/v2/serialize/protojson"
 	"github.com/topfreegames/pitaya/v2/session"
 )
 
@@ -250,7 +252,7 @@ func main() {
 	port := flag.Int("port", 32222, "the port to listen")
 	svType := flag.String("type", "connector", "the server type")
 	isFrontend := flag.Bool("frontend", true, "if server is frontend")
-	serializer := flag.String("serializer", "json", "json or protobuf")
+	serializer := flag.String("serializer", "json", "json, protobuf, protojson or msgpack")
 	sdPrefix := flag.String("sdprefix", "pitaya/", "prefix to discover other servers")
 	debug := flag.Bool("debug", false, "turn on debug logging")
 	grpc := flag.Bool("grpc", false, "turn on grpc")
@@ -313,8 +315,12 @@ func createApp(serializer string, port int, grpc bool, isFrontend bool, svType s
 		builder.Serializer = json.NewSerializer()
 	} else if serializer == "protobuf" {
 		builder.Serializer = protobuf.NewSerializer()
+	} else if serializer == "protojson" {
+		builder.Serializer = protojson.NewSerializer()
+	} else if serializer == "msgpack" {
+		builder.Serializer = msgpack.NewSerializer()
 	} else {
-		panic("serializer should be either json or protobuf")
+		panic("serializer should be either json, protobuf, protojson or msgpack")
 	}
 
 	var bs *modules.ETCDBindingStorage
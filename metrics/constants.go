@@ -28,4 +28,13 @@ var (
 	// ExceededRateLimiting reports the number of requests made in a connection
 	// after the rate limit was exceeded
 	ExceededRateLimiting = "exceeded_rate_limiting"
+	// RejectedConnections reports the number of connections closed by the
+	// acceptor for exceeding the connection limits
+	RejectedConnections = "rejected_connections"
+	// ExceededRouteRateLimiting reports the number of messages sent by a
+	// client after its route rate limit was exceeded
+	ExceededRouteRateLimiting = "exceeded_route_rate_limiting"
+	// RejectedHandshakes reports the number of connections closed for not
+	// completing the handshake within the handshake limits
+	RejectedHandshakes = "rejected_handshakes"
 )
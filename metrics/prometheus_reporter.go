@@ -286,6 +286,39 @@ func (p *PrometheusReporter) registerMetrics(
 		additionalLabelsKeys,
 	)
 
+	p.countReportersMap[RejectedConnections] = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   "pitaya",
+			Subsystem:   "acceptor",
+			Name:        RejectedConnections,
+			Help:        "the number of connections rejected by exceeded connection limits",
+			ConstLabels: constLabels,
+		},
+		append([]string{"reason"}, additionalLabelsKeys...),
+	)
+
+	p.countReportersMap[RejectedHandshakes] = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   "pitaya",
+			Subsystem:   "handler",
+			Name:        RejectedHandshakes,
+			Help:        "the number of connections closed by exceeded handshake limits",
+			ConstLabels: constLabels,
+		},
+		append([]string{"reason"}, additionalLabelsKeys...),
+	)
+
+	p.countReportersMap[ExceededRouteRateLimiting] = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   "pitaya",
+			Subsystem:   "handler",
+			Name:        ExceededRouteRateLimiting,
+			Help:        "the number of messages limited by exceeded route rate limiting",
+			ConstLabels: constLabels,
+		},
+		append([]string{"route", "action"}, additionalLabelsKeys...),
+	)
+
 	toRegister := make([]prometheus.Collector, 0)
 	for _, c := range p.countReportersMap {
 		toRegister = append(toRegister, c)
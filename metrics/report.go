@@ -105,6 +105,30 @@ func ReportExceededRateLimiting(reporters []Reporter) {
 	}
 }
 
+// ReportRejectedConnection reports a connection rejected for exceeding
+// the limit given by reason
+func ReportRejectedConnection(reporters []Reporter, reason string) {
+	for _, r := range reporters {
+		r.ReportCount(RejectedConnections, map[string]string{"reason": reason}, 1)
+	}
+}
+
+// ReportRejectedHandshake reports a connection closed for exceeding the
+// handshake limit given by reason
+func ReportRejectedHandshake(reporters []Reporter, reason string) {
+	for _, r := range reporters {
+		r.ReportCount(RejectedHandshakes, map[string]string{"reason": reason}, 1)
+	}
+}
+
+// ReportExceededRouteRateLimiting reports a message to route that exceeded
+// the route rate limiting and the action taken
+func ReportExceededRouteRateLimiting(reporters []Reporter, route, action string) {
+	for _, r := range reporters {
+		r.ReportCount(ExceededRouteRateLimiting, map[string]string{"route": route, "action": action}, 1)
+	}
+}
+
 func tagsFromContext(ctx context.Context) map[string]string {
 	val := pcontext.GetFromPropagateCtx(ctx, constants.MetricTagsKey)
 	if val == nil {
@@ -44,6 +44,24 @@ func (m *MockPitaya) EXPECT() *MockPitayaMockRecorder {
 	return m.recorder
 }
 
+// AddPushRoutes mocks base method.
+func (m *MockPitaya) AddPushRoutes(arg0 ...string) error {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{}
+	for _, a := range arg0 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "AddPushRoutes", varargs...)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddPushRoutes indicates an expected call of AddPushRoutes.
+func (mr *MockPitayaMockRecorder) AddPushRoutes(arg0 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddPushRoutes", reflect.TypeOf((*MockPitaya)(nil).AddPushRoutes), arg0...)
+}
+
 // AddRoute mocks base method.
 func (m *MockPitaya) AddRoute(arg0 string, arg1 router.RoutingFunc) error {
 	m.ctrl.T.Helper()
@@ -27,6 +27,7 @@ import (
 
 	"github.com/sirupsen/logrus"
 	"github.com/topfreegames/pitaya/v2/client"
+	"github.com/topfreegames/pitaya/v2/serialize/msgpack"
 )
 
 func connect(logger Log, addr string, onMessageCallback func([]byte)) (err error) {
@@ -37,6 +38,11 @@ func connect(logger Log, addr string, onMessageCallback func([]byte)) (err error
 	switch {
 	case docsString != "":
 		err = protoClient(logger, addr)
+	case serializer == "msgpack":
+		logger.Println("Using msgpack client")
+		c := client.New(logrus.InfoLevel)
+		c.SetSerializer(msgpack.NewSerializer())
+		pClient = c
 	default:
 		logger.Println("Using json client")
 		pClient = client.New(logrus.InfoLevel)
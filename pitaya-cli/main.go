@@ -36,6 +36,7 @@ var (
 	pushInfo       map[string]string
 	wait           sync.WaitGroup
 	prettyJSON     bool
+	serializer     string
 	handshake      *session.HandshakeData
 )
 
@@ -43,6 +44,7 @@ func main() {
 	flag.StringVar(&docsString, "docs", "", "documentation route")
 	flag.StringVar(&fileName, "filename", "", "file with commands")
 	flag.BoolVar(&prettyJSON, "pretty", false, "print pretty jsons")
+	flag.StringVar(&serializer, "serializer", "json", "serializer used by the server, json or msgpack")
 	flag.Parse()
 	handshake = &session.HandshakeData{
 		Sys: session.HandshakeClientData{
@@ -45,7 +45,15 @@ func (app *App) SendPushToUsers(route string, v interface{}, uids []string, fron
 
 	for _, uid := range uids {
 		if s := app.sessionPool.GetSessionByUID(uid); s != nil && app.server.Type == frontendType {
-			if err := s.Push(route, data); err != nil {
+			payload := interface{}(data)
+			if len(app.serializers) > 0 {
+				if name := s.String(constants.SerializerKey); name != "" && name != app.serializer.GetName() {
+					// the session negotiated another serializer, so its
+					// agent serializes v instead
+					payload = v
+				}
+			}
+			if err := s.Push(route, payload); err != nil {
 				notPushedUids = append(notPushedUids, uid)
 				logger.Log.Errorf("Session push message error, ID=%d, UID=%s, Error=%s",
 					s.ID(), s.UID(), err.Error())
@@ -31,7 +31,9 @@ import (
 	"github.com/topfreegames/pitaya/v2/config"
 	"github.com/topfreegames/pitaya/v2/constants"
 	"github.com/topfreegames/pitaya/v2/protos"
+	"github.com/topfreegames/pitaya/v2/serialize"
 	serializemocks "github.com/topfreegames/pitaya/v2/serialize/mocks"
+	"github.com/topfreegames/pitaya/v2/serialize/msgpack"
 	sessionmocks "github.com/topfreegames/pitaya/v2/session/mocks"
 )
 
@@ -112,6 +114,36 @@ func TestSendToUsersLocalSession(t *testing.T) {
 	}
 }
 
+func TestSendToUsersLocalSessionNegotiatedSerializer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	route := "some.route.bla"
+	data := &someStruct{A: 10}
+	uid1 := uuid.New().String()
+	uid2 := uuid.New().String()
+
+	s1 := sessionmocks.NewMockSession(ctrl)
+	s2 := sessionmocks.NewMockSession(ctrl)
+	s1.EXPECT().String(constants.SerializerKey).Return("json")
+	s2.EXPECT().String(constants.SerializerKey).Return("msgpack")
+	s1.EXPECT().Push(route, []byte(`{"A":10}`)).Times(1)
+	s2.EXPECT().Push(route, data).Times(1)
+
+	mockSessionPool := sessionmocks.NewMockSessionPool(ctrl)
+	mockSessionPool.EXPECT().GetSessionByUID(uid1).Return(s1).Times(1)
+	mockSessionPool.EXPECT().GetSessionByUID(uid2).Return(s2).Times(1)
+
+	config := config.NewDefaultBuilderConfig()
+	builder := NewDefaultBuilder(true, "testtype", Standalone, map[string]string{}, *config)
+	builder.SessionPool = mockSessionPool
+	builder.Serializers = []serialize.Serializer{msgpack.NewSerializer()}
+	app := builder.Build().(*App)
+	errArr, err := app.SendPushToUsers(route, data, []string{uid1, uid2}, app.server.Type)
+	assert.NoError(t, err)
+	assert.Len(t, errArr, 0)
+}
+
 func TestSendToUsersRemoteSession(t *testing.T) {
 	tables := []struct {
 		name string
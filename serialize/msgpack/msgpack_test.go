@@ -0,0 +1,123 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package msgpack
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topfreegames/pitaya/v2/protos"
+)
+
+func TestNewSerializer(t *testing.T) {
+	t.Parallel()
+
+	serializer := NewSerializer()
+
+	assert.NotNil(t, serializer)
+}
+
+type taggedStruct struct {
+	Str      string `json:"str"`
+	Number   int    `json:"number,omitempty"`
+	Renamed  string `json:"renamed" msgpack:"other"`
+	Ignored  string `json:"-"`
+	Untagged float64
+}
+
+func TestMarshal(t *testing.T) {
+	t.Parallel()
+
+	var marshalTables = map[string]struct {
+		raw       interface{}
+		marshaled map[string]interface{}
+	}{
+		"test_json_tags": {
+			&taggedStruct{Str: "hello", Number: 42, Renamed: "r", Ignored: "i", Untagged: 1.5},
+			map[string]interface{}{"str": "hello", "number": int64(42), "other": "r", "Untagged": 1.5},
+		},
+		"test_omitempty": {
+			&taggedStruct{Str: "hello"},
+			map[string]interface{}{"str": "hello", "other": "", "Untagged": 0.0},
+		},
+		"test_error": {
+			&protos.Error{Code: "PIT-400", Msg: "bad request", Metadata: map[string]string{"key": "value"}},
+			map[string]interface{}{"code": "PIT-400", "msg": "bad request", "metadata": map[string]interface{}{"key": "value"}},
+		},
+		"test_error_without_metadata": {
+			&protos.Error{Code: "PIT-500", Msg: "internal"},
+			map[string]interface{}{"code": "PIT-500", "msg": "internal"},
+		},
+	}
+	serializer := NewSerializer()
+
+	for name, table := range marshalTables {
+		t.Run(name, func(t *testing.T) {
+			result, err := serializer.Marshal(table.raw)
+			assert.NoError(t, err)
+
+			var decoded map[string]interface{}
+			assert.NoError(t, serializer.Unmarshal(result, &decoded))
+			assert.Equal(t, table.marshaled, decoded)
+		})
+	}
+}
+
+func TestMarshalUnsupportedValue(t *testing.T) {
+	t.Parallel()
+
+	serializer := NewSerializer()
+	_, err := serializer.Marshal(make(chan int))
+	assert.Error(t, err)
+}
+
+func TestUnmarshal(t *testing.T) {
+	t.Parallel()
+
+	serializer := NewSerializer()
+
+	t.Run("test_ok", func(t *testing.T) {
+		raw := &taggedStruct{Str: "hello", Number: 42, Renamed: "r", Untagged: 1.5}
+		data, err := serializer.Marshal(raw)
+		assert.NoError(t, err)
+
+		var result taggedStruct
+		assert.NoError(t, serializer.Unmarshal(data, &result))
+		assert.Equal(t, raw, &result)
+	})
+
+	t.Run("test_error", func(t *testing.T) {
+		raw := &protos.Error{Code: "PIT-400", Msg: "bad request", Metadata: map[string]string{"key": "value"}}
+		data, err := serializer.Marshal(raw)
+		assert.NoError(t, err)
+
+		result := &protos.Error{}
+		assert.NoError(t, serializer.Unmarshal(data, result))
+		assert.Equal(t, raw.Code, result.Code)
+		assert.Equal(t, raw.Msg, result.Msg)
+		assert.Equal(t, raw.Metadata, result.Metadata)
+	})
+
+	t.Run("test_nok", func(t *testing.T) {
+		var result taggedStruct
+		assert.Error(t, serializer.Unmarshal([]byte{0xc1}, &result))
+	})
+}
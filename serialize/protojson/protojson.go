@@ -0,0 +1,93 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package protojson
+
+import (
+	"encoding/json"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Serializer implements the serialize.Serializer interface. It encodes the
+// protobuf messages with protojson, which follows the protobuf JSON mapping
+// for oneofs, enums and well-known types such as Timestamp and Any, and the
+// other values with encoding/json. Its name is protojson, so clients can
+// negotiate it in the handshake alongside the json serializer
+type Serializer struct {
+	marshalOptions   protojson.MarshalOptions
+	unmarshalOptions protojson.UnmarshalOptions
+}
+
+// Option configures the Serializer
+type Option func(s *Serializer)
+
+// WithEmitDefaults makes the serializer write the fields of the protobuf
+// messages that have their default values, which are omitted otherwise
+func WithEmitDefaults() Option {
+	return func(s *Serializer) {
+		s.marshalOptions.EmitUnpopulated = true
+	}
+}
+
+// WithUseProtoNames makes the serializer write the fields of the protobuf
+// messages with their names in the proto file instead of their lowerCamelCase
+// JSON names. Both names are accepted when unmarshaling
+func WithUseProtoNames() Option {
+	return func(s *Serializer) {
+		s.marshalOptions.UseProtoNames = true
+	}
+}
+
+// NewSerializer returns a new Serializer.
+func NewSerializer(opts ...Option) *Serializer {
+	s := &Serializer{
+		unmarshalOptions: protojson.UnmarshalOptions{DiscardUnknown: true},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Marshal returns the protojson encoding of v if it is a protobuf message,
+// or its JSON encoding otherwise.
+func (s *Serializer) Marshal(v interface{}) ([]byte, error) {
+	if pb, ok := v.(proto.Message); ok {
+		return s.marshalOptions.Marshal(proto.MessageV2(pb))
+	}
+	return json.Marshal(v)
+}
+
+// Unmarshal parses the JSON-encoded data and stores the result in the value
+// pointed to by v, with protojson if it is a protobuf message. Unknown fields
+// are ignored, as with encoding/json.
+func (s *Serializer) Unmarshal(data []byte, v interface{}) error {
+	if pb, ok := v.(proto.Message); ok {
+		return s.unmarshalOptions.Unmarshal(data, proto.MessageV2(pb))
+	}
+	return json.Unmarshal(data, v)
+}
+
+// GetName returns the name of the serializer.
+func (s *Serializer) GetName() string {
+	return "protojson"
+}
@@ -0,0 +1,149 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package protojson
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topfreegames/pitaya/v2/protos"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestNewSerializer(t *testing.T) {
+	t.Parallel()
+
+	serializer := NewSerializer()
+
+	assert.NotNil(t, serializer)
+	assert.Equal(t, "protojson", serializer.GetName())
+}
+
+func TestMarshal(t *testing.T) {
+	t.Parallel()
+
+	type MyStruct struct {
+		Str    string
+		Number float64
+	}
+	field := &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String("field"),
+		Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+		TypeName: proto.String("string"),
+	}
+	anyField, err := anypb.New(field)
+	assert.NoError(t, err)
+
+	var marshalTables = map[string]struct {
+		opts      []Option
+		raw       interface{}
+		marshaled string
+	}{
+		"test_struct": {
+			nil,
+			&MyStruct{Str: "hello", Number: 42},
+			`{"Str":"hello","Number":42}`,
+		},
+		"test_enum_and_json_names": {
+			nil,
+			field,
+			`{"name":"field","type":"TYPE_STRING","typeName":"string"}`,
+		},
+		"test_proto_names": {
+			[]Option{WithUseProtoNames()},
+			field,
+			`{"name":"field","type":"TYPE_STRING","type_name":"string"}`,
+		},
+		"test_timestamp": {
+			nil,
+			timestamppb.New(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)),
+			`"2020-01-02T03:04:05Z"`,
+		},
+		"test_any": {
+			nil,
+			anyField,
+			`{"@type":"type.googleapis.com/google.protobuf.FieldDescriptorProto","name":"field","type":"TYPE_STRING","typeName":"string"}`,
+		},
+		"test_legacy_message": {
+			nil,
+			&protos.Error{Code: "PIT-400", Msg: "bad request"},
+			`{"code":"PIT-400","msg":"bad request"}`,
+		},
+		"test_emit_defaults": {
+			[]Option{WithEmitDefaults()},
+			&protos.Error{Code: "PIT-400"},
+			`{"code":"PIT-400","msg":"","metadata":{}}`,
+		},
+	}
+
+	for name, table := range marshalTables {
+		t.Run(name, func(t *testing.T) {
+			result, err := NewSerializer(table.opts...).Marshal(table.raw)
+			assert.NoError(t, err)
+			assert.JSONEq(t, table.marshaled, string(result))
+		})
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	t.Parallel()
+
+	serializer := NewSerializer()
+
+	t.Run("test_struct", func(t *testing.T) {
+		type MyStruct struct {
+			Str    string
+			Number int
+		}
+		var result MyStruct
+		assert.NoError(t, serializer.Unmarshal([]byte(`{"Str":"hello","Number":42}`), &result))
+		assert.Equal(t, MyStruct{Str: "hello", Number: 42}, result)
+	})
+
+	t.Run("test_message", func(t *testing.T) {
+		for _, data := range []string{
+			`{"name":"field","type":"TYPE_STRING","typeName":"string","unknown":1}`,
+			`{"name":"field","type":9,"type_name":"string"}`,
+		} {
+			result := &descriptorpb.FieldDescriptorProto{}
+			assert.NoError(t, serializer.Unmarshal([]byte(data), result))
+			assert.Equal(t, "field", result.GetName())
+			assert.Equal(t, descriptorpb.FieldDescriptorProto_TYPE_STRING, result.GetType())
+			assert.Equal(t, "string", result.GetTypeName())
+		}
+	})
+
+	t.Run("test_timestamp", func(t *testing.T) {
+		result := &timestamppb.Timestamp{}
+		assert.NoError(t, serializer.Unmarshal([]byte(`"2020-01-02T03:04:05Z"`), result))
+		assert.Equal(t, time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), result.AsTime())
+	})
+
+	t.Run("test_nok", func(t *testing.T) {
+		assert.Error(t, serializer.Unmarshal([]byte(`invalid`), &protos.Error{}))
+		var result map[string]interface{}
+		assert.Error(t, serializer.Unmarshal([]byte(`invalid`), &result))
+	})
+}
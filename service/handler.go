@@ -26,6 +26,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"sort"
 	"strings"
 	"time"
 
@@ -38,6 +39,7 @@ import (
 	"github.com/topfreegames/pitaya/v2/agent"
 	"github.com/topfreegames/pitaya/v2/cluster"
 	"github.com/topfreegames/pitaya/v2/component"
+	"github.com/topfreegames/pitaya/v2/config"
 	"github.com/topfreegames/pitaya/v2/conn/codec"
 	"github.com/topfreegames/pitaya/v2/conn/message"
 	"github.com/topfreegames/pitaya/v2/conn/packet"
@@ -54,6 +56,13 @@ import (
 	"github.com/topfreegames/pitaya/v2/tracing"
 )
 
+// Reasons reported in the rejected handshakes metric
+const (
+	rejectReasonHandshakeTimeout = "timeout"
+	rejectReasonHandshakePackets = "packets"
+	rejectReasonHandshakeSize    = "size"
+)
+
 var (
 	handlerType = "handler"
 )
@@ -73,6 +82,16 @@ type (
 		agentFactory     agent.AgentFactory
 		handlerPool      *HandlerPool
 		handlers         map[string]*component.Handler // all handler method
+		rateLimiter      *RouteRateLimiter             // limits the messages of each client, nil if disabled
+		handshake        config.HandshakeConfig        // limits the clients that did not finish the handshake
+		dictionary       *message.Dictionary           // decodes the compressed routes
+	}
+
+	// connState is the state kept for each connection by the goroutine
+	// reading from it
+	connState struct {
+		limiter          *connRateLimiter
+		packetsBeforeAck int
 	}
 
 	unhandledMessage struct {
@@ -108,6 +127,7 @@ func NewHandlerService(
 		metricsReporters: metricsReporters,
 		handlerPool:      handlerPool,
 		handlers:         make(map[string]*component.Handler),
+		dictionary:       message.DefaultDictionary(),
 	}
 
 	h.handlerHooks = handlerHooks
@@ -115,6 +135,27 @@ func NewHandlerService(
 	return h
 }
 
+// SetRouteRateLimiter sets the rate limiter applied to the messages of each
+// client, nil disables the rate limiting
+func (h *HandlerService) SetRouteRateLimiter(rateLimiter *RouteRateLimiter) {
+	if rateLimiter != nil {
+		rateLimiter.hasHandler = h.hasHandler
+	}
+	h.rateLimiter = rateLimiter
+}
+
+// SetHandshakeConfig sets the limits applied to the clients that did not
+// finish the handshake
+func (h *HandlerService) SetHandshakeConfig(c config.HandshakeConfig) {
+	h.handshake = c
+}
+
+// SetRouteDictionary sets the dictionary used to decode the compressed
+// routes of the messages sent by the clients
+func (h *HandlerService) SetRouteDictionary(dictionary *message.Dictionary) {
+	h.dictionary = dictionary
+}
+
 // Dispatch message to corresponding logic handler
 func (h *HandlerService) Dispatch(thread int) {
 	// TODO: This timer is being stopped multiple times, it probably doesn't need to be stopped here
@@ -179,6 +220,38 @@ func (h *HandlerService) Handle(conn acceptor.PlayerConn) {
 		logger.Log.Debugf("Session read goroutine exit, SessionID=%d, UID=%s", a.GetSession().ID(), a.GetSession().UID())
 	}()
 
+	// started before the client certificate is read, which runs the TLS
+	// handshake, so a client stalling it is closed too
+	if timeout := h.handshake.Timeout; timeout > 0 {
+		handshakeTimer := time.AfterFunc(timeout, func() {
+			if a.GetStatus() < constants.StatusWorking {
+				logger.Log.Warnf("Handshake not finished after %s, closing connection from %s", timeout, conn.RemoteAddr())
+				metrics.ReportRejectedHandshake(h.metricsReporters, rejectReasonHandshakeTimeout)
+				a.Close()
+			}
+		})
+		defer handshakeTimer.Stop()
+	}
+
+	cert, err := acceptor.GetClientCertificate(conn)
+	if err != nil {
+		logger.Log.Errorf("Failed to verify client certificate: %s", err.Error())
+		return
+	} else if cert != nil {
+		a.GetSession().SetClientIdentity(session.NewClientIdentity(cert))
+	}
+
+	if tlvs := acceptor.GetProxyTLVs(conn); len(tlvs) > 0 {
+		if err := a.GetSession().Set(constants.ProxyProtocolKey, tlvs.Metadata()); err != nil {
+			logger.Log.Warnf("Failed to save PROXY protocol TLVs on session: %s", err.Error())
+		}
+	}
+
+	// packets larger than the handshake are rejected from their header until
+	// it is received, when the connection supports it
+	limitedSize := h.handshake.MaxSize > 0 && acceptor.LimitPacketSize(conn, h.handshake.MaxSize)
+
+	state := &connState{limiter: h.rateLimiter.newConnRateLimiter()}
 	for {
 		msg, err := conn.GetNextMessage()
 
@@ -188,6 +261,9 @@ func (h *HandlerService) Handle(conn acceptor.PlayerConn) {
 				logger.Log.Debugf("Connection no longer available while reading next available message: %s", err.Error())
 			} else if err == constants.ErrConnectionClosed {
 				logger.Log.Debugf("Connection no longer available while reading next available message: %s", err.Error())
+			} else if limitedSize && errors.Is(err, codec.ErrPacketSizeExcced) {
+				logger.Log.Warnf("Packet larger than %d bytes before handshake from %s", h.handshake.MaxSize, conn.RemoteAddr())
+				metrics.ReportRejectedHandshake(h.metricsReporters, rejectReasonHandshakeSize)
 			} else {
 				logger.Log.Errorf("Error reading next available message: %s", err.Error())
 			}
@@ -195,7 +271,7 @@ func (h *HandlerService) Handle(conn acceptor.PlayerConn) {
 			return
 		}
 
-		packets, err := h.decoder.Decode(msg)
+		packets, err := h.packetDecoder(a).Decode(msg)
 		if err != nil {
 			logger.Log.Errorf("Failed to decode message: %s", err.Error())
 			return
@@ -208,19 +284,64 @@ func (h *HandlerService) Handle(conn acceptor.PlayerConn) {
 
 		// process all packet
 		for i := range packets {
-			if err := h.processPacket(a, packets[i]); err != nil {
+			if err := h.processPacket(a, packets[i], state); err != nil {
 				logger.Log.Errorf("Failed to process packet: %s", err.Error())
 				return
 			}
 		}
+
+		if limitedSize && a.GetStatus() >= constants.StatusHandshake {
+			acceptor.LimitPacketSize(conn, 0)
+			limitedSize = false
+		}
 	}
 }
 
-func (h *HandlerService) processPacket(a agent.Agent, p *packet.Packet) error {
+// packetDecoder returns the decoder of the packets sent to a, which is its
+// own decoder when it has one
+func (h *HandlerService) packetDecoder(a agent.Agent) codec.PacketDecoder {
+	if d, ok := a.(agent.PacketDecoderAgent); ok {
+		if decoder := d.GetPacketDecoder(); decoder != nil {
+			return decoder
+		}
+	}
+	return h.decoder
+}
+
+// messageSerializer returns the serializer of the messages exchanged with
+// the client of a, which is the one negotiated in the handshake when it has one
+func (h *HandlerService) messageSerializer(a agent.Agent) serialize.Serializer {
+	if s, ok := a.(agent.SerializerAgent); ok {
+		if serializer := s.GetSerializer(); serializer != nil {
+			return serializer
+		}
+	}
+	return h.serializer
+}
+
+func (h *HandlerService) processPacket(a agent.Agent, p *packet.Packet, state *connState) error {
+	if max := h.handshake.MaxPacketsBeforeAck; max > 0 && p.Type != packet.Handshake && a.GetStatus() < constants.StatusWorking {
+		if state.packetsBeforeAck++; state.packetsBeforeAck > max {
+			defer a.Close()
+			metrics.ReportRejectedHandshake(h.metricsReporters, rejectReasonHandshakePackets)
+			return fmt.Errorf("received more than %d packets before handshake ack. Id=%d", max, a.GetSession().ID())
+		}
+	}
+
 	switch p.Type {
 	case packet.Handshake:
 		logger.Log.Debug("Received handshake packet")
 
+		if max := h.handshake.MaxSize; max > 0 && len(p.Data) > max {
+			defer a.Close()
+			metrics.ReportRejectedHandshake(h.metricsReporters, rejectReasonHandshakeSize)
+			if err := a.SendHandshakeErrorResponse(); err != nil {
+				logger.Log.Errorf("Error sending handshake error response: %s", err.Error())
+			}
+
+			return fmt.Errorf("handshake data larger than %d bytes. Id=%d", max, a.GetSession().ID())
+		}
+
 		// Parse the json sent with the handshake by the client
 		handshakeData := &session.HandshakeData{}
 		if err := json.Unmarshal(p.Data, handshakeData); err != nil {
@@ -234,6 +355,8 @@ func (h *HandlerService) processPacket(a agent.Agent, p *packet.Packet) error {
 			return fmt.Errorf("invalid handshake data. Id=%d", a.GetSession().ID())
 		}
 
+		handshakeData.ClientIdentity = a.GetSession().GetClientIdentity()
+		handshakeData.ProxyMetadata, _ = a.GetSession().Get(constants.ProxyProtocolKey).(map[string]string)
 		if err := a.GetSession().ValidateHandshake(handshakeData); err != nil {
 			defer a.Close()
 			logger.Log.Errorf("Handshake validation failed: %s", err.Error())
@@ -245,13 +368,15 @@ func (h *HandlerService) processPacket(a agent.Agent, p *packet.Packet) error {
 			return fmt.Errorf("handshake validation failed: %w. SessionId=%d", err, a.GetSession().ID())
 		}
 
+		// the handshake data is set before the response, which is negotiated
+		// from the compression and ciphers advertised in it
+		a.GetSession().SetHandshakeData(handshakeData)
 		if err := a.SendHandshakeResponse(); err != nil {
 			logger.Log.Errorf("Error sending handshake response: %s", err.Error())
 			return err
 		}
 		logger.Log.Debugf("Session handshake Id=%d, Remote=%s", a.GetSession().ID(), a.RemoteAddr())
 
-		a.GetSession().SetHandshakeData(handshakeData)
 		a.SetStatus(constants.StatusHandshake)
 		err := a.GetSession().Set(constants.IPVersionKey, a.IPVersion())
 		if err != nil {
@@ -270,21 +395,64 @@ func (h *HandlerService) processPacket(a agent.Agent, p *packet.Packet) error {
 				a.RemoteAddr().String())
 		}
 
-		msg, err := message.Decode(p.Data)
+		msg, err := h.decodeMessage(a, p.Data)
 		if err != nil {
 			return err
 		}
+		if ok, err := state.limiter.allow(a, msg); !ok {
+			return err
+		}
 		h.processMessage(a, msg)
 
 	case packet.Heartbeat:
-		// expected
+		if ok, err := state.limiter.allow(a, nil); !ok {
+			return err
+		}
 	}
 
 	a.SetLastAt()
 	return nil
 }
 
+// decodeMessage decodes a message sent by the client of a, with the protocol
+// version, sequence numbers and compression negotiated in its handshake
+func (h *HandlerService) decodeMessage(a agent.Agent, data []byte) (*message.Message, error) {
+	s, ok := a.(agent.SequenceAgent)
+	sequenced := ok && s.HasSequence()
+	algorithm := ""
+	if c, ok := a.(agent.CompressionAgent); ok {
+		algorithm = c.GetCompression()
+	}
+	return message.DecodeWithCompression(data, h.dictionary, protocolVersion(a), sequenced, algorithm)
+}
+
+// protocolVersion returns the protocol version of the messages sent by the
+// client of a, which is the first one for agents that do not negotiate it
+func protocolVersion(a agent.Agent) int {
+	if v, ok := a.(agent.ProtocolVersionAgent); ok {
+		return v.GetProtocolVersion()
+	}
+	return message.ProtocolVersion1
+}
+
+// checkSequence returns an error if the session of a negotiated sequence
+// numbers and msg was replayed or has none
+func checkSequence(a agent.Agent, msg *message.Message) error {
+	if s, ok := a.(agent.SequenceAgent); ok {
+		return s.CheckSequence(msg.Seq)
+	}
+	return nil
+}
+
 func (h *HandlerService) processMessage(a agent.Agent, msg *message.Message) {
+	if err := checkSequence(a, msg); err != nil {
+		logger.Log.Warnf("Rejecting message to %s: %s. SessionId=%d", msg.Route, err.Error(), a.GetSession().ID())
+		if msg.Type == message.Request {
+			a.AnswerWithError(context.Background(), msg.ID, e.NewError(err, e.ErrBadRequestCode))
+		}
+		return
+	}
+
 	requestID := nuid.New().Next()
 	ctx := pcontext.AddToPropagateCtx(context.Background(), constants.StartTimeKey, time.Now().UnixNano())
 	ctx = pcontext.AddToPropagateCtx(ctx, constants.RouteKey, msg.Route)
@@ -336,7 +504,7 @@ func (h *HandlerService) localProcess(ctx context.Context, a agent.Agent, route
 		mid = 0
 	}
 
-	ret, err := h.handlerPool.ProcessHandlerMessage(ctx, route, h.serializer, h.handlerHooks, a.GetSession(), msg.Data, msg.Type, false)
+	ret, err := h.handlerPool.ProcessHandlerMessage(ctx, route, h.messageSerializer(a), h.handlerHooks, a.GetSession(), msg.Data, msg.Type, false)
 	if msg.Type != message.Notify {
 		if err != nil {
 			logger.Log.Errorf("Failed to process handler message: %s", err.Error())
@@ -354,6 +522,28 @@ func (h *HandlerService) localProcess(ctx context.Context, a agent.Agent, route
 	}
 }
 
+// Routes returns the routes of all the registered handlers, with the
+// server type
+func (h *HandlerService) Routes() []string {
+	handlers := h.handlerPool.GetHandlers()
+	routes := make([]string, 0, len(handlers))
+	for name := range handlers {
+		routes = append(routes, fmt.Sprintf("%s.%s", h.server.Type, name))
+	}
+	sort.Strings(routes)
+	return routes
+}
+
+// hasHandler returns true if a handler of this server handles route
+func (h *HandlerService) hasHandler(rt string) bool {
+	r, err := route.Decode(rt)
+	if err != nil || (r.SvType != "" && r.SvType != h.server.Type) {
+		return false
+	}
+	_, ok := h.handlerPool.GetHandlers()[r.Short()]
+	return ok
+}
+
 // DumpServices outputs all registered services
 func (h *HandlerService) DumpServices() {
 	handlers := h.handlerPool.GetHandlers()
@@ -21,12 +21,15 @@
 package service
 
 import (
+	"bytes"
 	"context"
 	encjson "encoding/json"
 	"errors"
 	"reflect"
+	"sort"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/google/uuid"
@@ -34,11 +37,13 @@ import (
 	agentmocks "github.com/topfreegames/pitaya/v2/agent/mocks"
 	"github.com/topfreegames/pitaya/v2/cluster"
 	"github.com/topfreegames/pitaya/v2/component"
+	"github.com/topfreegames/pitaya/v2/config"
 	"github.com/topfreegames/pitaya/v2/conn/codec"
 	"github.com/topfreegames/pitaya/v2/conn/message"
 	"github.com/topfreegames/pitaya/v2/conn/packet"
 	"github.com/topfreegames/pitaya/v2/constants"
 	pcontext "github.com/topfreegames/pitaya/v2/context"
+	e "github.com/topfreegames/pitaya/v2/errors"
 	"github.com/topfreegames/pitaya/v2/helpers"
 	"github.com/topfreegames/pitaya/v2/metrics"
 	metricsmocks "github.com/topfreegames/pitaya/v2/metrics/mocks"
@@ -46,10 +51,12 @@ import (
 	"github.com/topfreegames/pitaya/v2/pipeline"
 	"github.com/topfreegames/pitaya/v2/protos"
 	"github.com/topfreegames/pitaya/v2/route"
+	"github.com/topfreegames/pitaya/v2/serialize"
 	"github.com/topfreegames/pitaya/v2/serialize/json"
 	serializemocks "github.com/topfreegames/pitaya/v2/serialize/mocks"
 	"github.com/topfreegames/pitaya/v2/session"
 	"github.com/topfreegames/pitaya/v2/session/mocks"
+	"github.com/topfreegames/pitaya/v2/util/compression"
 )
 
 var (
@@ -139,6 +146,21 @@ func TestHandlerServiceRegister(t *testing.T) {
 	assert.NotNil(t, val2)
 }
 
+func TestHandlerServiceRoutes(t *testing.T) {
+	handlerPool := NewHandlerPool()
+	sv := &cluster.Server{Type: "connector"}
+	svc := NewHandlerService(nil, nil, 0, 0, sv, nil, nil, nil, nil, handlerPool)
+	assert.Empty(t, svc.Routes())
+
+	err := svc.Register(&MyComp{}, []component.Option{})
+	assert.NoError(t, err)
+	routes := svc.Routes()
+	assert.Len(t, routes, len(handlerPool.GetHandlers()))
+	assert.True(t, sort.StringsAreSorted(routes))
+	assert.Contains(t, routes, "connector.MyComp.Handler1")
+	assert.Contains(t, routes, "connector.MyComp.HandlerRawRaw")
+}
+
 func TestHandlerServiceRegisterFailsIfRegisterTwice(t *testing.T) {
 	handlerPool := NewHandlerPool()
 	svc := NewHandlerService(nil, nil, 0, 0, nil, nil, nil, nil, nil, handlerPool)
@@ -271,7 +293,9 @@ func TestHandlerServiceProcessPacketHandshake(t *testing.T) {
 			mockAgent.EXPECT().GetSession().Return(mockSession).Times(1)
 
 			if table.validator != nil {
-				mockAgent.EXPECT().GetSession().Return(mockSession).Times(1)
+				mockAgent.EXPECT().GetSession().Return(mockSession).Times(3)
+				mockSession.EXPECT().GetClientIdentity().Return(nil).Times(1)
+				mockSession.EXPECT().Get(constants.ProxyProtocolKey).Return(nil).Times(1)
 				mockSession.EXPECT().ValidateHandshake(gomock.Any()).DoAndReturn(func(data *session.HandshakeData) error {
 					return table.validator(data)
 				}).Times(1)
@@ -296,7 +320,7 @@ func TestHandlerServiceProcessPacketHandshake(t *testing.T) {
 
 			handlerPool := NewHandlerPool()
 			svc := NewHandlerService(nil, nil, 1, 1, nil, nil, nil, nil, pipeline.NewHandlerHooks(), handlerPool)
-			err := svc.processPacket(mockAgent, table.packet)
+			err := svc.processPacket(mockAgent, table.packet, &connState{})
 			if table.errStr == "" {
 				assert.Nil(t, err)
 			} else {
@@ -307,6 +331,70 @@ func TestHandlerServiceProcessPacketHandshake(t *testing.T) {
 	}
 }
 
+func TestHandlerServiceProcessPacketHandshakeClientIdentity(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	identity := &session.ClientIdentity{DNSNames: []string{"bot.example.com"}}
+	mockSession := mocks.NewMockSession(ctrl)
+	mockSession.EXPECT().GetClientIdentity().Return(identity)
+	mockSession.EXPECT().Get(constants.ProxyProtocolKey).Return(nil)
+	mockSession.EXPECT().ValidateHandshake(gomock.Any()).DoAndReturn(func(data *session.HandshakeData) error {
+		assert.Equal(t, identity, data.ClientIdentity)
+		return nil
+	})
+	mockSession.EXPECT().SetHandshakeData(gomock.Any()).Do(func(data *session.HandshakeData) {
+		assert.Equal(t, identity, data.ClientIdentity)
+	})
+	mockSession.EXPECT().Set(constants.IPVersionKey, constants.IPv4)
+	mockSession.EXPECT().ID().Return(int64(1))
+
+	mockAgent := agentmocks.NewMockAgent(ctrl)
+	mockAgent.EXPECT().GetSession().Return(mockSession).AnyTimes()
+	mockAgent.EXPECT().SendHandshakeResponse().Return(nil)
+	mockAgent.EXPECT().RemoteAddr().Return(&mockAddr{})
+	mockAgent.EXPECT().SetStatus(constants.StatusHandshake)
+	mockAgent.EXPECT().IPVersion().Return(constants.IPv4)
+	mockAgent.EXPECT().SetLastAt()
+
+	// a client must not be able to set its own identity
+	p := &packet.Packet{Type: packet.Handshake, Data: []byte(`{"sys":{"platform":"mac"},"ClientIdentity":{"DNSNames":["evil.com"]}}`)}
+	svc := NewHandlerService(nil, nil, 1, 1, nil, nil, nil, nil, pipeline.NewHandlerHooks(), NewHandlerPool())
+	assert.NoError(t, svc.processPacket(mockAgent, p, &connState{}))
+}
+
+func TestHandlerServiceProcessPacketHandshakeProxyMetadata(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	metadata := map[string]string{"authority": "game.example.com", "aws_vpce_id": "vpce-08d2bf15fac5001c9"}
+	mockSession := mocks.NewMockSession(ctrl)
+	mockSession.EXPECT().GetClientIdentity().Return(nil)
+	mockSession.EXPECT().Get(constants.ProxyProtocolKey).Return(metadata)
+	mockSession.EXPECT().ValidateHandshake(gomock.Any()).DoAndReturn(func(data *session.HandshakeData) error {
+		assert.Equal(t, metadata, data.ProxyMetadata)
+		return nil
+	})
+	mockSession.EXPECT().SetHandshakeData(gomock.Any()).Do(func(data *session.HandshakeData) {
+		assert.Equal(t, metadata, data.ProxyMetadata)
+	})
+	mockSession.EXPECT().Set(constants.IPVersionKey, constants.IPv4)
+	mockSession.EXPECT().ID().Return(int64(1))
+
+	mockAgent := agentmocks.NewMockAgent(ctrl)
+	mockAgent.EXPECT().GetSession().Return(mockSession).AnyTimes()
+	mockAgent.EXPECT().SendHandshakeResponse().Return(nil)
+	mockAgent.EXPECT().RemoteAddr().Return(&mockAddr{})
+	mockAgent.EXPECT().SetStatus(constants.StatusHandshake)
+	mockAgent.EXPECT().IPVersion().Return(constants.IPv4)
+	mockAgent.EXPECT().SetLastAt()
+
+	// a client must not be able to set the metadata sent by the proxy
+	p := &packet.Packet{Type: packet.Handshake, Data: []byte(`{"sys":{"platform":"mac"},"ProxyMetadata":{"authority":"evil.com"}}`)}
+	svc := NewHandlerService(nil, nil, 1, 1, nil, nil, nil, nil, pipeline.NewHandlerHooks(), NewHandlerPool())
+	assert.NoError(t, svc.processPacket(mockAgent, p, &connState{}))
+}
+
 func TestHandlerServiceProcessPacketHandshakeAck(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -323,7 +411,7 @@ func TestHandlerServiceProcessPacketHandshakeAck(t *testing.T) {
 	mockAgent.EXPECT().RemoteAddr().Return(&mockAddr{})
 	mockAgent.EXPECT().SetLastAt()
 
-	err := svc.processPacket(mockAgent, &packet.Packet{Type: packet.HandshakeAck})
+	err := svc.processPacket(mockAgent, &packet.Packet{Type: packet.HandshakeAck}, &connState{})
 	assert.NoError(t, err)
 }
 
@@ -337,7 +425,7 @@ func TestHandlerServiceProcessPacketHeartbeat(t *testing.T) {
 	handlerPool := NewHandlerPool()
 	svc := NewHandlerService(nil, nil, 1, 1, nil, nil, nil, nil, nil, handlerPool)
 
-	err := svc.processPacket(mockAgent, &packet.Packet{Type: packet.Heartbeat})
+	err := svc.processPacket(mockAgent, &packet.Packet{Type: packet.Heartbeat}, &connState{})
 	assert.NoError(t, err)
 }
 
@@ -381,7 +469,7 @@ func TestHandlerServiceProcessPacketData(t *testing.T) {
 
 			handlerPool := NewHandlerPool()
 			svc := NewHandlerService(nil, nil, 1, 1, &cluster.Server{}, nil, nil, nil, nil, handlerPool)
-			err := svc.processPacket(mockAgent, table.packet)
+			err := svc.processPacket(mockAgent, table.packet, &connState{})
 			if table.errStr != "" {
 				assert.Contains(t, err.Error(), table.errStr)
 			}
@@ -389,6 +477,290 @@ func TestHandlerServiceProcessPacketData(t *testing.T) {
 	}
 }
 
+func TestHandlerServiceProcessPacketHandshakeTooLarge(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSession := mocks.NewMockSession(ctrl)
+	mockSession.EXPECT().ID().Return(int64(1))
+	mockAgent := agentmocks.NewMockAgent(ctrl)
+	mockAgent.EXPECT().GetSession().Return(mockSession)
+	mockAgent.EXPECT().SendHandshakeErrorResponse()
+	mockAgent.EXPECT().Close()
+	mockReporter := metricsmocks.NewMockReporter(ctrl)
+	mockReporter.EXPECT().ReportCount(metrics.RejectedHandshakes, map[string]string{"reason": "size"}, float64(1))
+
+	svc := NewHandlerService(nil, nil, 1, 1, nil, nil, nil, []metrics.Reporter{mockReporter}, pipeline.NewHandlerHooks(), NewHandlerPool())
+	svc.SetHandshakeConfig(config.HandshakeConfig{MaxSize: 16})
+	p := &packet.Packet{Type: packet.Handshake, Data: []byte(`{"sys":{"platform":"mac"}}`)}
+	err := svc.processPacket(mockAgent, p, &connState{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "larger than 16 bytes")
+}
+
+func TestHandlerServiceProcessPacketMaxPacketsBeforeAck(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSession := mocks.NewMockSession(ctrl)
+	mockSession.EXPECT().ID().Return(int64(1))
+	mockAgent := agentmocks.NewMockAgent(ctrl)
+	mockAgent.EXPECT().GetSession().Return(mockSession)
+	mockAgent.EXPECT().GetStatus().Return(constants.StatusHandshake).Times(3)
+	mockAgent.EXPECT().SetLastAt().Times(2)
+	mockAgent.EXPECT().Close()
+	mockReporter := metricsmocks.NewMockReporter(ctrl)
+	mockReporter.EXPECT().ReportCount(metrics.RejectedHandshakes, map[string]string{"reason": "packets"}, float64(1))
+
+	svc := NewHandlerService(nil, nil, 1, 1, nil, nil, nil, []metrics.Reporter{mockReporter}, pipeline.NewHandlerHooks(), NewHandlerPool())
+	svc.SetHandshakeConfig(config.HandshakeConfig{MaxPacketsBeforeAck: 2})
+	state := &connState{}
+	heartbeat := &packet.Packet{Type: packet.Heartbeat}
+	assert.NoError(t, svc.processPacket(mockAgent, heartbeat, state))
+	assert.NoError(t, svc.processPacket(mockAgent, heartbeat, state))
+	err := svc.processPacket(mockAgent, heartbeat, state)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "more than 2 packets before handshake ack")
+
+	// packets after the ack are not counted
+	mockAgent.EXPECT().GetStatus().Return(constants.StatusWorking).Times(3)
+	mockAgent.EXPECT().SetLastAt().Times(3)
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, svc.processPacket(mockAgent, heartbeat, state))
+	}
+}
+
+func TestHandlerServiceHandleHandshakeTimeout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn := connmock.NewMockPlayerConn(ctrl)
+	mockAgent := agentmocks.NewMockAgent(ctrl)
+	mockAgentFactory := agentmocks.NewMockAgentFactory(ctrl)
+	mockAgentFactory.EXPECT().CreateAgent(mockConn).Return(mockAgent)
+	mockSession := mocks.NewMockSession(ctrl)
+	mockReporter := metricsmocks.NewMockReporter(ctrl)
+
+	closed := make(chan struct{})
+	mockAgent.EXPECT().Handle()
+	mockAgent.EXPECT().String().Return("")
+	mockAgent.EXPECT().GetSession().Return(mockSession).AnyTimes()
+	mockAgent.EXPECT().GetStatus().Return(constants.StatusStart)
+	mockAgent.EXPECT().Close().Do(func() { close(closed) })
+	mockConn.EXPECT().RemoteAddr().Return(&mockAddr{})
+	mockConn.EXPECT().GetNextMessage().DoAndReturn(func() ([]byte, error) {
+		<-closed
+		return nil, constants.ErrConnectionClosed
+	})
+	mockReporter.EXPECT().ReportCount(metrics.RejectedHandshakes, map[string]string{"reason": "timeout"}, float64(1))
+	mockSession.EXPECT().Close()
+	mockSession.EXPECT().ID().Return(int64(1))
+	mockSession.EXPECT().UID().Return("")
+
+	svc := NewHandlerService(nil, nil, 1, 1, nil, nil, mockAgentFactory, []metrics.Reporter{mockReporter}, pipeline.NewHandlerHooks(), NewHandlerPool())
+	svc.SetHandshakeConfig(config.HandshakeConfig{Timeout: 10 * time.Millisecond})
+	svc.Handle(mockConn)
+}
+
+type sizeLimitConn struct {
+	*connmock.MockPlayerConn
+	sizes []int
+}
+
+func (c *sizeLimitConn) SetMaxPacketSize(size int) {
+	c.sizes = append(c.sizes, size)
+}
+
+func TestHandlerServiceHandleLimitsPacketSizeBeforeHandshake(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	conn := &sizeLimitConn{MockPlayerConn: connmock.NewMockPlayerConn(ctrl)}
+	mockAgent := agentmocks.NewMockAgent(ctrl)
+	mockAgentFactory := agentmocks.NewMockAgentFactory(ctrl)
+	mockAgentFactory.EXPECT().CreateAgent(conn).Return(mockAgent)
+	mockSession := mocks.NewMockSession(ctrl)
+	mockReporter := metricsmocks.NewMockReporter(ctrl)
+
+	handled := make(chan struct{})
+	mockAgent.EXPECT().Handle().Do(func() { close(handled) })
+	mockAgent.EXPECT().String().Return("")
+	mockAgent.EXPECT().GetSession().Return(mockSession).AnyTimes()
+	conn.EXPECT().RemoteAddr().Return(&mockAddr{})
+	conn.EXPECT().GetNextMessage().Return(nil, codec.ErrPacketSizeExcced)
+	mockReporter.EXPECT().ReportCount(metrics.RejectedHandshakes, map[string]string{"reason": "size"}, float64(1))
+	mockSession.EXPECT().Close()
+	mockSession.EXPECT().ID().Return(int64(1))
+	mockSession.EXPECT().UID().Return("")
+
+	svc := NewHandlerService(nil, nil, 1, 1, nil, nil, mockAgentFactory, []metrics.Reporter{mockReporter}, pipeline.NewHandlerHooks(), NewHandlerPool())
+	svc.SetHandshakeConfig(config.HandshakeConfig{MaxSize: 16})
+	svc.Handle(conn)
+	assert.Equal(t, []int{16}, conn.sizes)
+	<-handled
+}
+
+func TestHandlerServiceProcessMessageReplayed(t *testing.T) {
+	tables := []struct {
+		name string
+		msg  *message.Message
+		err  error
+	}{
+		{"replayed_request", &message.Message{Type: message.Request, ID: 1, Route: "k.k", Seq: 1}, constants.ErrReplayedMessage},
+		{"replayed_notify", &message.Message{Type: message.Notify, Route: "k.k", Seq: 1}, constants.ErrReplayedMessage},
+		{"missing_sequence", &message.Message{Type: message.Request, ID: 2, Route: "k.k"}, constants.ErrMissingSequence},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			svc := NewHandlerService(nil, nil, 1, 1, &cluster.Server{}, nil, nil, nil, nil, NewHandlerPool())
+			mockSession := mocks.NewMockSession(ctrl)
+			mockSession.EXPECT().ID().Return(int64(1))
+			mockAgent := agentmocks.NewMockAgent(ctrl)
+			mockAgent.EXPECT().GetSession().Return(mockSession)
+			if table.msg.Type == message.Request {
+				mockAgent.EXPECT().AnswerWithError(gomock.Any(), table.msg.ID, e.NewError(table.err, e.ErrBadRequestCode))
+			}
+
+			a := &sequenceAgent{MockAgent: mockAgent, err: table.err}
+			svc.processMessage(a, table.msg)
+			assert.Equal(t, table.msg.Seq, a.seq)
+			assert.Len(t, svc.chLocalProcess, 0)
+		})
+	}
+}
+
+func TestHandlerServiceDecodeMessage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	svc := NewHandlerService(nil, nil, 1, 1, &cluster.Server{}, nil, nil, nil, nil, NewHandlerPool())
+	data, err := message.NewMessagesEncoder(false).Encode(&message.Message{Type: message.Notify, Route: "k.k", Seq: 3})
+	assert.NoError(t, err)
+
+	msg, err := svc.decodeMessage(&sequenceAgent{MockAgent: agentmocks.NewMockAgent(ctrl)}, data)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), msg.Seq)
+
+	// the sessions without sequence numbers keep the older message types
+	_, err = svc.decodeMessage(agentmocks.NewMockAgent(ctrl), data)
+	assert.Equal(t, message.ErrWrongMessageType, err)
+}
+
+func TestHandlerServiceDecodeMessageCompression(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	svc := NewHandlerService(nil, nil, 1, 1, &cluster.Server{}, nil, nil, nil, nil, NewHandlerPool())
+	messageEncoder := message.NewMessagesEncoder(true)
+	messageEncoder.Compressor, _ = compression.GetCompressor(compression.Snappy)
+	data, err := messageEncoder.Encode(&message.Message{Type: message.Notify, Route: "k.k", Data: bytes.Repeat([]byte("a"), 100)})
+	assert.NoError(t, err)
+
+	msg, err := svc.decodeMessage(&compressionAgent{MockAgent: agentmocks.NewMockAgent(ctrl), compression: compression.Snappy}, data)
+	assert.NoError(t, err)
+	assert.Equal(t, bytes.Repeat([]byte("a"), 100), msg.Data)
+
+	// the algorithms a session did not negotiate are rejected
+	_, err = svc.decodeMessage(&compressionAgent{MockAgent: agentmocks.NewMockAgent(ctrl), compression: compression.Zstd}, data)
+	assert.Equal(t, message.ErrCompressionNotNegotiated, err)
+	_, err = svc.decodeMessage(agentmocks.NewMockAgent(ctrl), data)
+	assert.Equal(t, message.ErrCompressionNotNegotiated, err)
+}
+
+type compressionAgent struct {
+	*agentmocks.MockAgent
+	compression string
+}
+
+func (a *compressionAgent) GetCompression() string {
+	return a.compression
+}
+
+type sequenceAgent struct {
+	*agentmocks.MockAgent
+	seq uint64
+	err error
+}
+
+func (a *sequenceAgent) HasSequence() bool {
+	return true
+}
+
+func (a *sequenceAgent) CheckSequence(seq uint64) error {
+	a.seq = seq
+	return a.err
+}
+
+func TestHandlerServicePacketDecoder(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	packetDecoder := codec.NewPomeloPacketDecoder()
+	svc := NewHandlerService(packetDecoder, nil, 1, 1, nil, nil, nil, nil, pipeline.NewHandlerHooks(), NewHandlerPool())
+	assert.Equal(t, packetDecoder, svc.packetDecoder(agentmocks.NewMockAgent(ctrl)))
+
+	agentDecoder := codec.NewLengthPrefixedPacketDecoder()
+	a := &decoderAgent{MockAgent: agentmocks.NewMockAgent(ctrl), decoder: agentDecoder}
+	assert.Equal(t, agentDecoder, svc.packetDecoder(a))
+	a.decoder = nil
+	assert.Equal(t, packetDecoder, svc.packetDecoder(a))
+}
+
+type decoderAgent struct {
+	*agentmocks.MockAgent
+	decoder codec.PacketDecoder
+}
+
+func (a *decoderAgent) GetPacketDecoder() codec.PacketDecoder {
+	return a.decoder
+}
+
+func TestHandlerServiceMessageSerializer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	serializer := serializemocks.NewMockSerializer(ctrl)
+	svc := NewHandlerService(nil, serializer, 1, 1, nil, nil, nil, nil, pipeline.NewHandlerHooks(), NewHandlerPool())
+	assert.Equal(t, serializer, svc.messageSerializer(agentmocks.NewMockAgent(ctrl)))
+
+	agentSerializer := serializemocks.NewMockSerializer(ctrl)
+	a := &serializerAgent{MockAgent: agentmocks.NewMockAgent(ctrl), serializer: agentSerializer}
+	assert.Equal(t, agentSerializer, svc.messageSerializer(a))
+	a.serializer = nil
+	assert.Equal(t, serializer, svc.messageSerializer(a))
+}
+
+type serializerAgent struct {
+	*agentmocks.MockAgent
+	serializer serialize.Serializer
+}
+
+func (a *serializerAgent) GetSerializer() serialize.Serializer {
+	return a.serializer
+}
+
+func TestHandlerServiceProtocolVersion(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	assert.Equal(t, message.ProtocolVersion1, protocolVersion(agentmocks.NewMockAgent(ctrl)))
+	a := &versionAgent{MockAgent: agentmocks.NewMockAgent(ctrl), version: message.ProtocolVersion2}
+	assert.Equal(t, message.ProtocolVersion2, protocolVersion(a))
+}
+
+type versionAgent struct {
+	*agentmocks.MockAgent
+	version int
+}
+
+func (a *versionAgent) GetProtocolVersion() int {
+	return a.version
+}
+
 func TestHandlerServiceHandle(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -420,6 +792,8 @@ func TestHandlerServiceHandle(t *testing.T) {
 	mockSession := mocks.NewMockSession(ctrl)
 	mockSession.EXPECT().SetHandshakeData(gomock.Any()).Times(1)
 	mockSession.EXPECT().ValidateHandshake(gomock.Any()).Times(1)
+	mockSession.EXPECT().GetClientIdentity().Return(nil).Times(1)
+	mockSession.EXPECT().Get(constants.ProxyProtocolKey).Return(nil).Times(1)
 	mockSession.EXPECT().UID().Return("uid").Times(1)
 	mockSession.EXPECT().ID().Return(int64(1)).Times(2)
 	mockSession.EXPECT().Set(constants.IPVersionKey, constants.IPv4)
@@ -427,7 +801,7 @@ func TestHandlerServiceHandle(t *testing.T) {
 
 	mockAgent.EXPECT().String().Return("")
 	mockAgent.EXPECT().SetStatus(constants.StatusHandshake)
-	mockAgent.EXPECT().GetSession().Return(mockSession).Times(7)
+	mockAgent.EXPECT().GetSession().Return(mockSession).Times(9)
 	mockAgent.EXPECT().IPVersion().Return(constants.IPv4)
 	mockAgent.EXPECT().RemoteAddr().Return(&mockAddr{}).AnyTimes()
 	mockAgent.EXPECT().SetLastAt().Do(func() {
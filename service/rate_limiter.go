@@ -0,0 +1,160 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/topfreegames/pitaya/v2/agent"
+	"github.com/topfreegames/pitaya/v2/config"
+	"github.com/topfreegames/pitaya/v2/conn/message"
+	"github.com/topfreegames/pitaya/v2/constants"
+	e "github.com/topfreegames/pitaya/v2/errors"
+	"github.com/topfreegames/pitaya/v2/logger"
+	"github.com/topfreegames/pitaya/v2/metrics"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// heartbeatRoute is the route reported in the metrics for heartbeats
+	heartbeatRoute = "heartbeat"
+	// unknownRoute is the route reported in the metrics for the messages
+	// to routes with no handler, which are chosen by the client
+	unknownRoute = "unknown"
+)
+
+// RouteRateLimiter limits the packets received from each client with a
+// token bucket (https://en.wikipedia.org/wiki/Token_bucket). The bucket
+// holds up to burst tokens and is refilled at rate tokens per second, each
+// message spends the cost configured for its route and each heartbeat
+// spends the heartbeat cost. Messages costing more than the burst are
+// never accepted.
+// Unlike acceptorwrapper.RateLimiter it runs after the packets are decoded,
+// so the client can be answered with an error or kicked according to the
+// configured action.
+type RouteRateLimiter struct {
+	reporters  []metrics.Reporter
+	config     config.RouteRateLimitingConfig
+	costs      map[string]int
+	hasHandler func(route string) bool
+}
+
+// NewRouteRateLimiter returns an instance of *RouteRateLimiter
+func NewRouteRateLimiter(reporters []metrics.Reporter, c config.RouteRateLimitingConfig) *RouteRateLimiter {
+	costs := make(map[string]int, len(c.Costs))
+	for _, routeCost := range c.Costs {
+		costs[routeCost.Route] = routeCost.Cost
+	}
+
+	return &RouteRateLimiter{
+		reporters: reporters,
+		config:    c,
+		costs:     costs,
+	}
+}
+
+// cost returns the tokens spent by a message to route
+func (r *RouteRateLimiter) cost(route string) int {
+	if cost, ok := r.costs[route]; ok {
+		return cost
+	}
+	return r.config.DefaultCost
+}
+
+// metricRoute returns the route reported in the metrics for a message to
+// route, which is only reported as is if it has a handler or a cost
+// configured, so clients can't create new metric labels
+func (r *RouteRateLimiter) metricRoute(route string) string {
+	if _, ok := r.costs[route]; ok {
+		return route
+	}
+	if r.hasHandler != nil && r.hasHandler(route) {
+		return route
+	}
+	return unknownRoute
+}
+
+// newConnRateLimiter returns the bucket of a new client, or nil if r is nil
+func (r *RouteRateLimiter) newConnRateLimiter() *connRateLimiter {
+	if r == nil {
+		return nil
+	}
+	return &connRateLimiter{
+		RouteRateLimiter: r,
+		bucket:           rate.NewLimiter(rate.Limit(r.config.Rate), r.config.Burst),
+	}
+}
+
+// connRateLimiter is the bucket of a single client, it is only used by the
+// goroutine reading from the client connection
+type connRateLimiter struct {
+	*RouteRateLimiter
+	bucket     *rate.Limiter
+	violations int
+}
+
+// allow spends the tokens of msg, or of a heartbeat if msg is nil, and
+// returns whether it must be processed. When the limit is exceeded the
+// configured action is taken, and an error is returned if the client was
+// kicked. A nil limiter allows everything
+func (l *connRateLimiter) allow(a agent.Agent, msg *message.Message) (bool, error) {
+	if l == nil {
+		return true, nil
+	}
+
+	route, cost := heartbeatRoute, l.config.HeartbeatCost
+	if msg != nil {
+		route, cost = msg.Route, l.cost(msg.Route)
+	}
+	if l.bucket.AllowN(time.Now(), cost) {
+		return true, nil
+	}
+
+	l.violations++
+	action := l.config.Action
+	switch {
+	case action == config.RouteRateLimitingActionError && (msg == nil || msg.Type != message.Request):
+		// only requests can be answered
+		action = config.RouteRateLimitingActionDrop
+	case action == config.RouteRateLimitingActionKick && l.violations < l.config.KickAfter:
+		action = config.RouteRateLimitingActionDrop
+	}
+	metricRoute := route
+	if msg != nil {
+		metricRoute = l.metricRoute(route)
+	}
+	metrics.ReportExceededRouteRateLimiting(l.reporters, metricRoute, action)
+
+	switch action {
+	case config.RouteRateLimitingActionError:
+		a.AnswerWithError(context.Background(), msg.ID, e.NewError(constants.ErrRateLimitExceeded, e.ErrTooManyRequestsCode))
+	case config.RouteRateLimitingActionKick:
+		if err := a.Kick(context.Background()); err != nil {
+			logger.Log.Errorf("Failed to kick rate limited client: %s", err.Error())
+		}
+		return false, fmt.Errorf("%w: client kicked after %d violations. SessionId=%d", constants.ErrRateLimitExceeded, l.violations, a.GetSession().ID())
+	default:
+		logger.Log.Debugf("Dropping message to %s, SessionId=%d, Error=%s", route, a.GetSession().ID(), constants.ErrRateLimitExceeded)
+	}
+	return false, nil
+}
@@ -0,0 +1,192 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	agentmocks "github.com/topfreegames/pitaya/v2/agent/mocks"
+	"github.com/topfreegames/pitaya/v2/cluster"
+	"github.com/topfreegames/pitaya/v2/component"
+	"github.com/topfreegames/pitaya/v2/config"
+	"github.com/topfreegames/pitaya/v2/conn/message"
+	"github.com/topfreegames/pitaya/v2/conn/packet"
+	"github.com/topfreegames/pitaya/v2/constants"
+	e "github.com/topfreegames/pitaya/v2/errors"
+	"github.com/topfreegames/pitaya/v2/metrics"
+	metricsmocks "github.com/topfreegames/pitaya/v2/metrics/mocks"
+	"github.com/topfreegames/pitaya/v2/session/mocks"
+)
+
+// newTestRouteRateLimitingConfig returns a config whose bucket is never
+// refilled during the tests
+func newTestRouteRateLimitingConfig(action string) config.RouteRateLimitingConfig {
+	c := config.NewDefaultRouteRateLimitingConfig()
+	c.Enabled = true
+	c.Rate = 0.0001
+	c.Burst = 3
+	c.Action = action
+	c.KickAfter = 2
+	c.Costs = []config.RouteCost{{Route: "room.room.join", Cost: 2}}
+	return *c
+}
+
+func TestNewRouteRateLimiter(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteRateLimiter(nil, newTestRouteRateLimitingConfig(config.RouteRateLimitingActionDrop))
+	assert.Equal(t, map[string]int{"room.room.join": 2}, r.costs)
+	assert.Equal(t, 2, r.cost("room.room.join"))
+	assert.Equal(t, 1, r.cost("room.room.leave"))
+	assert.NotNil(t, r.newConnRateLimiter())
+}
+
+func TestRouteRateLimiterMetricRoute(t *testing.T) {
+	handlerPool := NewHandlerPool()
+	svc := NewHandlerService(nil, nil, 0, 0, &cluster.Server{Type: "connector"}, nil, nil, nil, nil, handlerPool)
+	assert.NoError(t, svc.Register(&MyComp{}, []component.Option{}))
+
+	r := NewRouteRateLimiter(nil, newTestRouteRateLimitingConfig(config.RouteRateLimitingActionDrop))
+	assert.Equal(t, unknownRoute, r.metricRoute("connector.MyComp.Handler1"))
+	svc.SetRouteRateLimiter(r)
+
+	tables := []struct {
+		route  string
+		metric string
+	}{
+		{"connector.MyComp.Handler1", "connector.MyComp.Handler1"},
+		{"MyComp.Handler1", "MyComp.Handler1"},
+		{"room.room.join", "room.room.join"},
+		{"connector.MyComp.Missing", unknownRoute},
+		{"game.MyComp.Handler1", unknownRoute},
+		{"invalid", unknownRoute},
+	}
+	for _, table := range tables {
+		t.Run(table.route, func(t *testing.T) {
+			assert.Equal(t, table.metric, r.metricRoute(table.route))
+		})
+	}
+}
+
+func TestConnRateLimiterNil(t *testing.T) {
+	t.Parallel()
+
+	var r *RouteRateLimiter
+	limiter := r.newConnRateLimiter()
+	assert.Nil(t, limiter)
+
+	ok, err := limiter.allow(nil, &message.Message{Route: "room.room.join"})
+	assert.True(t, ok)
+	assert.NoError(t, err)
+}
+
+func TestConnRateLimiterAllow(t *testing.T) {
+	t.Parallel()
+
+	join := &message.Message{Type: message.Request, ID: 1, Route: "room.room.join"}
+	notify := &message.Message{Type: message.Notify, Route: "room.room.join"}
+	tables := []struct {
+		name    string
+		action  string
+		msgs    []*message.Message
+		allowed []bool
+		mock    func(mockAgent *agentmocks.MockAgent, mockReporter *metricsmocks.MockReporter)
+		err     bool
+	}{
+		{"heartbeats_are_free", config.RouteRateLimitingActionDrop, []*message.Message{nil, nil, nil, nil}, []bool{true, true, true, true}, nil, false},
+		{"drop", config.RouteRateLimitingActionDrop, []*message.Message{join, join}, []bool{true, false}, func(mockAgent *agentmocks.MockAgent, mockReporter *metricsmocks.MockReporter) {
+			mockReporter.EXPECT().ReportCount(metrics.ExceededRouteRateLimiting, map[string]string{"route": "room.room.join", "action": "drop"}, float64(1))
+		}, false},
+		{"error", config.RouteRateLimitingActionError, []*message.Message{join, join}, []bool{true, false}, func(mockAgent *agentmocks.MockAgent, mockReporter *metricsmocks.MockReporter) {
+			mockReporter.EXPECT().ReportCount(metrics.ExceededRouteRateLimiting, map[string]string{"route": "room.room.join", "action": "error"}, float64(1))
+			mockAgent.EXPECT().AnswerWithError(gomock.Any(), uint(1), gomock.Any()).Do(func(_ interface{}, _ uint, err error) {
+				assert.Equal(t, e.ErrTooManyRequestsCode, err.(*e.Error).Code)
+			})
+		}, false},
+		{"error_on_notify_drops", config.RouteRateLimitingActionError, []*message.Message{join, notify}, []bool{true, false}, func(mockAgent *agentmocks.MockAgent, mockReporter *metricsmocks.MockReporter) {
+			mockReporter.EXPECT().ReportCount(metrics.ExceededRouteRateLimiting, map[string]string{"route": "room.room.join", "action": "drop"}, float64(1))
+		}, false},
+		{"kick_after_violations", config.RouteRateLimitingActionKick, []*message.Message{join, join, join}, []bool{true, false, false}, func(mockAgent *agentmocks.MockAgent, mockReporter *metricsmocks.MockReporter) {
+			mockReporter.EXPECT().ReportCount(metrics.ExceededRouteRateLimiting, map[string]string{"route": "room.room.join", "action": "drop"}, float64(1))
+			mockReporter.EXPECT().ReportCount(metrics.ExceededRouteRateLimiting, map[string]string{"route": "room.room.join", "action": "kick"}, float64(1))
+			mockAgent.EXPECT().Kick(gomock.Any()).Return(errors.New("closed"))
+		}, true},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockSession := mocks.NewMockSession(ctrl)
+			mockSession.EXPECT().ID().Return(int64(1)).AnyTimes()
+			mockAgent := agentmocks.NewMockAgent(ctrl)
+			mockAgent.EXPECT().GetSession().Return(mockSession).AnyTimes()
+			mockReporter := metricsmocks.NewMockReporter(ctrl)
+			if table.mock != nil {
+				table.mock(mockAgent, mockReporter)
+			}
+
+			limiter := NewRouteRateLimiter([]metrics.Reporter{mockReporter}, newTestRouteRateLimitingConfig(table.action)).newConnRateLimiter()
+			var err error
+			for i, msg := range table.msgs {
+				var ok bool
+				ok, err = limiter.allow(mockAgent, msg)
+				assert.Equal(t, table.allowed[i], ok)
+			}
+			if table.err {
+				assert.ErrorIs(t, err, constants.ErrRateLimitExceeded)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestHandlerServiceProcessPacketRateLimited(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	msg := &message.Message{Type: message.Request, ID: 1, Route: "room.room.join"}
+	encodedMsg, err := message.NewMessagesEncoder(false).Encode(msg)
+	assert.NoError(t, err)
+
+	c := newTestRouteRateLimitingConfig(config.RouteRateLimitingActionDrop)
+	c.Burst = 1
+	c.HeartbeatCost = 1
+	limiter := NewRouteRateLimiter(nil, c).newConnRateLimiter()
+
+	mockSession := mocks.NewMockSession(ctrl)
+	mockSession.EXPECT().ID().Return(int64(1)).AnyTimes()
+	mockAgent := agentmocks.NewMockAgent(ctrl)
+	mockAgent.EXPECT().GetSession().Return(mockSession).AnyTimes()
+	mockAgent.EXPECT().GetStatus().Return(constants.StatusWorking)
+	// only the heartbeat is processed, the message is dropped before
+	// reaching processMessage
+	mockAgent.EXPECT().SetLastAt().Times(1)
+
+	svc := NewHandlerService(nil, nil, 1, 1, nil, nil, nil, nil, nil, NewHandlerPool())
+	assert.NoError(t, svc.processPacket(mockAgent, &packet.Packet{Type: packet.Heartbeat}, &connState{limiter: limiter}))
+	assert.NoError(t, svc.processPacket(mockAgent, &packet.Packet{Type: packet.Data, Data: encodedMsg}, &connState{limiter: limiter}))
+}
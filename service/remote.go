@@ -22,6 +22,7 @@ package service
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
@@ -55,6 +56,7 @@ type RemoteService struct {
 	rpcServer              cluster.RPCServer
 	serviceDiscovery       cluster.ServiceDiscovery
 	serializer             serialize.Serializer
+	serializers            []serialize.Serializer // serializers the clients can negotiate besides the default one
 	encoder                codec.PacketEncoder
 	rpcClient              cluster.RPCClient
 	services               map[string]*component.Service // all registered service
@@ -105,6 +107,32 @@ func NewRemoteService(
 	return remote
 }
 
+// SetSerializers sets the serializers the clients can negotiate with the
+// frontend servers besides the default one, so that the requests they route
+// to this server are handled with the serializer of their session
+func (r *RemoteService) SetSerializers(serializers []serialize.Serializer) {
+	r.serializers = serializers
+}
+
+// sessionSerializer returns the serializer negotiated by the frontend server
+// with the client of sess, which is the default one when there is none
+func (r *RemoteService) sessionSerializer(sess *protos.Session) serialize.Serializer {
+	if len(r.serializers) == 0 || len(sess.GetData()) == 0 {
+		return r.serializer
+	}
+	data := map[string]interface{}{}
+	if err := json.Unmarshal(sess.GetData(), &data); err != nil {
+		return r.serializer
+	}
+	name, _ := data[constants.SerializerKey].(string)
+	for _, serializer := range r.serializers {
+		if serializer.GetName() == name {
+			return serializer
+		}
+	}
+	return r.serializer
+}
+
 func (r *RemoteService) remoteProcess(
 	ctx context.Context,
 	server *cluster.Server,
@@ -203,7 +231,11 @@ func (r *RemoteService) PushToUser(ctx context.Context, push *protos.Push) (*pro
 	logger.Log.Debugf("sending push to user %s: %v", push.GetUid(), string(push.Data))
 	s := r.sessionPool.GetSessionByUID(push.GetUid())
 	if s != nil {
-		err := s.Push(push.Route, push.Data)
+		data, err := r.pushData(s, push.Data)
+		if err != nil {
+			return nil, err
+		}
+		err = s.Push(push.Route, data)
 		if err != nil {
 			return nil, err
 		}
@@ -214,6 +246,19 @@ func (r *RemoteService) PushToUser(ctx context.Context, push *protos.Push) (*pro
 	return nil, constants.ErrSessionNotFound
 }
 
+// pushData returns the data of a push sent by another server, which is
+// serialized with the default serializer, as a value the agent serializes
+// again when the session negotiated another serializer in the handshake
+func (r *RemoteService) pushData(s session.Session, data []byte) (interface{}, error) {
+	if len(r.serializers) == 0 || len(data) == 0 {
+		return data, nil
+	}
+	if name := s.String(constants.SerializerKey); name == "" || name == r.serializer.GetName() {
+		return data, nil
+	}
+	return util.UnmarshalValue(r.serializer, data)
+}
+
 // KickUser sends a kick to user
 func (r *RemoteService) KickUser(ctx context.Context, kick *protos.KickMsg) (*protos.KickAnswer, error) {
 	logger.Log.Debugf("sending kick to user %s", kick.GetUserId())
@@ -434,13 +479,14 @@ func (r *RemoteService) handleRPCUser(ctx context.Context, req *protos.Request,
 func (r *RemoteService) handleRPCSys(ctx context.Context, req *protos.Request, rt *route.Route) *protos.Response {
 	reply := req.GetMsg().GetReply()
 	response := &protos.Response{}
+	serializer := r.sessionSerializer(req.GetSession())
 	// (warning) a new agent is created for every new request
 	a, err := agent.NewRemote(
 		req.GetSession(),
 		reply,
 		r.rpcClient,
 		r.encoder,
-		r.serializer,
+		serializer,
 		r.serviceDiscovery,
 		req.FrontendID,
 		r.messageEncoder,
@@ -457,7 +503,7 @@ func (r *RemoteService) handleRPCSys(ctx context.Context, req *protos.Request, r
 		return response
 	}
 
-	ret, err := r.handlerPool.ProcessHandlerMessage(ctx, rt, r.serializer, r.handlerHooks, a.Session, req.GetMsg().GetData(), req.GetMsg().GetType(), true)
+	ret, err := r.handlerPool.ProcessHandlerMessage(ctx, rt, serializer, r.handlerHooks, a.Session, req.GetMsg().GetData(), req.GetMsg().GetType(), true)
 	if err != nil {
 		logger.Log.Warnf(err.Error())
 		response = &protos.Response{
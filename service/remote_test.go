@@ -46,6 +46,8 @@ import (
 	"github.com/topfreegames/pitaya/v2/protos/test"
 	"github.com/topfreegames/pitaya/v2/route"
 	"github.com/topfreegames/pitaya/v2/router"
+	"github.com/topfreegames/pitaya/v2/serialize"
+	"github.com/topfreegames/pitaya/v2/serialize/json"
 	serializemocks "github.com/topfreegames/pitaya/v2/serialize/mocks"
 	"github.com/topfreegames/pitaya/v2/session"
 	sessionmocks "github.com/topfreegames/pitaya/v2/session/mocks"
@@ -208,6 +210,40 @@ func TestRemoteServicePushToUser(t *testing.T) {
 	}
 }
 
+func TestRemoteServicePushToUserWithNegotiatedSerializer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	otherSerializer := serializemocks.NewMockSerializer(ctrl)
+	otherSerializer.EXPECT().GetName().Return("msgpack").AnyTimes()
+
+	tables := []struct {
+		name       string
+		serializer string
+		data       interface{}
+	}{
+		{"default_serializer", "json", []byte(`{"id":9007199254740993,"ratio":0.5}`)},
+		{"no_serializer", "", []byte(`{"id":9007199254740993,"ratio":0.5}`)},
+		{"other_serializer", "msgpack", map[string]interface{}{"id": int64(9007199254740993), "ratio": 0.5}},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			push := &protos.Push{Route: "sv.svc.mth", Uid: "uid1", Data: []byte(`{"id":9007199254740993,"ratio":0.5}`)}
+			mockSession := sessionmocks.NewMockSession(ctrl)
+			mockSession.EXPECT().String(constants.SerializerKey).Return(table.serializer)
+			mockSession.EXPECT().Push(push.Route, table.data)
+			mockSessionPool := sessionmocks.NewMockSessionPool(ctrl)
+			mockSessionPool.EXPECT().GetSessionByUID(push.Uid).Return(mockSession)
+
+			svc := NewRemoteService(nil, nil, nil, nil, json.NewSerializer(), nil, nil, nil, mockSessionPool, nil, nil, nil)
+			svc.SetSerializers([]serialize.Serializer{otherSerializer})
+			_, err := svc.PushToUser(context.Background(), push)
+			assert.NoError(t, err)
+		})
+	}
+}
+
 func TestRemoteServiceKickUser(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	mockSessionPool := sessionmocks.NewMockSessionPool(ctrl)
@@ -590,6 +626,25 @@ func TestRemoteServiceHandleRPCSys(t *testing.T) {
 	}
 }
 
+func TestRemoteServiceSessionSerializer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	defaultSerializer := serializemocks.NewMockSerializer(ctrl)
+	otherSerializer := serializemocks.NewMockSerializer(ctrl)
+	otherSerializer.EXPECT().GetName().Return("msgpack").AnyTimes()
+
+	svc := NewRemoteService(nil, nil, nil, nil, defaultSerializer, nil, nil, nil, nil, nil, nil, nil)
+	negotiated := &protos.Session{Data: []byte(`{"pitaya.serializer":"msgpack"}`)}
+	assert.Equal(t, defaultSerializer, svc.sessionSerializer(negotiated))
+
+	svc.SetSerializers([]serialize.Serializer{otherSerializer})
+	assert.Equal(t, otherSerializer, svc.sessionSerializer(negotiated))
+	assert.Equal(t, defaultSerializer, svc.sessionSerializer(&protos.Session{}))
+	assert.Equal(t, defaultSerializer, svc.sessionSerializer(&protos.Session{Data: []byte(`{"pitaya.serializer":"protobuf"}`)}))
+	assert.Equal(t, defaultSerializer, svc.sessionSerializer(&protos.Session{Data: []byte("{no")}))
+}
+
 func TestRemoteServiceRemoteProcess(t *testing.T) {
 	sv := &cluster.Server{}
 	rt := route.NewRoute("sv", "svc", "method")
@@ -118,6 +118,20 @@ func (mr *MockSessionMockRecorder) Get(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockSession)(nil).Get), arg0)
 }
 
+// GetClientIdentity mocks base method.
+func (m *MockSession) GetClientIdentity() *session.ClientIdentity {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetClientIdentity")
+	ret0, _ := ret[0].(*session.ClientIdentity)
+	return ret0
+}
+
+// GetClientIdentity indicates an expected call of GetClientIdentity.
+func (mr *MockSessionMockRecorder) GetClientIdentity() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetClientIdentity", reflect.TypeOf((*MockSession)(nil).GetClientIdentity))
+}
+
 // GetData mocks base method.
 func (m *MockSession) GetData() map[string]interface{} {
 	m.ctrl.T.Helper()
@@ -459,6 +473,18 @@ func (mr *MockSessionMockRecorder) Set(arg0, arg1 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Set", reflect.TypeOf((*MockSession)(nil).Set), arg0, arg1)
 }
 
+// SetClientIdentity mocks base method.
+func (m *MockSession) SetClientIdentity(arg0 *session.ClientIdentity) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetClientIdentity", arg0)
+}
+
+// SetClientIdentity indicates an expected call of SetClientIdentity.
+func (mr *MockSessionMockRecorder) SetClientIdentity(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetClientIdentity", reflect.TypeOf((*MockSession)(nil).SetClientIdentity), arg0)
+}
+
 // SetData mocks base method.
 func (m *MockSession) SetData(arg0 map[string]interface{}) error {
 	m.ctrl.T.Helper()
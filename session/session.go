@@ -22,9 +22,12 @@ package session
 
 import (
 	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
 	"fmt"
 	"net"
+	"net/url"
 	"reflect"
 	"sync"
 	"sync/atomic"
@@ -72,6 +75,35 @@ type HandshakeClientData struct {
 	LibVersion  string `json:"libVersion"`
 	BuildNumber string `json:"clientBuildNumber"`
 	Version     string `json:"clientVersion"`
+	// Compression has the compression algorithms supported by the client,
+	// one of them is picked by the server for the messages of the session
+	Compression []string `json:"compression,omitempty"`
+	// CompressionDictionaries has the IDs of the zstd dictionaries the
+	// client has, the latest one known by the server is used with zstd
+	CompressionDictionaries []uint32 `json:"compressionDictionaries,omitempty"`
+	// DictHash is the hash of the route dictionary cached by the client,
+	// the server does not send the dictionary again when it has not changed
+	DictHash string `json:"dictHash,omitempty"`
+	// Encryption has the ciphers supported by the client, one of them is
+	// picked by the server to seal the data packets of the session
+	Encryption []string `json:"encryption,omitempty"`
+	// PublicKey is the X25519 public key of the client, which is sent
+	// along with Encryption
+	PublicKey []byte `json:"publicKey,omitempty"`
+	// Sequence tells whether the client can stamp its messages with
+	// sequence numbers, which the server uses to reject replayed messages
+	Sequence bool `json:"sequence,omitempty"`
+	// MinProtocolVersion and MaxProtocolVersion are the range of protocol
+	// versions supported by the client, the server picks the highest one
+	// it also supports. Clients sending none use the first version
+	MinProtocolVersion int `json:"minProtocolVersion,omitempty"`
+	MaxProtocolVersion int `json:"maxProtocolVersion,omitempty"`
+	// Serializer is the serializer requested by the client, the server
+	// keeps its default one when it does not support it
+	Serializer string `json:"serializer,omitempty"`
+	// PacketCodec is the packet codec requested by the client for the
+	// packets after the handshake, which is always in the pomelo codec
+	PacketCodec string `json:"packetCodec,omitempty"`
 }
 
 // HandshakeData represents information about the handshake sent by the client.
@@ -80,6 +112,35 @@ type HandshakeClientData struct {
 type HandshakeData struct {
 	Sys  HandshakeClientData    `json:"sys"`
 	User map[string]interface{} `json:"user,omitempty"`
+	// ClientIdentity is filled by the server when the client presented a
+	// verified TLS certificate, it is never read from the client json
+	ClientIdentity *ClientIdentity `json:"-"`
+	// ProxyMetadata is filled by the server with the TLVs sent by the load
+	// balancer in the PROXY protocol header, it is never read from the client json
+	ProxyMetadata map[string]string `json:"-"`
+}
+
+// ClientIdentity represents a client authenticated with a TLS certificate
+// verified by the acceptor.
+type ClientIdentity struct {
+	Subject        pkix.Name
+	DNSNames       []string
+	EmailAddresses []string
+	IPAddresses    []net.IP
+	URIs           []*url.URL
+	Certificate    *x509.Certificate
+}
+
+// NewClientIdentity returns the identity of the client that presented cert
+func NewClientIdentity(cert *x509.Certificate) *ClientIdentity {
+	return &ClientIdentity{
+		Subject:        cert.Subject,
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+		IPAddresses:    cert.IPAddresses,
+		URIs:           cert.URIs,
+		Certificate:    cert,
+	}
 }
 
 type sessionImpl struct {
@@ -91,6 +152,7 @@ type sessionImpl struct {
 	data                map[string]interface{}                // session data store
 	handshakeData       *HandshakeData                        // handshake data received by the client
 	handshakeValidators map[string]func(*HandshakeData) error // validations to run on handshake
+	clientIdentity      *ClientIdentity                       // identity of the client verified by tls
 	encodedData         []byte                                // session data encoded as a byte array
 	OnCloseCallbacks    []func()                              //onClose callbacks
 	IsFrontend          bool                                  // if session is a frontend session
@@ -159,6 +221,8 @@ type Session interface {
 	GetHandshakeData() *HandshakeData
 	ValidateHandshake(data *HandshakeData) error
 	GetHandshakeValidators() map[string]func(data *HandshakeData) error
+	SetClientIdentity(identity *ClientIdentity)
+	GetClientIdentity() *ClientIdentity
 }
 
 type sessionIDService struct {
@@ -819,6 +883,23 @@ func (s *sessionImpl) GetHandshakeValidators() map[string]func(data *HandshakeDa
 	return s.handshakeValidators
 }
 
+// SetClientIdentity sets the identity of the client verified by tls.
+func (s *sessionImpl) SetClientIdentity(identity *ClientIdentity) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.clientIdentity = identity
+}
+
+// GetClientIdentity gets the identity of the client verified by tls, it is
+// nil if the client did not present a certificate.
+func (s *sessionImpl) GetClientIdentity() *ClientIdentity {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.clientIdentity
+}
+
 func (s *sessionImpl) ValidateHandshake(data *HandshakeData) error {
 	for name, fun := range s.handshakeValidators {
 		if err := fun(data); err != nil {
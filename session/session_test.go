@@ -22,11 +22,15 @@ package session
 
 import (
 	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"math/rand"
+	"net"
+	"net/url"
 	"path/filepath"
 	"testing"
 	"time"
@@ -1407,6 +1411,34 @@ func TestSessionGetHandshakeData(t *testing.T) {
 	}
 }
 
+func TestSessionClientIdentity(t *testing.T) {
+	t.Parallel()
+
+	uri, err := url.Parse("spiffe://example.com/bot")
+	assert.NoError(t, err)
+	cert := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "bot", Organization: []string{"partner"}},
+		DNSNames:       []string{"bot.example.com"},
+		EmailAddresses: []string{"bot@example.com"},
+		IPAddresses:    []net.IP{net.ParseIP("10.0.0.1")},
+		URIs:           []*url.URL{uri},
+	}
+
+	sessionPool := NewSessionPool()
+	ss := sessionPool.NewSession(nil, true)
+	assert.Nil(t, ss.GetClientIdentity())
+
+	ss.SetClientIdentity(NewClientIdentity(cert))
+	identity := ss.GetClientIdentity()
+	assert.Equal(t, "bot", identity.Subject.CommonName)
+	assert.Equal(t, []string{"partner"}, identity.Subject.Organization)
+	assert.Equal(t, cert.DNSNames, identity.DNSNames)
+	assert.Equal(t, cert.EmailAddresses, identity.EmailAddresses)
+	assert.Equal(t, cert.IPAddresses, identity.IPAddresses)
+	assert.Equal(t, cert.URIs, identity.URIs)
+	assert.Equal(t, cert, identity.Certificate)
+}
+
 func TestSessionSetHandshakeData(t *testing.T) {
 	t.Parallel()
 
@@ -110,6 +110,10 @@ func SetDictionary(dict map[string]uint16) error {
 	return DefaultApp.SetDictionary(dict)
 }
 
+func AddPushRoutes(routes ...string) error {
+	return DefaultApp.AddPushRoutes(routes...)
+}
+
 func AddRoute(serverType string, routingFunction router.RoutingFunc) error {
 	return DefaultApp.AddRoute(serverType, routingFunction)
 }
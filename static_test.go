@@ -219,6 +219,16 @@ func TestStaticSetDictionary(t *testing.T) {
 	SetDictionary(expected)
 }
 
+func TestStaticAddPushRoutes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	app := mocks.NewMockPitaya(ctrl)
+	app.EXPECT().AddPushRoutes("onChat", "onJoin").Return(nil)
+
+	DefaultApp = app
+	AddPushRoutes("onChat", "onJoin")
+}
+
 func TestStaticAddRoute(t *testing.T) {
 	tables := []struct {
 		name       string
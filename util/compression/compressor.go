@@ -0,0 +1,194 @@
+package compression
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Names of the compression algorithms, which are negotiated with the clients
+const (
+	Deflate = "deflate"
+	Zstd    = "zstd"
+	Snappy  = "snappy"
+)
+
+// MaxDecompressedSize is the largest data decompressed by DecompressLimited,
+// the same as the largest pomelo packet, so that a small compressed message
+// can't make the server allocate a lot of memory
+const MaxDecompressedSize = 1 << 24
+
+// Errors of the compressors
+var (
+	ErrUnknownCompressor        = errors.New("unknown compression algorithm")
+	ErrDecompressedSizeExceeded = errors.New("decompressed data is larger than the limit")
+)
+
+// Compressor compresses and decompresses the data of messages
+type Compressor interface {
+	GetName() string
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+// limitedDecompressor is implemented by the compressors that stop
+// decompressing the data once it is larger than MaxDecompressedSize
+type limitedDecompressor interface {
+	decompressLimited(data []byte) ([]byte, error)
+}
+
+// DecompressLimited decompresses data with compressor, failing with
+// ErrDecompressedSizeExceeded if it is larger than MaxDecompressedSize. It is
+// meant for the data sent by untrusted peers, such as the clients
+func DecompressLimited(compressor Compressor, data []byte) ([]byte, error) {
+	if c, ok := compressor.(limitedDecompressor); ok {
+		return c.decompressLimited(data)
+	}
+	decompressed, err := compressor.Decompress(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(decompressed) > MaxDecompressedSize {
+		return nil, ErrDecompressedSizeExceeded
+	}
+	return decompressed, nil
+}
+
+// Algorithms returns the names of the compression algorithms supported,
+// from the one with the best compression ratio to the fastest one
+func Algorithms() []string {
+	return []string{Zstd, Snappy, Deflate}
+}
+
+// GetCompressor returns the compressor of the algorithm with name
+func GetCompressor(name string) (Compressor, error) {
+	switch name {
+	case Deflate:
+		return deflateCompressor, nil
+	case Zstd:
+		return zstdCompressor, nil
+	case Snappy:
+		return snappyCompressor, nil
+	}
+	return nil, ErrUnknownCompressor
+}
+
+var (
+	deflateCompressor = &DeflateCompressor{}
+	zstdCompressor    = NewZstdCompressor()
+	snappyCompressor  = &SnappyCompressor{}
+)
+
+// DeflateCompressor compresses data with zlib, like DeflateData and InflateData
+type DeflateCompressor struct{}
+
+// GetName returns the name of the algorithm
+func (c *DeflateCompressor) GetName() string {
+	return Deflate
+}
+
+// Compress compresses data
+func (c *DeflateCompressor) Compress(data []byte) ([]byte, error) {
+	return DeflateData(data)
+}
+
+// Decompress decompresses data
+func (c *DeflateCompressor) Decompress(data []byte) ([]byte, error) {
+	return InflateData(data)
+}
+
+func (c *DeflateCompressor) decompressLimited(data []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	decompressed, err := io.ReadAll(io.LimitReader(zr, MaxDecompressedSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(decompressed) > MaxDecompressedSize {
+		return nil, ErrDecompressedSizeExceeded
+	}
+	return decompressed, nil
+}
+
+// ZstdCompressor compresses data with zstd, optionally using one of the
+// loaded dictionaries. It is safe for concurrent use
+type ZstdCompressor struct {
+	encoder      *zstd.Encoder
+	dictionaryID uint32
+}
+
+// NewZstdCompressor returns a new zstd compressor
+func NewZstdCompressor() *ZstdCompressor {
+	// creating it without options and writer never fails
+	encoder, _ := zstd.NewWriter(nil)
+	return &ZstdCompressor{encoder: encoder}
+}
+
+// GetName returns the name of the algorithm
+func (c *ZstdCompressor) GetName() string {
+	return Zstd
+}
+
+// DictionaryID returns the ID of the dictionary used to compress the data,
+// which is zero when there is none
+func (c *ZstdCompressor) DictionaryID() uint32 {
+	return c.dictionaryID
+}
+
+// Compress compresses data
+func (c *ZstdCompressor) Compress(data []byte) ([]byte, error) {
+	return c.encoder.EncodeAll(data, nil), nil
+}
+
+// Decompress decompresses data, which can have been compressed with any of
+// the loaded dictionaries
+func (c *ZstdCompressor) Decompress(data []byte) ([]byte, error) {
+	decoder, _ := zstdDictionaries.getDecoders()
+	return decoder.DecodeAll(data, nil)
+}
+
+func (c *ZstdCompressor) decompressLimited(data []byte) ([]byte, error) {
+	_, decoder := zstdDictionaries.getDecoders()
+	decompressed, err := decoder.DecodeAll(data, nil)
+	if errors.Is(err, zstd.ErrDecoderSizeExceeded) || errors.Is(err, zstd.ErrWindowSizeExceeded) {
+		return nil, ErrDecompressedSizeExceeded
+	}
+	return decompressed, err
+}
+
+// SnappyCompressor compresses data with the snappy block format
+type SnappyCompressor struct{}
+
+// GetName returns the name of the algorithm
+func (c *SnappyCompressor) GetName() string {
+	return Snappy
+}
+
+// Compress compresses data
+func (c *SnappyCompressor) Compress(data []byte) ([]byte, error) {
+	return snappy.Encode(nil, data), nil
+}
+
+// Decompress decompresses data
+func (c *SnappyCompressor) Decompress(data []byte) ([]byte, error) {
+	return snappy.Decode(nil, data)
+}
+
+func (c *SnappyCompressor) decompressLimited(data []byte) ([]byte, error) {
+	size, err := snappy.DecodedLen(data)
+	if err != nil {
+		return nil, err
+	}
+	if size > MaxDecompressedSize {
+		return nil, ErrDecompressedSizeExceeded
+	}
+	return snappy.Decode(nil, data)
+}
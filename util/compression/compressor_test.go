@@ -0,0 +1,85 @@
+package compression
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetCompressor(t *testing.T) {
+	for _, name := range Algorithms() {
+		t.Run(name, func(t *testing.T) {
+			c, err := GetCompressor(name)
+			require.NoError(t, err)
+			assert.Equal(t, name, c.GetName())
+		})
+	}
+
+	_, err := GetCompressor("lz4")
+	assert.Equal(t, ErrUnknownCompressor, err)
+}
+
+func TestCompressorRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte(`{"id":1,"name":"sword","rarity":"common"}`), 100)
+	for _, name := range Algorithms() {
+		t.Run(name, func(t *testing.T) {
+			c, err := GetCompressor(name)
+			require.NoError(t, err)
+
+			compressed, err := c.Compress(data)
+			require.NoError(t, err)
+			assert.Less(t, len(compressed), len(data))
+
+			decompressed, err := c.Decompress(compressed)
+			require.NoError(t, err)
+			assert.Equal(t, data, decompressed)
+
+			_, err = c.Decompress([]byte("arbitrary data"))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestDeflateCompressorMatchesDeflateData(t *testing.T) {
+	for _, in := range ins {
+		t.Run(in.name, func(t *testing.T) {
+			expected, err := DeflateData([]byte(in.data))
+			require.NoError(t, err)
+
+			compressed, err := (&DeflateCompressor{}).Compress([]byte(in.data))
+			require.NoError(t, err)
+			assert.Equal(t, expected, compressed)
+		})
+	}
+}
+
+func TestDecompressLimited(t *testing.T) {
+	data := make([]byte, MaxDecompressedSize+1)
+	for _, name := range Algorithms() {
+		t.Run(name, func(t *testing.T) {
+			c, err := GetCompressor(name)
+			require.NoError(t, err)
+
+			_, err = DecompressLimited(c, mustCompress(t, c, data))
+			assert.Equal(t, ErrDecompressedSizeExceeded, err)
+
+			decompressed, err := DecompressLimited(c, mustCompress(t, c, data[:MaxDecompressedSize]))
+			require.NoError(t, err)
+			assert.Len(t, decompressed, MaxDecompressedSize)
+
+			// the data of trusted peers is not limited
+			decompressed, err = c.Decompress(mustCompress(t, c, data))
+			require.NoError(t, err)
+			assert.Len(t, decompressed, MaxDecompressedSize+1)
+		})
+	}
+}
+
+func mustCompress(t *testing.T, c Compressor, data []byte) []byte {
+	t.Helper()
+	compressed, err := c.Compress(data)
+	require.NoError(t, err)
+	return compressed
+}
@@ -0,0 +1,140 @@
+package compression
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Errors of the zstd dictionaries
+var (
+	ErrInvalidZstdDictionary = errors.New("zstd dictionary must have a non zero ID")
+	ErrUnknownZstdDictionary = errors.New("zstd dictionary not loaded")
+)
+
+var zstdDictionaries = newZstdDictionaryStore()
+
+// zstdDictionaryStore keeps the loaded dictionaries and the decoders that
+// know all of them, as the ID of the dictionary is written in the zstd frames
+type zstdDictionaryStore struct {
+	mutex          sync.RWMutex
+	dictionaries   map[uint32][]byte
+	compressors    map[uint32]*ZstdCompressor
+	decoder        *zstd.Decoder
+	limitedDecoder *zstd.Decoder // decodes up to MaxDecompressedSize
+}
+
+func newZstdDictionaryStore() *zstdDictionaryStore {
+	// creating them without dictionaries and reader never fails
+	decoder, limitedDecoder, _ := newZstdDecoders()
+	return &zstdDictionaryStore{
+		dictionaries:   map[uint32][]byte{},
+		compressors:    map[uint32]*ZstdCompressor{},
+		decoder:        decoder,
+		limitedDecoder: limitedDecoder,
+	}
+}
+
+// newZstdDecoders returns a decoder and a limited decoder that know the
+// dictionaries
+func newZstdDecoders(dictionaries ...[]byte) (*zstd.Decoder, *zstd.Decoder, error) {
+	decoder, err := zstd.NewReader(nil, zstd.WithDecoderDicts(dictionaries...))
+	if err != nil {
+		return nil, nil, err
+	}
+	limitedDecoder, err := zstd.NewReader(nil, zstd.WithDecoderDicts(dictionaries...), zstd.WithDecoderMaxMemory(MaxDecompressedSize))
+	if err != nil {
+		return nil, nil, err
+	}
+	return decoder, limitedDecoder, nil
+}
+
+func (s *zstdDictionaryStore) getDecoders() (*zstd.Decoder, *zstd.Decoder) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.decoder, s.limitedDecoder
+}
+
+func (s *zstdDictionaryStore) load(dictionary []byte) (uint32, error) {
+	info, err := zstd.InspectDictionary(dictionary)
+	if err != nil {
+		return 0, err
+	}
+	id := info.ID()
+	if id == 0 {
+		return 0, ErrInvalidZstdDictionary
+	}
+	// the default level of the encoder barely uses the dictionary for small
+	// payloads, which are the ones that benefit from it
+	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderDict(dictionary), zstd.WithEncoderLevel(zstd.SpeedFastest))
+	if err != nil {
+		return 0, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	dictionaries := [][]byte{dictionary}
+	for loadedID, loaded := range s.dictionaries {
+		if loadedID != id {
+			dictionaries = append(dictionaries, loaded)
+		}
+	}
+	decoder, limitedDecoder, err := newZstdDecoders(dictionaries...)
+	if err != nil {
+		return 0, err
+	}
+	// the previous decoders are not closed, as they can still be decoding
+	s.decoder = decoder
+	s.limitedDecoder = limitedDecoder
+	s.dictionaries[id] = dictionary
+	s.compressors[id] = &ZstdCompressor{encoder: encoder, dictionaryID: id}
+	return id, nil
+}
+
+// LoadZstdDictionary loads a dictionary trained with `zstd --train`, whose
+// ID is taken as its version, and returns the ID. The data compressed with
+// any of the loaded dictionaries is decompressed by the zstd compressors,
+// loading a dictionary with the same ID of a loaded one replaces it
+func LoadZstdDictionary(dictionary []byte) (uint32, error) {
+	return zstdDictionaries.load(dictionary)
+}
+
+// ZstdDictionaryIDs returns the IDs of the loaded dictionaries, sorted
+func ZstdDictionaryIDs() []uint32 {
+	zstdDictionaries.mutex.RLock()
+	defer zstdDictionaries.mutex.RUnlock()
+	ids := make([]uint32, 0, len(zstdDictionaries.dictionaries))
+	for id := range zstdDictionaries.dictionaries {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// GetZstdDictionaryCompressor returns the compressor that compresses the data
+// with the loaded dictionary with id
+func GetZstdDictionaryCompressor(id uint32) (*ZstdCompressor, error) {
+	zstdDictionaries.mutex.RLock()
+	defer zstdDictionaries.mutex.RUnlock()
+	compressor, ok := zstdDictionaries.compressors[id]
+	if !ok {
+		return nil, ErrUnknownZstdDictionary
+	}
+	return compressor, nil
+}
+
+// LatestZstdDictionary returns the highest ID of the loaded dictionaries
+// that is in ids, or zero when none of them is loaded
+func LatestZstdDictionary(ids []uint32) uint32 {
+	zstdDictionaries.mutex.RLock()
+	defer zstdDictionaries.mutex.RUnlock()
+	latest := uint32(0)
+	for _, id := range ids {
+		if _, ok := zstdDictionaries.dictionaries[id]; ok && id > latest {
+			latest = id
+		}
+	}
+	return latest
+}
@@ -0,0 +1,77 @@
+package compression
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustLoadZstdDictionary(t *testing.T, name string) uint32 {
+	t.Helper()
+	dictionary, err := os.ReadFile(filepath.Join("fixtures", name))
+	require.NoError(t, err)
+	id, err := LoadZstdDictionary(dictionary)
+	require.NoError(t, err)
+	return id
+}
+
+func TestLoadZstdDictionary(t *testing.T) {
+	assert.Equal(t, uint32(1), mustLoadZstdDictionary(t, "zstd_dictionary_1"))
+	assert.Equal(t, uint32(2), mustLoadZstdDictionary(t, "zstd_dictionary_2"))
+	assert.Equal(t, uint32(2), mustLoadZstdDictionary(t, "zstd_dictionary_2"))
+	assert.Subset(t, ZstdDictionaryIDs(), []uint32{1, 2})
+
+	_, err := LoadZstdDictionary([]byte("not a dictionary"))
+	assert.Error(t, err)
+}
+
+func TestZstdDictionaryCompressorRoundTrip(t *testing.T) {
+	mustLoadZstdDictionary(t, "zstd_dictionary_1")
+	mustLoadZstdDictionary(t, "zstd_dictionary_2")
+	data := []byte(`{"id":1,"name":"sword","rarity":"common","level":10}`)
+
+	for _, id := range []uint32{1, 2} {
+		c, err := GetZstdDictionaryCompressor(id)
+		require.NoError(t, err)
+		assert.Equal(t, Zstd, c.GetName())
+		assert.Equal(t, id, c.DictionaryID())
+
+		compressed, err := c.Compress(data)
+		require.NoError(t, err)
+
+		// any zstd compressor decompresses the data of the loaded dictionaries
+		decompressed, err := NewZstdCompressor().Decompress(compressed)
+		require.NoError(t, err)
+		assert.Equal(t, data, decompressed)
+	}
+
+	_, err := GetZstdDictionaryCompressor(42)
+	assert.Equal(t, ErrUnknownZstdDictionary, err)
+}
+
+func TestZstdDictionaryCompressesSmallPayloads(t *testing.T) {
+	mustLoadZstdDictionary(t, "zstd_dictionary_1")
+	// the fixtures were trained with room states like this one
+	data := []byte(`{"room":"arena-3","tick":7,"players":[{"id":12,"name":"player-4","x":10,"y":20,"hp":30,"state":"idle"}]}`)
+
+	withDictionary, err := GetZstdDictionaryCompressor(1)
+	require.NoError(t, err)
+	compressed, err := withDictionary.Compress(data)
+	require.NoError(t, err)
+	plain, err := NewZstdCompressor().Compress(data)
+	require.NoError(t, err)
+	assert.Less(t, len(compressed), len(plain))
+}
+
+func TestLatestZstdDictionary(t *testing.T) {
+	mustLoadZstdDictionary(t, "zstd_dictionary_1")
+	mustLoadZstdDictionary(t, "zstd_dictionary_2")
+
+	assert.Equal(t, uint32(2), LatestZstdDictionary([]uint32{1, 2}))
+	assert.Equal(t, uint32(1), LatestZstdDictionary([]uint32{1, 42}))
+	assert.Equal(t, uint32(0), LatestZstdDictionary([]uint32{42}))
+	assert.Equal(t, uint32(0), LatestZstdDictionary(nil))
+}
@@ -21,7 +21,9 @@
 package util
 
 import (
+	"bytes"
 	"context"
+	gojson "encoding/json"
 	"errors"
 	"fmt"
 	"os"
@@ -40,7 +42,9 @@ import (
 	"github.com/topfreegames/pitaya/v2/protos"
 	"github.com/topfreegames/pitaya/v2/serialize"
 	"github.com/topfreegames/pitaya/v2/serialize/json"
+	"github.com/topfreegames/pitaya/v2/serialize/msgpack"
 	"github.com/topfreegames/pitaya/v2/serialize/protobuf"
+	"github.com/topfreegames/pitaya/v2/serialize/protojson"
 	"github.com/topfreegames/pitaya/v2/tracing"
 
 	opentracing "github.com/opentracing/opentracing-go"
@@ -117,6 +121,48 @@ func SerializeOrRaw(serializer serialize.Serializer, v interface{}) ([]byte, err
 	return data, nil
 }
 
+// UnmarshalValue unmarshals payload, serialized with serializer, into a
+// generic value that any serializer can marshal again. Integer JSON numbers
+// are kept as integers
+func UnmarshalValue(serializer serialize.Serializer, payload []byte) (interface{}, error) {
+	var v interface{}
+	switch serializer.(type) {
+	case *json.Serializer, *protojson.Serializer:
+		dec := gojson.NewDecoder(bytes.NewReader(payload))
+		dec.UseNumber()
+		if err := dec.Decode(&v); err != nil {
+			return nil, err
+		}
+		return fromJSONNumbers(v), nil
+	}
+	if err := serializer.Unmarshal(payload, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// fromJSONNumbers replaces the json.Number values in v with int64 values,
+// or float64 values for the numbers that are not integers
+func fromJSONNumbers(v interface{}) interface{} {
+	switch value := v.(type) {
+	case gojson.Number:
+		if n, err := value.Int64(); err == nil {
+			return n
+		}
+		f, _ := value.Float64()
+		return f
+	case map[string]interface{}:
+		for k, item := range value {
+			value[k] = fromJSONNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range value {
+			value[i] = fromJSONNumbers(item)
+		}
+	}
+	return v
+}
+
 // FileExists tells if a file exists
 func FileExists(filename string) bool {
 	_, err := os.Stat(filename)
@@ -129,7 +175,7 @@ func GetErrorFromPayload(serializer serialize.Serializer, payload []byte) error
 	switch serializer.(type) {
 	case *json.Serializer:
 		_ = serializer.Unmarshal(payload, err)
-	case *protobuf.Serializer:
+	case *protobuf.Serializer, *protojson.Serializer, *msgpack.Serializer:
 		pErr := &protos.Error{Code: e.ErrUnknownCode}
 		_ = serializer.Unmarshal(payload, pErr)
 		err = &e.Error{Code: pErr.Code, Message: pErr.Msg, Metadata: pErr.Metadata}
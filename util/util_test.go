@@ -32,8 +32,14 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/topfreegames/pitaya/v2/conn/message"
 	"github.com/topfreegames/pitaya/v2/constants"
+	e "github.com/topfreegames/pitaya/v2/errors"
 	"github.com/topfreegames/pitaya/v2/protos"
+	"github.com/topfreegames/pitaya/v2/serialize"
+	"github.com/topfreegames/pitaya/v2/serialize/json"
 	"github.com/topfreegames/pitaya/v2/serialize/mocks"
+	"github.com/topfreegames/pitaya/v2/serialize/msgpack"
+	"github.com/topfreegames/pitaya/v2/serialize/protobuf"
+	"github.com/topfreegames/pitaya/v2/serialize/protojson"
 )
 
 var update = flag.Bool("update", false, "update .golden files")
@@ -149,6 +155,34 @@ func TestSerializeOrRaw(t *testing.T) {
 	}
 }
 
+func TestUnmarshalValue(t *testing.T) {
+	t.Parallel()
+	msgpackData, err := msgpack.NewSerializer().Marshal(map[string]interface{}{"id": 1, "name": "pitaya"})
+	assert.NoError(t, err)
+
+	tables := []struct {
+		name       string
+		serializer serialize.Serializer
+		in         []byte
+		out        interface{}
+	}{
+		{"json", json.NewSerializer(), []byte(`{"id":9007199254740993,"ratio":0.5,"list":[1]}`), map[string]interface{}{"id": int64(9007199254740993), "ratio": 0.5, "list": []interface{}{int64(1)}}},
+		{"protojson", protojson.NewSerializer(), []byte(`{"id":9007199254740993}`), map[string]interface{}{"id": int64(9007199254740993)}},
+		{"msgpack", msgpack.NewSerializer(), msgpackData, map[string]interface{}{"id": int64(1), "name": "pitaya"}},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			v, err := UnmarshalValue(table.serializer, table.in)
+			assert.NoError(t, err)
+			assert.Equal(t, table.out, v)
+		})
+	}
+
+	_, err = UnmarshalValue(protobuf.NewSerializer(), []byte{0x01})
+	assert.Error(t, err)
+}
+
 func TestFileExists(t *testing.T) {
 	t.Parallel()
 	ins := []struct {
@@ -196,6 +230,28 @@ func TestGetErrorPayload(t *testing.T) {
 	}
 }
 
+func TestGetErrorFromPayload(t *testing.T) {
+	t.Parallel()
+	tables := []struct {
+		name       string
+		serializer serialize.Serializer
+	}{
+		{"protobuf", protobuf.NewSerializer()},
+		{"protojson", protojson.NewSerializer()},
+		{"msgpack", msgpack.NewSerializer()},
+	}
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			in := e.NewError(errors.New("bad request"), e.ErrBadRequestCode, map[string]string{"key": "value"})
+			payload, err := GetErrorPayload(table.serializer, in)
+			assert.NoError(t, err)
+
+			out := GetErrorFromPayload(table.serializer, payload)
+			assert.Equal(t, in, out)
+		})
+	}
+}
+
 func TestConvertProtoToMessageType(t *testing.T) {
 	t.Parallel()
 	tables := []struct {